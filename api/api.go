@@ -52,18 +52,44 @@ func (srv *Server) initAPI(addr string) {
 	handleHTTPRequest(mux, "/gateway/status", srv.gatewayStatusHandler)
 	handleHTTPRequest(mux, "/gateway/peers/add", srv.gatewayPeersAddHandler)
 	handleHTTPRequest(mux, "/gateway/peers/remove", srv.gatewayPeersRemoveHandler)
+	handleHTTPRequest(mux, "/gateway/peers/ban", srv.gatewayPeersBanHandler)
+	handleHTTPRequest(mux, "/gateway/peers/bans", srv.gatewayPeersBansHandler)
+	handleHTTPRequest(mux, "/gateway/peers/unban", srv.gatewayPeersUnbanHandler)
 
 	// Host API Calls
 	if srv.host != nil {
 		handleHTTPRequest(mux, "/host/announce", srv.hostAnnounceHandler)
 		handleHTTPRequest(mux, "/host/configure", srv.hostConfigureHandler)
+		handleHTTPRequest(mux, "/host/contracts", srv.hostContractsHandler)
+		handleHTTPRequest(mux, "/host/limits", srv.hostLimitsHandler)
+		handleHTTPRequest(mux, "/host/limits/configure", srv.hostLimitsConfigureHandler)
+		handleHTTPRequest(mux, "/host/maintenance", srv.hostMaintenanceHandler)
+		handleHTTPRequest(mux, "/host/maintenance/start", srv.hostMaintenanceStartHandler)
+		handleHTTPRequest(mux, "/host/maintenance/stop", srv.hostMaintenanceStopHandler)
+		handleHTTPRequest(mux, "/host/pricing", srv.hostPricingHandler)
+		handleHTTPRequest(mux, "/host/pricing/configure", srv.hostPricingConfigureHandler)
+		handleHTTPRequest(mux, "/host/scrub", srv.hostScrubHandler)
+		handleHTTPRequest(mux, "/host/scrub/configure", srv.hostScrubConfigureHandler)
 		handleHTTPRequest(mux, "/host/status", srv.hostStatusHandler)
+		handleHTTPRequest(mux, "/host/storage", srv.hostStorageHandler)
+		handleHTTPRequest(mux, "/host/storage/add", srv.hostStorageAddHandler)
+		handleHTTPRequest(mux, "/host/storage/remove", srv.hostStorageRemoveHandler)
+		handleHTTPRequest(mux, "/host/storage/resize", srv.hostStorageResizeHandler)
 	}
 
 	// HostDB API Calls
 	if srv.hostdb != nil {
+		handleHTTPRequest(mux, "/hostdb/diversity", srv.hostdbDiversityHandler)
+		handleHTTPRequest(mux, "/hostdb/diversity/configure", srv.hostdbDiversityConfigureHandler)
+		handleHTTPRequest(mux, "/hostdb/host", srv.hostdbHostHandler)
 		handleHTTPRequest(mux, "/hostdb/hosts/active", srv.hostdbHostsActiveHandler)
 		handleHTTPRequest(mux, "/hostdb/hosts/all", srv.hostdbHostsAllHandler)
+		handleHTTPRequest(mux, "/hostdb/hosts/scores", srv.hostdbHostsScoresHandler)
+		handleHTTPRequest(mux, "/hostdb/rescan", srv.hostdbRescanHandler)
+		handleHTTPRequest(mux, "/hostdb/scan/configure", srv.hostdbScanConfigureHandler)
+		handleHTTPRequest(mux, "/hostdb/status", srv.hostdbStatusHandler)
+		handleHTTPRequest(mux, "/hostdb/weights", srv.hostdbWeightsHandler)
+		handleHTTPRequest(mux, "/hostdb/weights/configure", srv.hostdbWeightsConfigureHandler)
 	}
 
 	// Miner API Calls
@@ -102,7 +102,7 @@ func (srv *Server) debugMutextestHandler(w http.ResponseWriter, req *http.Reques
 		mds.Host = true
 	}()
 	go func() {
-		srv.hostdb.RemoveHost("")
+		srv.hostdb.RemoveHost(types.SiaPublicKey{})
 		mds.HostDB = true
 	}()
 	go func() {
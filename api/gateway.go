@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 )
@@ -11,6 +12,11 @@ type GatewayInfo struct {
 	Peers   []modules.NetAddress
 }
 
+// GatewayBans contains the bans that have not yet expired.
+type GatewayBans struct {
+	Bans []modules.PeerBan
+}
+
 // gatewayStatusHandler handles the API call asking for the gatway status.
 func (srv *Server) gatewayStatusHandler(w http.ResponseWriter, req *http.Request) {
 	peers := srv.gateway.Peers()
@@ -43,3 +49,50 @@ func (srv *Server) gatewayPeersRemoveHandler(w http.ResponseWriter, req *http.Re
 
 	writeSuccess(w)
 }
+
+// gatewayPeersBanHandler handles the API call to ban an address. The ban lasts
+// for MisbehaviorBanDuration unless a duration is supplied.
+func (srv *Server) gatewayPeersBanHandler(w http.ResponseWriter, req *http.Request) {
+	addr := modules.NetAddress(req.FormValue("address"))
+	duration := modules.MisbehaviorBanDuration
+	if req.FormValue("duration") != "" {
+		var err error
+		duration, err = time.ParseDuration(req.FormValue("duration"))
+		if err != nil {
+			writeError(w, "Malformed duration", http.StatusBadRequest)
+			return
+		}
+	}
+	reason := req.FormValue("reason")
+	if reason == "" {
+		reason = "banned manually"
+	}
+	err := srv.gateway.Ban(addr, duration, reason)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSuccess(w)
+}
+
+// gatewayPeersBansHandler handles the API call asking for the list of bans.
+func (srv *Server) gatewayPeersBansHandler(w http.ResponseWriter, req *http.Request) {
+	bans := srv.gateway.Bans()
+	if bans == nil {
+		bans = make([]modules.PeerBan, 0)
+	}
+	writeJSON(w, GatewayBans{bans})
+}
+
+// gatewayPeersUnbanHandler handles the API call to lift the ban on an address.
+func (srv *Server) gatewayPeersUnbanHandler(w http.ResponseWriter, req *http.Request) {
+	addr := modules.NetAddress(req.FormValue("address"))
+	err := srv.gateway.Unban(addr)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSuccess(w)
+}
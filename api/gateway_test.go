@@ -46,7 +46,7 @@ func TestGatewayStatus(t *testing.T) {
 
 func TestGatewayPeerAdd(t *testing.T) {
 	st := newServerTester("TestGatewayPeerAdd", t)
-	peer, err := gateway.New(":0", build.TempDir("api", "TestGatewayPeerAdd", "gateway"))
+	peer, err := gateway.New(":0", build.TempDir("api", "TestGatewayPeerAdd", "gateway"), false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -61,7 +61,7 @@ func TestGatewayPeerAdd(t *testing.T) {
 
 func TestGatewayPeerRemove(t *testing.T) {
 	st := newServerTester("TestGatewayPeerRemove", t)
-	peer, err := gateway.New(":0", build.TempDir("api", "TestGatewayPeerRemove", "gateway"))
+	peer, err := gateway.New(":0", build.TempDir("api", "TestGatewayPeerRemove", "gateway"), false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2,16 +2,42 @@ package api
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
+// HostContracts lists the contracts in the host's contract ledger.
+type HostContracts struct {
+	Contracts []modules.ContractRecord
+}
+
+// HostScrub contains the settings of the host's scrubber and the results of
+// its last scrub.
+type HostScrub struct {
+	Settings modules.ScrubSettings
+	Status   modules.ScrubStatus
+}
+
+// HostStorageFolders lists the storage folders in use by the host.
+type HostStorageFolders struct {
+	Folders []modules.StorageFolderMetadata
+}
+
 // hostAnnounceHandler handles the API call to get the host to announce itself
 // to the network.
 func (srv *Server) hostAnnounceHandler(w http.ResponseWriter, req *http.Request) {
 	// Announce checks that the host is connectible before proceeding. The
-	// user can override this check with the 'force' flag.
+	// user can override this check with the 'force' flag. An address, which
+	// may contain a hostname, can be given to announce instead of the host's
+	// external IP.
 	var err error
-	if req.FormValue("force") == "true" {
+	if req.FormValue("address") != "" {
+		err = srv.host.AnnounceAddress(modules.NetAddress(req.FormValue("address")))
+	} else if req.FormValue("force") == "true" {
 		err = srv.host.ForceAnnounce()
 	} else {
 		err = srv.host.Announce()
@@ -38,8 +64,29 @@ func (srv *Server) hostConfigureHandler(w http.ResponseWriter, req *http.Request
 		"windowsize":   &config.WindowSize,
 		"price":        &config.Price,
 		"collateral":   &config.Collateral,
+
+		"downloadprice": &config.DownloadPrice,
+
+		"maxcontractcollateral": &config.MaxContractCollateral,
+		"collateralbudget":      &config.CollateralBudget,
+	}
+
+	if !scanQueryVars(w, req, qsVars) {
+		return
+	}
+
+	err := srv.host.SetSettings(config)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	writeSuccess(w)
+}
 
+// scanQueryVars scans each supplied query string value into the corresponding
+// field of 'qsVars'. If a value is malformed or no values are supplied, an
+// error is written and false is returned.
+func scanQueryVars(w http.ResponseWriter, req *http.Request, qsVars map[string]interface{}) bool {
 	any := false
 	for qs := range qsVars {
 		// only modify supplied values
@@ -47,17 +94,164 @@ func (srv *Server) hostConfigureHandler(w http.ResponseWriter, req *http.Request
 			_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
 			if err != nil {
 				writeError(w, "Malformed "+qs, http.StatusBadRequest)
-				return
+				return false
 			}
 			any = true
 		}
 	}
 	if !any {
 		writeError(w, "No valid configuration fields specified", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// hostContractsHandler handles the API call that lists the contracts in the
+// host's contract ledger. The contracts can be filtered by outcome and by the
+// range of heights at which they were formed.
+func (srv *Server) hostContractsHandler(w http.ResponseWriter, req *http.Request) {
+	outcome := req.FormValue("outcome")
+	minHeight, maxHeight := types.BlockHeight(0), types.BlockHeight(math.MaxUint64)
+	qsVars := map[string]interface{}{
+		"minheight": &minHeight,
+		"maxheight": &maxHeight,
+	}
+	for qs, v := range qsVars {
+		if req.FormValue(qs) == "" {
+			continue
+		}
+		_, err := fmt.Sscan(req.FormValue(qs), v)
+		if err != nil {
+			writeError(w, "Malformed "+qs, http.StatusBadRequest)
+			return
+		}
+	}
+
+	contracts := []modules.ContractRecord{}
+	for _, cr := range srv.host.Contracts() {
+		if outcome != "" && cr.Outcome != outcome {
+			continue
+		}
+		if cr.FormationHeight < minHeight || cr.FormationHeight > maxHeight {
+			continue
+		}
+		contracts = append(contracts, cr)
+	}
+	writeJSON(w, HostContracts{Contracts: contracts})
+}
+
+// hostLimitsHandler handles the API call that returns the host's connection
+// limits.
+func (srv *Server) hostLimitsHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.host.ConnectionLimits())
+}
+
+// hostLimitsConfigureHandler handles the API call to set the host's
+// connection limits.
+func (srv *Server) hostLimitsConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	limits := srv.host.ConnectionLimits()
+	qsVars := map[string]interface{}{
+		"maxconnections":      &limits.MaxConnections,
+		"maxconnectionsperip": &limits.MaxConnectionsPerIP,
+		"negotiationrate":     &limits.NegotiationRate,
+		"negotiationburst":    &limits.NegotiationBurst,
+	}
+	if !scanQueryVars(w, req, qsVars) {
+		return
+	}
+
+	err := srv.host.SetConnectionLimits(limits)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostMaintenanceHandler handles the API call that returns the host's drain
+// report.
+func (srv *Server) hostMaintenanceHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.host.DrainReport())
+}
+
+// hostMaintenanceStartHandler handles the API call that puts the host in
+// maintenance mode.
+func (srv *Server) hostMaintenanceStartHandler(w http.ResponseWriter, req *http.Request) {
+	err := srv.host.SetMaintenance(true)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostMaintenanceStopHandler handles the API call that takes the host out of
+// maintenance mode.
+func (srv *Server) hostMaintenanceStopHandler(w http.ResponseWriter, req *http.Request) {
+	err := srv.host.SetMaintenance(false)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostPricingHandler handles the API call that returns the host's pricing
+// policy.
+func (srv *Server) hostPricingHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.host.PricingPolicy())
+}
+
+// hostPricingConfigureHandler handles the API call to set the host's pricing
+// policy.
+func (srv *Server) hostPricingConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	policy := srv.host.PricingPolicy()
+	qsVars := map[string]interface{}{
+		"enabled":       &policy.Enabled,
+		"minprice":      &policy.MinPrice,
+		"maxprice":      &policy.MaxPrice,
+		"mincollateral": &policy.MinCollateral,
+		"maxcollateral": &policy.MaxCollateral,
+	}
+	if !scanQueryVars(w, req, qsVars) {
+		return
+	}
+
+	err := srv.host.SetPricingPolicy(policy)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostScrubHandler handles the API call that returns the settings and status
+// of the host's scrubber.
+func (srv *Server) hostScrubHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, HostScrub{
+		Settings: srv.host.ScrubSettings(),
+		Status:   srv.host.ScrubStatus(),
+	})
+}
+
+// hostScrubConfigureHandler handles the API call to set the settings of the
+// host's scrubber.
+func (srv *Server) hostScrubConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	settings := srv.host.ScrubSettings()
+	qsVars := map[string]interface{}{
+		"enabled":  &settings.Enabled,
+		"interval": &settings.Interval,
+		"readrate": &settings.ReadRate,
+	}
+	if !scanQueryVars(w, req, qsVars) {
 		return
 	}
 
-	srv.host.SetSettings(config)
+	err := srv.host.SetScrubSettings(settings)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	writeSuccess(w)
 }
 
@@ -65,3 +259,52 @@ func (srv *Server) hostConfigureHandler(w http.ResponseWriter, req *http.Request
 func (srv *Server) hostStatusHandler(w http.ResponseWriter, req *http.Request) {
 	writeJSON(w, srv.host.Info())
 }
+
+// hostStorageHandler handles the API call that lists the host's storage
+// folders.
+func (srv *Server) hostStorageHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, HostStorageFolders{Folders: srv.host.StorageFolders()})
+}
+
+// hostStorageAddHandler handles the API call to add a storage folder to the
+// host.
+func (srv *Server) hostStorageAddHandler(w http.ResponseWriter, req *http.Request) {
+	size, err := strconv.ParseUint(req.FormValue("size"), 10, 64)
+	if err != nil {
+		writeError(w, "Malformed size", http.StatusBadRequest)
+		return
+	}
+	err = srv.host.AddStorageFolder(req.FormValue("path"), size)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostStorageRemoveHandler handles the API call to remove a storage folder
+// from the host.
+func (srv *Server) hostStorageRemoveHandler(w http.ResponseWriter, req *http.Request) {
+	err := srv.host.RemoveStorageFolder(req.FormValue("path"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostStorageResizeHandler handles the API call to change the size of one of
+// the host's storage folders.
+func (srv *Server) hostStorageResizeHandler(w http.ResponseWriter, req *http.Request) {
+	size, err := strconv.ParseUint(req.FormValue("size"), 10, 64)
+	if err != nil {
+		writeError(w, "Malformed size", http.StatusBadRequest)
+		return
+	}
+	err = srv.host.ResizeStorageFolder(req.FormValue("path"), size)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 )
@@ -13,6 +14,72 @@ type ActiveHosts struct {
 	Hosts []modules.HostSettings
 }
 
+// HostDBDiversity contains the constraints on the hosts that can be selected
+// together, and the hosts left out of the most recent selection.
+type HostDBDiversity struct {
+	Settings   modules.HostDiversitySettings
+	Exclusions []modules.HostExclusion
+}
+
+// HostDBEntries contains every host known to the hostdb, with statistics
+// computed from their recent scans.
+type HostDBEntries struct {
+	Hosts []modules.HostDBEntry
+}
+
+// HostDBStatus contains the number of hosts known to the hostdb, the progress
+// of its scanning, and the settings that control scanning.
+type HostDBStatus struct {
+	KnownHosts   int
+	ActiveHosts  int
+	Scan         modules.HostScanStatus
+	ScanSettings modules.HostScanSettings
+}
+
+// HostDetails contains a host known to the hostdb, its recent scans, and its
+// recent interactions with the renter.
+type HostDetails struct {
+	Host         modules.HostDBEntry
+	Scans        []modules.HostScan
+	Interactions []modules.HostInteraction
+}
+
+// HostScores contains the breakdown of the weight of each host in the hostdb.
+type HostScores struct {
+	Scores []modules.HostScore
+}
+
+// hostdbDiversityHandler handles the API call asking for the diversity
+// settings of the hostdb and the hosts that they excluded.
+func (srv *Server) hostdbDiversityHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, HostDBDiversity{
+		Settings:   srv.hostdb.DiversitySettings(),
+		Exclusions: srv.hostdb.Exclusions(),
+	})
+}
+
+// hostdbDiversityConfigureHandler handles the API call to change the
+// diversity settings of the hostdb. Settings that are not supplied are left
+// unchanged.
+func (srv *Server) hostdbDiversityConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	ds := srv.hostdb.DiversitySettings()
+	qsVars := map[string]interface{}{
+		"ipv4prefixlength": &ds.IPv4PrefixLength,
+		"ipv6prefixlength": &ds.IPv6PrefixLength,
+		"uniqueoperators":  &ds.UniqueOperators,
+	}
+	if !scanQueryVars(w, req, qsVars) {
+		return
+	}
+
+	err := srv.hostdb.SetDiversitySettings(ds)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
 // hostdbHostsActiveHandler handes the API call asking for the list of active
 // hosts.
 func (srv *Server) hostdbHostsActiveHandler(w http.ResponseWriter, req *http.Request) {
@@ -22,10 +89,118 @@ func (srv *Server) hostdbHostsActiveHandler(w http.ResponseWriter, req *http.Req
 	writeJSON(w, ah)
 }
 
+// hostdbHostHandler handles the API call asking for the details of the host
+// announced at an address.
+func (srv *Server) hostdbHostHandler(w http.ResponseWriter, req *http.Request) {
+	host, scans, interactions, exists := srv.hostdb.Host(modules.NetAddress(req.FormValue("addr")))
+	if !exists {
+		writeError(w, "No host is known at that address", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, HostDetails{Host: host, Scans: scans, Interactions: interactions})
+}
+
 // hostdbHostsAllHandler handes the API call asking for the list of all hosts.
 func (srv *Server) hostdbHostsAllHandler(w http.ResponseWriter, req *http.Request) {
-	ah := ActiveHosts{
-		Hosts: srv.hostdb.AllHosts(),
+	writeJSON(w, HostDBEntries{Hosts: srv.hostdb.HostEntries()})
+}
+
+// hostdbHostsScoresHandler handles the API call asking for the breakdown of
+// the weight of each host.
+func (srv *Server) hostdbHostsScoresHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, HostScores{Scores: srv.hostdb.HostScores()})
+}
+
+// hostdbRescanHandler handles the API call to rescan a host, or every host if
+// no address is supplied.
+func (srv *Server) hostdbRescanHandler(w http.ResponseWriter, req *http.Request) {
+	addr := req.FormValue("addr")
+	if addr == "" {
+		srv.hostdb.RescanAll()
+		writeSuccess(w)
+		return
 	}
-	writeJSON(w, ah)
+	err := srv.hostdb.Rescan(modules.NetAddress(addr))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostdbScanConfigureHandler handles the API call to change the settings that
+// control scanning. The intervals are given in minutes. Settings that are not
+// supplied are left unchanged.
+func (srv *Server) hostdbScanConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	ss := srv.hostdb.ScanSettings()
+	minInterval := uint64(ss.MinScanInterval / time.Minute)
+	maxInterval := uint64(ss.MaxScanInterval / time.Minute)
+	qsVars := map[string]interface{}{
+		"mininterval":      &minInterval,
+		"maxinterval":      &maxInterval,
+		"threads":          &ss.Threads,
+		"inactivecheckups": &ss.InactiveHostCheckups,
+	}
+	if !scanQueryVars(w, req, qsVars) {
+		return
+	}
+
+	// Only replace the intervals that were supplied, so that intervals which
+	// are not a whole number of minutes are left unchanged.
+	if req.FormValue("mininterval") != "" {
+		ss.MinScanInterval = time.Duration(minInterval) * time.Minute
+	}
+	if req.FormValue("maxinterval") != "" {
+		ss.MaxScanInterval = time.Duration(maxInterval) * time.Minute
+	}
+	err := srv.hostdb.SetScanSettings(ss)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostdbStatusHandler handles the API call asking for the number of hosts in
+// the hostdb and the progress of its scanning.
+func (srv *Server) hostdbStatusHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, HostDBStatus{
+		KnownHosts:   len(srv.hostdb.AllHosts()),
+		ActiveHosts:  len(srv.hostdb.ActiveHosts()),
+		Scan:         srv.hostdb.ScanStatus(),
+		ScanSettings: srv.hostdb.ScanSettings(),
+	})
+}
+
+// hostdbWeightsHandler handles the API call asking for the settings used to
+// weigh hosts.
+func (srv *Server) hostdbWeightsHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.hostdb.WeightSettings())
+}
+
+// hostdbWeightsConfigureHandler handles the API call to change the settings
+// used to weigh hosts. Settings that are not supplied are left unchanged.
+func (srv *Server) hostdbWeightsConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	ws := srv.hostdb.WeightSettings()
+	qsVars := map[string]interface{}{
+		"priceexponent":       &ws.PriceExponent,
+		"collateralexponent":  &ws.CollateralExponent,
+		"storageexponent":     &ws.StorageExponent,
+		"uptimeexponent":      &ws.UptimeExponent,
+		"ageexponent":         &ws.AgeExponent,
+		"latencyexponent":     &ws.LatencyExponent,
+		"durationexponent":    &ws.DurationExponent,
+		"interactionexponent": &ws.InteractionExponent,
+		"duration":            &ws.Duration,
+	}
+	if !scanQueryVars(w, req, qsVars) {
+		return
+	}
+
+	err := srv.hostdb.SetWeightSettings(ws)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
@@ -163,13 +164,28 @@ func (srv *Server) renterStatusHandler(w http.ResponseWriter, req *http.Request)
 	writeJSON(w, srv.renter.Info())
 }
 
-// renterFilesUploadHandler handles the API call to upload a file.
+// renterFilesUploadHandler handles the API call to upload a file. The hosts
+// are chosen by the named host selection policy; the curated policy takes a
+// comma-separated list of host addresses.
 func (srv *Server) renterFilesUploadHandler(w http.ResponseWriter, req *http.Request) {
-	err := srv.renter.Upload(modules.FileUploadParams{
-		Filename: req.FormValue("source"),
-		Duration: duration,
-		Nickname: req.FormValue("nickname"),
-		Pieces:   redundancy,
+	policy := modules.HostPolicy{Name: req.FormValue("policy")}
+	if req.FormValue("hosts") != "" {
+		for _, addr := range strings.Split(req.FormValue("hosts"), ",") {
+			policy.Hosts = append(policy.Hosts, modules.NetAddress(strings.TrimSpace(addr)))
+		}
+	}
+	_, err := modules.NewHostSelector(policy)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = srv.renter.Upload(modules.FileUploadParams{
+		Filename:   req.FormValue("source"),
+		Duration:   duration,
+		Nickname:   req.FormValue("nickname"),
+		Pieces:     redundancy,
+		HostPolicy: policy,
 	})
 	if err != nil {
 		writeError(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
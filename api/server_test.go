@@ -82,7 +82,7 @@ func newServerTester(name string, t *testing.T) *serverTester {
 	APIPort++
 
 	// Create the modules.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir), false)
 	if err != nil {
 		t.Fatal("Failed to create gateway:", err)
 	}
@@ -102,7 +102,7 @@ func newServerTester(name string, t *testing.T) *serverTester {
 	if err != nil {
 		t.Fatal("Failed to create miner:", err)
 	}
-	hdb, err := hostdb.New(cs, g)
+	hdb, err := hostdb.New(cs, g, filepath.Join(testdir, modules.HostDBDir))
 	if err != nil {
 		t.Fatal("Failed to create hostdb:", err)
 	}
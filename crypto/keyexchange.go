@@ -0,0 +1,44 @@
+package crypto
+
+// keyexchange.go contains functions for performing an ephemeral
+// Diffie-Hellman key exchange over curve25519.
+
+import (
+	"crypto/rand"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	X25519KeySize = 32
+)
+
+type (
+	X25519SecretKey [X25519KeySize]byte
+	X25519PublicKey [X25519KeySize]byte
+)
+
+// GenerateX25519Keys creates a key pair for a Diffie-Hellman key exchange. The
+// keys are meant to be used for a single exchange and then discarded.
+func GenerateX25519Keys() (sk X25519SecretKey, pk X25519PublicKey, err error) {
+	_, err = rand.Read(sk[:])
+	if err != nil {
+		return
+	}
+	skNorm := [X25519KeySize]byte(sk)
+	var pkNorm [X25519KeySize]byte
+	curve25519.ScalarBaseMult(&pkNorm, &skNorm)
+	pk = pkNorm
+	return
+}
+
+// DeriveSharedSecret combines a secret key with the public key of the other
+// party to produce the secret that they share. The secret is hashed, so that it
+// can be used directly as a symmetric key.
+func DeriveSharedSecret(sk X25519SecretKey, pk X25519PublicKey) Hash {
+	skNorm := [X25519KeySize]byte(sk)
+	pkNorm := [X25519KeySize]byte(pk)
+	var secret [X25519KeySize]byte
+	curve25519.ScalarMult(&secret, &skNorm, &pkNorm)
+	return HashBytes(secret[:])
+}
@@ -0,0 +1,30 @@
+package crypto
+
+import (
+	"testing"
+)
+
+// TestDeriveSharedSecret checks that both parties to a key exchange derive
+// the same secret, and that a third party does not.
+func TestDeriveSharedSecret(t *testing.T) {
+	sk1, pk1, err := GenerateX25519Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk2, pk2, err := GenerateX25519Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk3, _, err := GenerateX25519Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := DeriveSharedSecret(sk1, pk2)
+	if DeriveSharedSecret(sk2, pk1) != secret {
+		t.Error("parties derived different secrets")
+	}
+	if DeriveSharedSecret(sk3, pk1) == secret || DeriveSharedSecret(sk3, pk2) == secret {
+		t.Error("third party derived the shared secret")
+	}
+}
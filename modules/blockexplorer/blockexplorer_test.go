@@ -53,7 +53,7 @@ func createExplorerTester(name string, t *testing.T) *explorerTester {
 	testdir := build.TempDir(modules.HostDir, name)
 
 	// Create the modules
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir), false)
 	if err != nil {
 		t.Fatal(err)
 	}
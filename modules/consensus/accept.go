@@ -22,6 +22,49 @@ var (
 	ErrOrphan                 = errors.New("block has no known parent")
 )
 
+// invalidBlockErrs are the errors returned by AcceptBlock that prove a block
+// is invalid. Any other error, such as a block being an orphan or a failure of
+// the local database, may not be the fault of the peer that sent the block.
+var invalidBlockErrs = map[error]struct{}{
+	ErrBadMinerPayouts: {},
+	ErrDoSBlock:        {},
+	ErrEarlyTimestamp:  {},
+	ErrLargeBlock:      {},
+	ErrMissedTarget:    {},
+
+	ErrIncorrectRevisionPayout:            {},
+	ErrInvalidStorageProof:                {},
+	ErrLowRevisionNumber:                  {},
+	ErrMissingFileContract:                {},
+	ErrMissingSiacoinOutput:               {},
+	ErrMissingSiafundOutput:               {},
+	ErrSiacoinInputOutputMismatch:         {},
+	ErrUnfinishedFileContract:             {},
+	ErrWrongSiacoinOutputUnlockConditions: {},
+
+	types.ErrDoubleSpend:                      {},
+	types.ErrFileContractOutputSumViolation:   {},
+	types.ErrFileContractWindowEndViolation:   {},
+	types.ErrFileContractWindowStartViolation: {},
+	types.ErrNonZeroClaimStart:                {},
+	types.ErrNonZeroRevision:                  {},
+	types.ErrStorageProofWithOutputs:          {},
+	types.ErrTimelockNotSatisfied:             {},
+	types.ErrTransactionTooLarge:              {},
+	types.ErrZeroMinerFee:                     {},
+	types.ErrZeroOutput:                       {},
+	types.ErrZeroRevision:                     {},
+
+	types.ErrEntropyKey:                {},
+	types.ErrFrivilousSignature:        {},
+	types.ErrInvalidPubKeyIndex:        {},
+	types.ErrMissingSignatures:         {},
+	types.ErrPrematureSignature:        {},
+	types.ErrPublicKeyOveruse:          {},
+	types.ErrSortedUniqueViolation:     {},
+	types.ErrWholeTransactionViolation: {},
+}
+
 // validHeader does some early, low computation verification on the block.
 func (cs *State) validHeader(b types.Block) error {
 	// Grab the parent of the block and verify the ID of the child meets the
@@ -163,7 +206,10 @@ func (cs *State) AcceptBlock(b types.Block) error {
 	return nil
 }
 
-// RelayBlock is an RPC that accepts a block from a peer.
+// RelayBlock is an RPC that accepts a block from a peer. Peers that relay
+// blocks that are proven invalid are banned; blocks that are already known,
+// orphaned, on a shorter fork, or timestamped in the future may have been
+// relayed in good faith.
 func (cs *State) RelayBlock(conn modules.PeerConn) error {
 	// Decode the block from the connection.
 	var b types.Block
@@ -180,8 +226,8 @@ func (cs *State) RelayBlock(conn modules.PeerConn) error {
 		// the parent is found.
 		go cs.Synchronize(modules.NetAddress(conn.RemoteAddr().String()))
 	}
-	if err != nil {
-		return err
+	if _, invalid := invalidBlockErrs[err]; invalid {
+		cs.gateway.Ban(modules.NetAddress(conn.RemoteAddr().String()), modules.MisbehaviorBanDuration, "relayed an invalid block: "+err.Error())
 	}
-	return nil
+	return err
 }
@@ -2,9 +2,11 @@ package consensus
 
 import (
 	"errors"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -383,3 +385,46 @@ func TestFutureTimestampHandling(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// relayBlock sends 'b' to the consensus set through the RelayBlock RPC.
+func (cst *consensusSetTester) relayBlock(b types.Block) error {
+	conn, peerConn := net.Pipe()
+	defer conn.Close()
+	go func() {
+		encoding.WriteObject(peerConn, b)
+		peerConn.Close()
+	}()
+	return cst.cs.RelayBlock(conn)
+}
+
+// TestRelayBlockBans checks that peers are only banned for relaying blocks
+// that are proven invalid.
+func TestRelayBlockBans(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	cst, err := createConsensusSetTester("TestRelayBlockBans")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An orphan may have been relayed in good faith.
+	if cst.relayBlock(types.Block{}) != ErrOrphan {
+		t.Fatal("expected ErrOrphan")
+	}
+	if len(cst.gateway.Bans()) != 0 {
+		t.Fatal("peer was banned for relaying an orphan")
+	}
+
+	// A block that spends more than its inputs is invalid.
+	dosBlock, err := cst.MineDoSBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cst.relayBlock(dosBlock) != ErrSiacoinInputOutputMismatch {
+		t.Fatal("expected ErrSiacoinInputOutputMismatch")
+	}
+	if len(cst.gateway.Bans()) != 1 {
+		t.Error("peer was not banned for relaying an invalid block")
+	}
+}
@@ -50,7 +50,7 @@ func TestComplexForking(t *testing.T) {
 
 	// Create gateway. For this test, we can use the same gateway in all
 	// States without causing problems.
-	g, err := gateway.New(":0", build.TempDir("consensus", "TestComplexForking", "gateway"))
+	g, err := gateway.New(":0", build.TempDir("consensus", "TestComplexForking", "gateway"), false)
 	if err != nil {
 		t.Fatal(err)
 	}
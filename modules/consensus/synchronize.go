@@ -68,7 +68,9 @@ func (s *State) receiveBlocks(conn modules.PeerConn) error {
 			if acceptErr == modules.ErrNonExtendingBlock || acceptErr == ErrBlockKnown {
 				acceptErr = nil
 			}
-			if acceptErr != nil {
+			if _, invalid := invalidBlockErrs[acceptErr]; invalid {
+				return modules.PeerViolation{Err: acceptErr}
+			} else if acceptErr != nil {
 				return acceptErr
 			}
 		}
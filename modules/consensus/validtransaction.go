@@ -10,6 +10,7 @@ import (
 )
 
 var (
+	ErrIncorrectRevisionPayout            = errors.New("contract revision has incorrect payouts")
 	ErrInvalidStorageProof                = errors.New("provided storage proof is invalid")
 	ErrLowRevisionNumber                  = errors.New("transaction has a file contract with an outdated revision number")
 	ErrMissingSiacoinOutput               = errors.New("transaction spends a nonexisting siacoin output")
@@ -135,7 +136,7 @@ func (cs *State) validFileContractRevisions(t types.Transaction) (err error) {
 		}
 
 		// Check that the payout of the revision matches the payout of the
-		// original.
+		// original. After the hardfork, the siafund fee is excluded.
 		//
 		// txn.StandaloneValid checks for the validity of the
 		// ValidProofOutputs.
@@ -143,8 +144,8 @@ func (cs *State) validFileContractRevisions(t types.Transaction) (err error) {
 		for _, output := range fcr.NewMissedProofOutputs {
 			payout = payout.Add(output.Value)
 		}
-		if payout.Cmp(fc.Payout) != 0 {
-			return errors.New("contract revision has incorrect payouts")
+		if payout.Cmp(fc.RevisionPayout(cs.height())) != 0 {
+			return ErrIncorrectRevisionPayout
 		}
 	}
 
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"crypto/rand"
+	"path/filepath"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -202,3 +206,71 @@ func TestValidFileContractRevisions(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// TestRevisionPayoutHardfork checks that revision payouts are compared to the
+// full contract payout before RevisionPayoutHardforkHeight, and to the payout
+// after the siafund fee from then on.
+func TestRevisionPayoutHardfork(t *testing.T) {
+	// A consensus set that has not mined any blocks is before the hardfork.
+	testdir := build.TempDir(modules.ConsensusDir, "TestRevisionPayoutHardfork")
+	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cs, err := New(g, filepath.Join(testdir, modules.ConsensusDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.height() >= types.RevisionPayoutHardforkHeight {
+		t.Fatal("new consensus set is past the hardfork")
+	}
+
+	// Create a file contract that paid a siafund fee.
+	var fcid types.FileContractID
+	fcid[0] = 13
+	fc := types.FileContract{
+		WindowStart: 100,
+		WindowEnd:   200,
+		Payout:      types.NewCurrency64(1e6),
+		UnlockHash:  types.UnlockConditions{}.UnlockHash(),
+	}
+	if fc.Tax().IsZero() {
+		t.Fatal("contract should pay a siafund fee")
+	}
+	revision := func(payout types.Currency) types.Transaction {
+		return types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:              fcid,
+				NewRevisionNumber:     1,
+				NewMissedProofOutputs: []types.SiacoinOutput{{Value: payout}},
+			}},
+		}
+	}
+	fullPayout := revision(fc.Payout)
+	taxedPayout := revision(fc.Payout.Sub(fc.Tax()))
+
+	cs.fileContracts[fcid] = fc
+	if err := cs.validFileContractRevisions(fullPayout); err != nil {
+		t.Error("full payout should be valid before the hardfork:", err)
+	}
+	if err := cs.validFileContractRevisions(taxedPayout); err != ErrIncorrectRevisionPayout {
+		t.Error("payout after the siafund fee should be invalid before the hardfork:", err)
+	}
+
+	// The consensus set tester is past the hardfork.
+	cst, err := createConsensusSetTester("TestRevisionPayoutHardfork - After")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cst.cs.height() < types.RevisionPayoutHardforkHeight {
+		t.Fatal("consensus set tester is not past the hardfork")
+	}
+	cst.cs.fileContracts[fcid] = fc
+	if err := cst.cs.validFileContractRevisions(taxedPayout); err != nil {
+		t.Error("payout after the siafund fee should be valid after the hardfork:", err)
+	}
+	if err := cst.cs.validFileContractRevisions(fullPayout); err != ErrIncorrectRevisionPayout {
+		t.Error("full payout should be invalid after the hardfork:", err)
+	}
+}
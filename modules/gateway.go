@@ -1,16 +1,28 @@
 package modules
 
 import (
+	"errors"
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 )
 
 const (
 	GatewayDir = "gateway"
+
+	// MisbehaviorBanDuration is how long a peer is banned for when it is
+	// banned automatically, for example for relaying an invalid block.
+	MisbehaviorBanDuration = 24 * time.Hour
+
+	// FeatureEncryption is advertised by gateways that support the encrypted
+	// transport. Connections between two such gateways are encrypted, and
+	// the peers are identified by their node keys.
+	FeatureEncryption = "encrypt"
 )
 
 // TODO: Move this and it's functionality into the gateway package.
@@ -34,6 +46,54 @@ type PeerConn interface {
 // keeping the connection open after all necessary I/O has been performed.
 type RPCFunc func(PeerConn) error
 
+// A PeerViolation is returned by an RPCFunc when the peer broke the protocol,
+// for example by sending an invalid block. The Gateway only gives a strike to
+// peers whose RPCs fail with a PeerViolation; peers hanging up and local
+// errors are not held against them.
+type PeerViolation struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (pv PeerViolation) Error() string {
+	return pv.Err.Error()
+}
+
+// A PeerBan prevents the Gateway from connecting to an address, and from
+// accepting connections from it, until the ban expires. Bans cover every port
+// of the banned host, except on loopback addresses, where several nodes may be
+// running on the same machine.
+type PeerBan struct {
+	Address NetAddress // The banned host, or host and port for loopback addresses.
+	Expiry  time.Time
+	Reason  string
+}
+
+// PeerInfo describes a peer and what it told the Gateway about itself during
+// the handshake. Peers running versions that predate the handshake advertise
+// no features and no address. NodeKey is only set if the connection is
+// encrypted, as other peers cannot prove their identity.
+type PeerInfo struct {
+	Address    NetAddress // The address that the Gateway knows the peer by.
+	Inbound    bool
+	Version    string
+	Features   []string
+	NetAddress NetAddress // The address that the peer claims to be listening on.
+	Encrypted  bool
+	NodeKey    crypto.PublicKey
+}
+
+// HasFeature returns true if the peer advertised 'feature' during the
+// handshake.
+func (pi PeerInfo) HasFeature(feature string) bool {
+	for _, f := range pi.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
 // A NetAddress contains the information needed to contact a peer.
 type NetAddress string
 
@@ -67,6 +127,22 @@ type Gateway interface {
 	// Peers returns the addresses that the Gateway is currently connected to.
 	Peers() []NetAddress
 
+	// Peer returns what the peer at 'addr' told the Gateway about itself
+	// during the handshake, so that callers can check which features it
+	// supports. If the Gateway is not connected to 'addr', false is
+	// returned.
+	Peer(addr NetAddress) (PeerInfo, bool)
+
+	// Ban disconnects from any peers at 'addr' and refuses connections to
+	// and from it for 'duration'.
+	Ban(addr NetAddress, duration time.Duration, reason string) error
+
+	// Unban lifts the ban on 'addr'.
+	Unban(addr NetAddress) error
+
+	// Bans returns the bans that have not yet expired.
+	Bans() []PeerBan
+
 	// RegisterRPC registers a function to handle incoming connections that
 	// supply the given RPC ID.
 	RegisterRPC(string, RPCFunc)
@@ -87,25 +163,41 @@ type Gateway interface {
 	Close() error
 }
 
-// ExternalIP is the external IP of the computer running this code. It is
-// defined here to facilitate reuse, instead of requiring each module to make
-// an HTTP call. During testing, the loopback address is returned.
-var ExternalIP = func() string {
+// LookupExternalIP asks an external service for the external IP of the
+// computer running this code. During testing, the loopback address is
+// returned.
+func LookupExternalIP() (string, error) {
 	if build.Release == "testing" {
-		return "::1"
+		return "::1", nil
 	}
 
 	// timeout after 3 seconds
 	client := http.Client{Timeout: time.Duration(3 * time.Second)}
 	resp, err := client.Get("http://myexternalip.com/raw")
 	if err != nil {
-		return "::1"
+		return "", err
 	}
 	defer resp.Body.Close()
 	buf := make([]byte, 64)
 	n, err := resp.Body.Read(buf)
 	if err != nil && err != io.EOF {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(buf[:n]))
+	if net.ParseIP(ip) == nil {
+		return "", errors.New("external IP service returned an invalid address")
+	}
+	return ip, nil
+}
+
+// ExternalIP is the external IP of the computer running this code when it
+// was started. It is defined here to facilitate reuse, instead of requiring
+// each module to make an HTTP call. If the external IP cannot be determined,
+// the loopback address is used.
+var ExternalIP = func() string {
+	ip, err := LookupExternalIP()
+	if err != nil {
 		return "::1"
 	}
-	return string(buf[:n-1]) // trim newline
+	return ip
 }()
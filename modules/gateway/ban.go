@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	errBanned         = errors.New("address is banned")
+	errBadBanDuration = errors.New("ban duration must be positive")
+	errNotBanned      = errors.New("address is not banned")
+)
+
+// banKey returns the address that a ban on 'addr' is stored under. Bans cover
+// every port of a host, except on loopback addresses, where several nodes may
+// be running on the same machine. An address without a port is treated as a
+// host.
+func banKey(addr modules.NetAddress) modules.NetAddress {
+	host := addr.Host()
+	if host == "" {
+		return addr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return addr
+	}
+	return modules.NetAddress(host)
+}
+
+// isBanned returns true if 'addr' is covered by a ban that has not expired,
+// either on the address itself or on its host. isBanned is called with the
+// lock held.
+func (g *Gateway) isBanned(addr modules.NetAddress) bool {
+	now := time.Now()
+	for _, key := range []modules.NetAddress{addr, modules.NetAddress(addr.Host())} {
+		if ban, exists := g.bans[key]; exists && ban.Expiry.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ban disconnects from any peers at 'addr' and refuses connections to and from
+// it for 'duration'. Banned addresses are also removed from the node list.
+func (g *Gateway) Ban(addr modules.NetAddress, duration time.Duration, reason string) error {
+	if duration <= 0 {
+		return errBadBanDuration
+	}
+
+	id := g.mu.Lock()
+	key := banKey(addr)
+	ban := modules.PeerBan{
+		Address: key,
+		Expiry:  time.Now().Add(duration),
+		Reason:  reason,
+	}
+	g.bans[key] = ban
+	var banned []*peer
+	for key, p := range g.peers {
+		if g.isBanned(p.addr) {
+			banned = append(banned, p)
+			delete(g.peers, key)
+		}
+	}
+	for node := range g.nodes {
+		if g.isBanned(node) {
+			delete(g.nodes, node)
+		}
+	}
+	err := g.saveBans()
+	if err == nil {
+		err = g.save()
+	}
+	g.mu.Unlock(id)
+
+	for _, p := range banned {
+		p.sess.Close()
+		g.log.Println("INFO: disconnected from banned peer", p.addr)
+	}
+	g.log.Printf("INFO: banned %v until %v: %v", key, ban.Expiry, reason)
+	return err
+}
+
+// Unban lifts the ban on 'addr'.
+func (g *Gateway) Unban(addr modules.NetAddress) error {
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	key := banKey(addr)
+	if _, exists := g.bans[key]; !exists {
+		return errNotBanned
+	}
+	delete(g.bans, key)
+	g.log.Println("INFO: unbanned", key)
+	return g.saveBans()
+}
+
+// Bans returns the bans that have not yet expired. Expired bans are discarded.
+func (g *Gateway) Bans() []modules.PeerBan {
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	var bans []modules.PeerBan
+	now := time.Now()
+	for key, ban := range g.bans {
+		if !ban.Expiry.After(now) {
+			delete(g.bans, key)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	return bans
+}
@@ -0,0 +1,171 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+func TestBanKey(t *testing.T) {
+	cases := map[modules.NetAddress]modules.NetAddress{
+		"1.2.3.4:9981":     "1.2.3.4",
+		"1.2.3.4":          "1.2.3.4",
+		"foo.com:9981":     "foo.com",
+		"[::1]:9981":       "[::1]:9981",
+		"127.0.0.1:9981":   "127.0.0.1:9981",
+		"[2001:db8::1]:99": "2001:db8::1",
+	}
+	for addr, key := range cases {
+		if banKey(addr) != key {
+			t.Errorf("banKey(%v): expected %v, got %v", addr, key, banKey(addr))
+		}
+	}
+}
+
+// TestBan checks that banning a peer disconnects from it and prevents
+// reconnecting until the ban is lifted.
+func TestBan(t *testing.T) {
+	g1 := newTestingGateway("TestBan1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestBan2", t)
+	defer g2.Close()
+
+	if err := g1.Ban(g2.Address(), 0, ""); err != errBadBanDuration {
+		t.Fatal("expected errBadBanDuration, got", err)
+	}
+	if err := g1.Unban(g2.Address()); err != errNotBanned {
+		t.Fatal("expected errNotBanned, got", err)
+	}
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	err = g1.Ban(g2.Address(), time.Hour, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g1.Peers()) != 0 {
+		t.Fatal("banned peer is still connected")
+	}
+	if bans := g1.Bans(); len(bans) != 1 || bans[0].Address != g2.Address() || bans[0].Reason != "test" {
+		t.Fatal("wrong ban list:", bans)
+	}
+	if err := g1.Connect(g2.Address()); err != errBanned {
+		t.Fatal("expected errBanned, got", err)
+	}
+
+	// The ban should be loaded by a new gateway.
+	g3, err := New(":0", g1.persistDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g3.Close()
+	if len(g3.Bans()) != 1 {
+		t.Fatal("ban list was not loaded")
+	}
+
+	err = g1.Unban(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal("could not reconnect after unbanning:", err)
+	}
+}
+
+// TestBanExpiry checks that expired bans are ignored.
+func TestBanExpiry(t *testing.T) {
+	g := newTestingGateway("TestBanExpiry", t)
+	defer g.Close()
+
+	err := g.Ban("1.2.3.4:9981", time.Millisecond, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	id := g.mu.RLock()
+	banned := g.isBanned("1.2.3.4:5555")
+	g.mu.RUnlock(id)
+	if banned {
+		t.Error("expired ban is still in effect")
+	}
+	if len(g.Bans()) != 0 {
+		t.Error("expired ban was listed")
+	}
+}
+
+// TestBanInbound checks that connections from banned addresses are refused.
+func TestBanInbound(t *testing.T) {
+	g := newTestingGateway("TestBanInbound", t)
+	defer g.Close()
+
+	// Find a free port to dial from, and ban it.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := l.Addr().(*net.TCPAddr)
+	l.Close()
+	err = g.Ban(modules.NetAddress(local.String()), time.Hour, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The gateway should close the connection instead of waiting for our
+	// version.
+	dialer := net.Dialer{LocalAddr: local, Timeout: dialTimeout}
+	conn, err := dialer.Dial("tcp", net.JoinHostPort("127.0.0.1", g.Address().Port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("expected banned connection to be closed, got", err)
+	}
+}
+
+// TestStrikeBan checks that a peer is banned once too many of the RPCs called
+// on it fail because it broke the protocol, and that other failures and
+// successful RPCs do not count against it.
+func TestStrikeBan(t *testing.T) {
+	g1 := newTestingGateway("TestStrikeBan1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestStrikeBan2", t)
+	defer g2.Close()
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	fail := func(modules.PeerConn) error { return errors.New("failed") }
+	violate := func(modules.PeerConn) error { return modules.PeerViolation{Err: errors.New("violated")} }
+	succeed := func(modules.PeerConn) error { return nil }
+
+	// Ordinary failures are not strikes, and successes take strikes away.
+	for i := 0; i < 2*maxStrikes; i++ {
+		g1.RPC(g2.Address(), "Foo", fail)
+	}
+	for i := 0; i < 2*maxStrikes; i++ {
+		g1.RPC(g2.Address(), "Foo", violate)
+		g1.RPC(g2.Address(), "Foo", succeed)
+	}
+	if len(g1.Peers()) != 1 || len(g1.Bans()) != 0 {
+		t.Fatal("peer was banned without repeated protocol violations")
+	}
+
+	for i := 0; i < maxStrikes; i++ {
+		g1.RPC(g2.Address(), "Foo", violate)
+	}
+	if len(g1.Peers()) != 0 {
+		t.Fatal("peer was not disconnected after too many strikes")
+	}
+	if bans := g1.Bans(); len(bans) != 1 || bans[0].Address != g2.Address() {
+		t.Fatal("peer was not banned after too many strikes:", bans)
+	}
+}
@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"crypto/cipher"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// If both peers advertise modules.FeatureEncryption in their handshakes, the
+// handshake is followed by an ephemeral key exchange, the dialing peer going
+// first. Each direction of the connection is then encrypted with its own key
+// derived from the shared secret. Finally, each peer proves its identity over
+// the encrypted connection by signing both ephemeral keys and both handshakes
+// with its node key, so that an attacker who swaps the ephemeral keys cannot
+// impersonate either side, and an attacker who changes the features in a
+// handshake is detected. An attacker can still strip the encryption feature
+// from both handshakes, leaving nothing to sign; Gateways that require
+// encryption refuse such connections.
+
+const (
+	// maxFrameLen is the largest amount of plaintext that is sent in a single
+	// frame of an encrypted connection.
+	maxFrameLen = 1 << 16
+
+	// maxProofLen is the largest identity proof that will be read from a peer.
+	maxProofLen = 256
+)
+
+var (
+	errBadFrame           = errors.New("could not decrypt frame")
+	errBadIdentity        = errors.New("peer could not prove its identity")
+	errEncryptionRequired = errors.New("peer does not support encryption")
+)
+
+// An identityProof binds a peer's node key to an encrypted connection.
+type identityProof struct {
+	NodeKey   crypto.PublicKey
+	Signature crypto.Signature
+}
+
+// An encryptedConn is a net.Conn that encrypts and authenticates everything
+// written to it. Data is sent in length-prefixed frames, each sealed with
+// Twofish-GCM under a counter nonce.
+type encryptedConn struct {
+	net.Conn
+
+	readMu    sync.Mutex
+	readAEAD  cipher.AEAD
+	readCount uint64
+	readBuf   []byte
+
+	writeMu    sync.Mutex
+	writeAEAD  cipher.AEAD
+	writeCount uint64
+}
+
+// newEncryptedConn wraps 'conn', encrypting outgoing data with 'writeKey' and
+// decrypting incoming data with 'readKey'.
+func newEncryptedConn(conn net.Conn, readKey, writeKey crypto.TwofishKey) *encryptedConn {
+	// NOTE: NewGCM only returns an error if twofishCipher.BlockSize != 16.
+	readAEAD, _ := cipher.NewGCM(readKey.NewCipher())
+	writeAEAD, _ := cipher.NewGCM(writeKey.NewCipher())
+	return &encryptedConn{
+		Conn:      conn,
+		readAEAD:  readAEAD,
+		writeAEAD: writeAEAD,
+	}
+}
+
+// frameNonce returns the nonce for the frame numbered 'count'. Each direction
+// uses its own key, so the counters of both directions can start at zero.
+func frameNonce(aead cipher.AEAD, count uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, encoding.EncUint64(count))
+	return nonce
+}
+
+// Read decrypts the next frame from the connection if there is no data left
+// over from the previous one.
+func (c *encryptedConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if len(c.readBuf) == 0 {
+		frame, err := encoding.ReadPrefix(c.Conn, maxFrameLen+uint64(c.readAEAD.Overhead()))
+		if err != nil {
+			return 0, err
+		}
+		plaintext, err := c.readAEAD.Open(frame[:0], frameNonce(c.readAEAD, c.readCount), frame, nil)
+		if err != nil {
+			return 0, errBadFrame
+		}
+		c.readCount++
+		c.readBuf = plaintext
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write encrypts 'b' and sends it over the connection, splitting it into
+// frames of at most maxFrameLen bytes.
+func (c *encryptedConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	var n int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxFrameLen {
+			chunk = chunk[:maxFrameLen]
+		}
+		frame := c.writeAEAD.Seal(nil, frameNonce(c.writeAEAD, c.writeCount), chunk, nil)
+		if err := encoding.WritePrefix(c.Conn, frame); err != nil {
+			return n, err
+		}
+		c.writeCount++
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+	return n, nil
+}
+
+// shouldEncrypt returns true if both the Gateway and the peer that sent
+// 'remote' advertise the encrypted transport.
+func (g *Gateway) shouldEncrypt(remote handshake) bool {
+	return g.localHandshake().hasFeature(modules.FeatureEncryption) && remote.hasFeature(modules.FeatureEncryption)
+}
+
+// encryptionRequired returns true if the Gateway refuses peers that do not
+// encrypt their connections.
+func (g *Gateway) encryptionRequired() bool {
+	id := g.mu.RLock()
+	defer g.mu.RUnlock(id)
+	return g.requireEncryption
+}
+
+// encrypt performs the key exchange on 'conn' and returns the encrypted
+// connection along with the node key of the peer. 'dialer' is true if the
+// Gateway opened the connection. 'local' and 'remote' are the handshakes sent
+// and received by the Gateway, which are covered by the identity proofs.
+func (g *Gateway) encrypt(conn net.Conn, dialer bool, local, remote handshake) (*encryptedConn, crypto.PublicKey, error) {
+	// exchange ephemeral keys
+	sk, pk, err := crypto.GenerateX25519Keys()
+	if err != nil {
+		return nil, crypto.PublicKey{}, err
+	}
+	var remotePK crypto.X25519PublicKey
+	if dialer {
+		err = encoding.WriteObject(conn, pk)
+		if err == nil {
+			err = encoding.ReadObject(conn, &remotePK, crypto.X25519KeySize)
+		}
+	} else {
+		err = encoding.ReadObject(conn, &remotePK, crypto.X25519KeySize)
+		if err == nil {
+			err = encoding.WriteObject(conn, pk)
+		}
+	}
+	if err != nil {
+		return nil, crypto.PublicKey{}, err
+	}
+
+	// derive a key for each direction
+	secret := crypto.DeriveSharedSecret(sk, remotePK)
+	dialerKey := crypto.TwofishKey(crypto.HashAll(secret, "dialer"))
+	listenerKey := crypto.TwofishKey(crypto.HashAll(secret, "listener"))
+	var econn *encryptedConn
+	if dialer {
+		econn = newEncryptedConn(conn, listenerKey, dialerKey)
+	} else {
+		econn = newEncryptedConn(conn, dialerKey, listenerKey)
+	}
+
+	// exchange identity proofs
+	sig, err := crypto.SignHash(crypto.HashAll(networkID, pk, remotePK, local, remote), g.secretKey)
+	if err != nil {
+		return nil, crypto.PublicKey{}, err
+	}
+	proof := identityProof{NodeKey: g.publicKey, Signature: sig}
+	var remoteProof identityProof
+	if dialer {
+		err = encoding.WriteObject(econn, proof)
+		if err == nil {
+			err = encoding.ReadObject(econn, &remoteProof, maxProofLen)
+		}
+	} else {
+		err = encoding.ReadObject(econn, &remoteProof, maxProofLen)
+		if err == nil {
+			err = encoding.WriteObject(econn, proof)
+		}
+	}
+	if err != nil {
+		return nil, crypto.PublicKey{}, err
+	}
+	if crypto.VerifyHash(crypto.HashAll(networkID, remotePK, pk, remote, local), remoteProof.NodeKey, remoteProof.Signature) != nil {
+		return nil, crypto.PublicKey{}, errBadIdentity
+	}
+	return econn, remoteProof.NodeKey, nil
+}
@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestEncryptedConn checks that data written to one end of an encrypted
+// connection can be read from the other, and that tampered frames are
+// rejected.
+func TestEncryptedConn(t *testing.T) {
+	key1, _ := crypto.GenerateTwofishKey()
+	key2, _ := crypto.GenerateTwofishKey()
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	e1 := newEncryptedConn(c1, key2, key1)
+	e2 := newEncryptedConn(c2, key1, key2)
+
+	// data larger than a frame should be split and reassembled
+	data := make([]byte, 2*maxFrameLen+10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	go e1.Write(data)
+	received := make([]byte, len(data))
+	if _, err := io.ReadFull(e2, received); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, received) {
+		t.Fatal("received data does not match sent data")
+	}
+
+	// a modified frame should not be accepted
+	go func() {
+		e1.writeMu.Lock()
+		defer e1.writeMu.Unlock()
+		frame := e1.writeAEAD.Seal(nil, frameNonce(e1.writeAEAD, e1.writeCount), []byte("foo"), nil)
+		frame[0] ^= 1
+		encoding.WritePrefix(c1, frame)
+	}()
+	if _, err := e2.Read(received); err != errBadFrame {
+		t.Fatal("expected errBadFrame, got", err)
+	}
+}
+
+// TestEncryptedPeers checks that gateways encrypt their connections and track
+// each other by node key.
+func TestEncryptedPeers(t *testing.T) {
+	g1 := newTestingGateway("TestEncryptedPeers1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestEncryptedPeers2", t)
+	defer g2.Close()
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	info, _ := g1.Peer(g2.Address())
+	if !info.Encrypted || info.NodeKey != g2.publicKey {
+		t.Fatal("connection was not encrypted and authenticated:", info)
+	}
+	id := g2.mu.RLock()
+	p, exists := g2.peers[g1.publicKey]
+	g2.mu.RUnlock(id)
+	if !exists || !p.encrypted {
+		t.Fatal("g2 does not know g1 by its node key")
+	}
+
+	// g2 is already connected to g1, so connecting in the other direction
+	// should be refused, even though the address is different.
+	if err := g2.Connect(g1.Address()); err != errPeerExists {
+		t.Error("expected errPeerExists, got", err)
+	}
+
+	// connecting to ourselves under a different address should be refused
+	self := modules.NetAddress(net.JoinHostPort("127.0.0.1", g1.Address().Port()))
+	if err := g1.Connect(self); err != errOurNodeKey {
+		t.Error("expected errOurNodeKey, got", err)
+	}
+
+	// the node key should persist
+	g3, err := New(":0", g1.persistDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g3.Close()
+	if g3.publicKey != g1.publicKey {
+		t.Error("node key was not loaded")
+	}
+}
+
+// TestBadIdentity checks that a peer cannot claim a node key that it does not
+// hold.
+func TestBadIdentity(t *testing.T) {
+	g1 := newTestingGateway("TestBadIdentity1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestBadIdentity2", t)
+	defer g2.Close()
+	g2.publicKey = g1.publicKey
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	h1, h2 := g1.localHandshake(), g2.localHandshake()
+	go g2.encrypt(c2, false, h2, h1)
+	if _, _, err := g1.encrypt(c1, true, h1, h2); err != errBadIdentity {
+		t.Fatal("expected errBadIdentity, got", err)
+	}
+}
+
+// TestTamperedHandshake checks that the identity proofs detect a handshake
+// that was changed in transit.
+func TestTamperedHandshake(t *testing.T) {
+	g1 := newTestingGateway("TestTamperedHandshake1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestTamperedHandshake2", t)
+	defer g2.Close()
+
+	// g2 receives g1's handshake without one of its features.
+	h1, h2 := g1.localHandshake(), g2.localHandshake()
+	h1.Features = append(h1.Features, "foo")
+	tampered := h1
+	tampered.Features = tampered.Features[:len(tampered.Features)-1]
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	go g2.encrypt(c2, false, h2, tampered)
+	if _, _, err := g1.encrypt(c1, true, h1, h2); err != errBadIdentity {
+		t.Fatal("expected errBadIdentity, got", err)
+	}
+}
+
+// TestIdentityPermissions checks that the node key can only be read by its
+// owner.
+func TestIdentityPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not enforced on windows")
+	}
+	g := newTestingGateway("TestIdentityPermissions", t)
+	defer g.Close()
+	info, err := os.Stat(filepath.Join(g.persistDir, "identity.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Error("identity file has the wrong permissions:", info.Mode().Perm())
+	}
+}
+
+// TestUnencryptedPeers checks that gateways fall back to plain connections
+// when one side does not support encryption.
+func TestUnencryptedPeers(t *testing.T) {
+	g1 := newTestingGateway("TestUnencryptedPeers1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestUnencryptedPeers2", t)
+	defer g2.Close()
+
+	id := g2.mu.Lock()
+	g2.features = nil
+	g2.mu.Unlock(id)
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+	info, _ := g1.Peer(g2.Address())
+	if info.Encrypted || info.NodeKey != (crypto.PublicKey{}) {
+		t.Error("connection should not be encrypted:", info)
+	}
+	if err := g1.RPC(g2.Address(), "ShareNodes", g1.requestNodes); err != nil {
+		t.Error("RPC over plain connection failed:", err)
+	}
+}
+
+// TestRequireEncryption checks that a gateway that requires encryption refuses
+// peers that do not support it.
+func TestRequireEncryption(t *testing.T) {
+	g1, err := New(":0", build.TempDir("gateway", "TestRequireEncryption1"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g1.Close()
+	g2 := newTestingGateway("TestRequireEncryption2", t)
+	defer g2.Close()
+
+	id := g2.mu.Lock()
+	g2.features = nil
+	g2.mu.Unlock(id)
+	if err = g1.Connect(g2.Address()); err != errEncryptionRequired {
+		t.Fatal("expected errEncryptionRequired, got", err)
+	}
+	if len(g1.Peers()) != 0 {
+		t.Error("unencrypted peer was added")
+	}
+
+	// Peers that support encryption are still accepted.
+	id = g2.mu.Lock()
+	g2.features = []string{modules.FeatureEncryption}
+	g2.mu.Unlock(id)
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,13 +6,14 @@ import (
 	"net"
 	"os"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/sync"
 )
 
 const (
 	// maxStrikes is the number of "strikes" that can be incurred by a peer
-	// before it will be removed.
+	// before it will be banned.
 	// TODO: need a way to whitelist peers (e.g. hosts)
 	maxStrikes = 5
 )
@@ -32,14 +33,30 @@ type Gateway struct {
 	// initRPCs are the RPCs that the Gateway calls upon connecting to a peer.
 	initRPCs map[string]modules.RPCFunc
 
-	// peers are the nodes we are currently connected to.
-	peers map[modules.NetAddress]*peer
+	// peers are the nodes we are currently connected to, keyed by node key.
+	// Peers that cannot prove their identity are keyed by addrKey.
+	peers map[crypto.PublicKey]*peer
 
 	// nodes is a list of all known nodes (i.e. potential peers) on the
 	// network.
 	// TODO: map to a timestamp?
 	nodes map[modules.NetAddress]struct{}
 
+	// features are the optional capabilities that the Gateway advertises to
+	// its peers during the handshake. If requireEncryption is set, peers
+	// that do not encrypt their connections are refused.
+	features          []string
+	requireEncryption bool
+
+	// secretKey and publicKey identify the Gateway to peers over encrypted
+	// connections. They are set by New and never change.
+	secretKey crypto.SecretKey
+	publicKey crypto.PublicKey
+
+	// bans are the addresses that the Gateway will not connect to or accept
+	// connections from, keyed by banKey.
+	bans map[modules.NetAddress]modules.PeerBan
+
 	persistDir string
 	log        *log.Logger
 	mu         *sync.RWMutex
@@ -63,8 +80,10 @@ func (g *Gateway) Close() error {
 	return g.listener.Close()
 }
 
-// New returns an initialized Gateway.
-func New(addr string, persistDir string) (g *Gateway, err error) {
+// New returns an initialized Gateway. If 'requireEncryption' is true, the
+// Gateway refuses to connect to peers, including peers running older
+// versions, that do not encrypt their connections.
+func New(addr string, persistDir string, requireEncryption bool) (g *Gateway, err error) {
 	// Create the directory if it doesn't exist.
 	err = os.MkdirAll(persistDir, 0700)
 	if err != nil {
@@ -80,11 +99,15 @@ func New(addr string, persistDir string) (g *Gateway, err error) {
 	g = &Gateway{
 		handlers:   make(map[rpcID]modules.RPCFunc),
 		initRPCs:   make(map[string]modules.RPCFunc),
-		peers:      make(map[modules.NetAddress]*peer),
+		peers:      make(map[crypto.PublicKey]*peer),
 		nodes:      make(map[modules.NetAddress]struct{}),
+		features:   []string{modules.FeatureEncryption},
+		bans:       make(map[modules.NetAddress]modules.PeerBan),
 		persistDir: persistDir,
 		mu:         sync.New(modules.SafeMutexDelay, 2),
 		log:        logger,
+
+		requireEncryption: requireEncryption,
 	}
 
 	// Register RPCs.
@@ -95,6 +118,12 @@ func New(addr string, persistDir string) (g *Gateway, err error) {
 
 	g.log.Println("INFO: gateway created, started logging")
 
+	// Load or create the node key.
+	err = g.loadIdentity()
+	if err != nil {
+		return
+	}
+
 	// Create listener and set address.
 	g.listener, err = net.Listen("tcp", addr)
 	if err != nil {
@@ -105,6 +134,12 @@ func New(addr string, persistDir string) (g *Gateway, err error) {
 
 	g.log.Println("INFO: our address is", g.myAddr)
 
+	// Load the ban list before listening, so that banned peers are refused
+	// from the start.
+	if loadErr := g.loadBans(); loadErr != nil && !os.IsNotExist(loadErr) {
+		return nil, loadErr
+	}
+
 	// Spawn the primary listener.
 	go g.listen()
 
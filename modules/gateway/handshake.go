@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"errors"
+	"net"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A connection begins with the dialing peer sending its protocol version and
+// the listening peer answering with its own, or with "reject". Peers that
+// speak handshakeVersion or later then exchange handshakes, the dialing peer
+// going first. Older peers go straight to the session, and are treated as
+// advertising no features.
+
+const (
+	// minVersion is the oldest protocol version that the gateway will connect
+	// to.
+	// NOTE: this version must be bumped whenever the gateway or consensus
+	// breaks compatibility.
+	minVersion = "0.3.3"
+
+	// handshakeVersion is the first protocol version that follows the
+	// version exchange with a handshake.
+	handshakeVersion = "0.4"
+
+	// protocolVersion is the protocol version spoken by this gateway.
+	protocolVersion = handshakeVersion
+
+	// maxHandshakeLen is the largest handshake that will be read from a peer.
+	maxHandshakeLen = 4096
+)
+
+var (
+	errPeerRejected = errors.New("peer rejected connection")
+	errWrongNetwork = errors.New("peer is on a different network")
+
+	// networkID identifies the network that the gateway belongs to. It is a
+	// hash of the genesis parameters, so that peers running a different
+	// release, such as a dev build, are not mixed with the main network.
+	networkID = crypto.HashAll(types.GenesisTimestamp, types.GenesisSiafundAllocation)
+)
+
+// A handshake is what a peer tells the gateway about itself when connecting.
+type handshake struct {
+	Version   string
+	NetworkID crypto.Hash
+	Features  []string
+	Address   modules.NetAddress // The address that the peer is listening on.
+}
+
+// hasFeature returns true if the handshake advertises 'feature'.
+func (h handshake) hasFeature(feature string) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// localHandshake returns the handshake that the gateway sends to its peers.
+func (g *Gateway) localHandshake() handshake {
+	id := g.mu.RLock()
+	defer g.mu.RUnlock(id)
+	return handshake{
+		Version:   protocolVersion,
+		NetworkID: networkID,
+		Features:  g.features,
+		Address:   g.myAddr,
+	}
+}
+
+// checkVersion returns an error if a peer's protocol version is too old.
+func checkVersion(version string) error {
+	if build.VersionCmp(version, minVersion) < 0 {
+		return errors.New("unacceptable version: " + version)
+	}
+	return nil
+}
+
+// connectHandshake performs the dialing side of the handshake on 'conn',
+// sending 'local', and returns the handshake of the peer.
+func (g *Gateway) connectHandshake(conn net.Conn, local handshake) (handshake, error) {
+	// exchange versions
+	if err := encoding.WriteObject(conn, protocolVersion); err != nil {
+		return handshake{}, err
+	}
+	var remoteVersion string
+	if err := encoding.ReadObject(conn, &remoteVersion, maxAddrLength); err != nil {
+		return handshake{}, err
+	} else if remoteVersion == "reject" {
+		return handshake{}, errPeerRejected
+	} else if err := checkVersion(remoteVersion); err != nil {
+		return handshake{}, err
+	}
+	// COMPATv0.3.3.3 - peers without handshakes.
+	if build.VersionCmp(remoteVersion, handshakeVersion) < 0 {
+		return handshake{Version: remoteVersion}, nil
+	}
+
+	// exchange handshakes
+	if err := encoding.WriteObject(conn, local); err != nil {
+		return handshake{}, err
+	}
+	var remote handshake
+	if err := encoding.ReadObject(conn, &remote, maxHandshakeLen); err != nil {
+		return handshake{}, err
+	}
+	if remote.NetworkID != networkID {
+		return handshake{}, errWrongNetwork
+	}
+	return remote, nil
+}
+
+// acceptHandshake performs the listening side of the handshake on 'conn',
+// sending 'local', and returns the handshake of the peer. Peers on a different
+// network are sent the gateway's handshake before being refused, so that they
+// learn why.
+func (g *Gateway) acceptHandshake(conn net.Conn, local handshake) (handshake, error) {
+	// exchange versions
+	var remoteVersion string
+	if err := encoding.ReadObject(conn, &remoteVersion, maxAddrLength); err != nil {
+		return handshake{}, err
+	}
+	if err := checkVersion(remoteVersion); err != nil {
+		encoding.WriteObject(conn, "reject")
+		return handshake{}, err
+	}
+	// COMPATv0.3.3.3 - peers without handshakes.
+	if build.VersionCmp(remoteVersion, handshakeVersion) < 0 {
+		// answer with the oldest version that the peer understands
+		return handshake{Version: remoteVersion}, encoding.WriteObject(conn, minVersion)
+	}
+	if err := encoding.WriteObject(conn, protocolVersion); err != nil {
+		return handshake{}, err
+	}
+
+	// exchange handshakes
+	var remote handshake
+	if err := encoding.ReadObject(conn, &remote, maxHandshakeLen); err != nil {
+		return handshake{}, err
+	}
+	if err := encoding.WriteObject(conn, local); err != nil {
+		return handshake{}, err
+	}
+	if remote.NetworkID != networkID {
+		return handshake{}, errWrongNetwork
+	}
+	return remote, nil
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+// TestHandshake checks that connecting gateways learn each other's version,
+// features, and claimed address.
+func TestHandshake(t *testing.T) {
+	g1 := newTestingGateway("TestHandshake1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestHandshake2", t)
+	defer g2.Close()
+
+	id := g1.mu.Lock()
+	g1.features = []string{"foo"}
+	g1.mu.Unlock(id)
+	id = g2.mu.Lock()
+	g2.features = []string{"bar"}
+	g2.mu.Unlock(id)
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+
+	// g1 should know about g2's features.
+	info, exists := g1.Peer(g2.Address())
+	if !exists {
+		t.Fatal("g1 has no record of g2")
+	}
+	if info.Inbound || info.Version != protocolVersion || info.NetAddress != g2.Address() {
+		t.Error("wrong peer info:", info)
+	}
+	if !info.HasFeature("bar") || info.HasFeature("foo") {
+		t.Error("wrong features:", info.Features)
+	}
+
+	// g2 should know about g1's features, under the address g1 dialed from.
+	id = g2.mu.RLock()
+	var inbound *peer
+	for _, p := range g2.peers {
+		inbound = p
+	}
+	g2.mu.RUnlock(id)
+	if inbound == nil {
+		t.Fatal("g2 did not add g1 as a peer")
+	}
+	info, _ = g2.Peer(inbound.addr)
+	if !info.Inbound || info.NetAddress != g1.Address() || !info.HasFeature("foo") {
+		t.Error("wrong inbound peer info:", info)
+	}
+
+	if _, exists := g1.Peer("foo.com:123"); exists {
+		t.Error("Peer returned info for an unknown address")
+	}
+}
+
+// TestLegacyHandshake checks that the gateway can connect to peers that do not
+// exchange handshakes.
+func TestLegacyHandshake(t *testing.T) {
+	g := newTestingGateway("TestLegacyHandshake", t)
+	defer g.Close()
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	go func() {
+		var version string
+		encoding.ReadObject(c2, &version, maxAddrLength)
+		encoding.WriteObject(c2, minVersion)
+	}()
+	remote, err := g.connectHandshake(c1, g.localHandshake())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.Version != minVersion || len(remote.Features) != 0 {
+		t.Error("wrong handshake for legacy peer:", remote)
+	}
+}
+
+// TestWrongNetwork checks that both sides of a connection refuse peers on a
+// different network.
+func TestWrongNetwork(t *testing.T) {
+	g := newTestingGateway("TestWrongNetwork", t)
+	defer g.Close()
+
+	other := handshake{
+		Version:   protocolVersion,
+		NetworkID: crypto.HashObject("other network"),
+	}
+
+	// connecting side
+	c1, c2 := net.Pipe()
+	go func() {
+		var version string
+		encoding.ReadObject(c2, &version, maxAddrLength)
+		encoding.WriteObject(c2, protocolVersion)
+		var remote handshake
+		encoding.ReadObject(c2, &remote, maxHandshakeLen)
+		encoding.WriteObject(c2, other)
+	}()
+	if _, err := g.connectHandshake(c1, g.localHandshake()); err != errWrongNetwork {
+		t.Error("expected errWrongNetwork, got", err)
+	}
+	c1.Close()
+	c2.Close()
+
+	// accepting side
+	c1, c2 = net.Pipe()
+	go func() {
+		encoding.WriteObject(c2, protocolVersion)
+		var version string
+		encoding.ReadObject(c2, &version, maxAddrLength)
+		encoding.WriteObject(c2, other)
+		var remote handshake
+		encoding.ReadObject(c2, &remote, maxHandshakeLen)
+	}()
+	if _, err := g.acceptHandshake(c1, g.localHandshake()); err != errWrongNetwork {
+		t.Error("expected errWrongNetwork, got", err)
+	}
+	c1.Close()
+	c2.Close()
+}
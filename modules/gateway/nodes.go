@@ -23,6 +23,8 @@ func (g *Gateway) addNode(addr modules.NetAddress) error {
 		return errors.New("address is not routable: " + string(addr))
 	} else if net.ParseIP(addr.Host()).IsLoopback() {
 		return errors.New("cannot add loopback address")
+	} else if g.isBanned(addr) {
+		return errBanned
 	}
 	g.nodes[addr] = struct{}{}
 	return nil
@@ -8,7 +8,7 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
-	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 
 	"github.com/inconshreveable/muxado"
@@ -22,11 +22,40 @@ const (
 	fullyConnectedThreshold = 128
 )
 
+var (
+	errOurNodeKey = errors.New("can't connect to ourselves")
+	errPeerExists = errors.New("peer already added")
+)
+
 type peer struct {
 	strikes uint32
 	addr    modules.NetAddress
 	sess    muxado.Session
 	inbound bool
+
+	// remote is what the peer told us about itself during the handshake.
+	remote handshake
+
+	// key is the node key of the peer if the connection is encrypted, and
+	// addrKey(addr) otherwise.
+	key       crypto.PublicKey
+	encrypted bool
+}
+
+// info returns the public description of a peer.
+func (p *peer) info() modules.PeerInfo {
+	info := modules.PeerInfo{
+		Address:    p.addr,
+		Inbound:    p.inbound,
+		Version:    p.remote.Version,
+		Features:   p.remote.Features,
+		NetAddress: p.remote.Address,
+		Encrypted:  p.encrypted,
+	}
+	if p.encrypted {
+		info.NodeKey = p.key
+	}
+	return info
 }
 
 func (p *peer) open() (modules.PeerConn, error) {
@@ -45,30 +74,55 @@ func (p *peer) accept() (modules.PeerConn, error) {
 	return &peerConn{conn}, nil
 }
 
+// addrKey returns the key that a peer at 'addr' is tracked under if it cannot
+// prove its identity. Such peers are identified by their address alone.
+func addrKey(addr modules.NetAddress) crypto.PublicKey {
+	return crypto.PublicKey(crypto.HashObject(addr))
+}
+
+// peerByAddr returns the peer that the Gateway knows by 'addr'. peerByAddr is
+// called with the lock held.
+func (g *Gateway) peerByAddr(addr modules.NetAddress) (*peer, bool) {
+	for _, p := range g.peers {
+		if p.addr == addr {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
 // addPeer adds a peer to the Gateway's peer list and spawns a listener thread
-// to handle its requests.
-func (g *Gateway) addPeer(p *peer) {
-	g.peers[p.addr] = p
+// to handle its requests. A peer is refused if it is the Gateway itself, or if
+// the Gateway is already connected to a peer with the same key. addPeer is
+// called with the lock held.
+func (g *Gateway) addPeer(p *peer) error {
+	if p.key == g.publicKey {
+		return errOurNodeKey
+	} else if _, exists := g.peers[p.key]; exists {
+		return errPeerExists
+	}
+	g.peers[p.key] = p
 	go g.listenPeer(p)
+	return nil
 }
 
 // randomInboundPeer returns a random peer that initiated its connection.
-func (g *Gateway) randomInboundPeer() modules.NetAddress {
+func (g *Gateway) randomInboundPeer() crypto.PublicKey {
 	if len(g.peers) > 0 {
 		r := rand.Intn(len(g.peers))
-		for addr, peer := range g.peers {
+		for key, peer := range g.peers {
 			// only select inbound peers
 			if !peer.inbound {
 				continue
 			}
 			if r == 0 {
-				return addr
+				return key
 			}
 			r--
 		}
 	}
 
-	return ""
+	return crypto.PublicKey{}
 }
 
 // listen handles incoming connection requests. If the connection is accepted,
@@ -89,11 +143,21 @@ func (g *Gateway) acceptConn(conn net.Conn) {
 	addr := modules.NetAddress(conn.RemoteAddr().String())
 	g.log.Printf("INFO: %v wants to connect", addr)
 
+	// refuse banned addresses
+	id := g.mu.RLock()
+	banned := g.isBanned(addr)
+	g.mu.RUnlock(id)
+	if banned {
+		conn.Close()
+		g.log.Printf("INFO: rejected connection from %v: address is banned", addr)
+		return
+	}
+
 	// don't connect to an IP address more than once
 	if build.Release != "testing" {
-		id := g.mu.RLock()
-		for p := range g.peers {
-			if p.Host() == addr.Host() {
+		id = g.mu.RLock()
+		for _, p := range g.peers {
+			if p.addr.Host() == addr.Host() {
 				g.mu.RUnlock(id)
 				conn.Close()
 				g.log.Printf("INFO: rejected connection from %v: already connected", addr)
@@ -103,50 +167,56 @@ func (g *Gateway) acceptConn(conn net.Conn) {
 		g.mu.RUnlock(id)
 	}
 
-	// read version
-	var remoteVersion string
-	if err := encoding.ReadObject(conn, &remoteVersion, maxAddrLength); err != nil {
-		conn.Close()
-		g.log.Printf("INFO: %v wanted to connect, but we could not read their version: %v", addr, err)
-		return
-	}
-
-	// decide whether to accept
-	// NOTE: this version must be bumped whenever the gateway or consensus
-	// breaks compatibility.
-	if build.VersionCmp(remoteVersion, "0.3.3") < 0 {
-		encoding.WriteObject(conn, "reject")
+	// exchange versions and handshakes
+	local := g.localHandshake()
+	remote, err := g.acceptHandshake(conn, local)
+	if err != nil {
 		conn.Close()
-		g.log.Printf("INFO: %v wanted to connect, but their version (%v) was unacceptable", addr, remoteVersion)
+		g.log.Printf("INFO: %v wanted to connect, but the handshake failed: %v", addr, err)
 		return
 	}
+	// TODO: connecting peer may disconnect at this point if they reject our
+	// handshake. This could be handled more gracefully.
 
-	// respond with our version
-	if err := encoding.WriteObject(conn, "0.3.3"); err != nil {
+	// encrypt the connection if both sides support it
+	p := &peer{addr: addr, inbound: true, remote: remote, key: addrKey(addr)}
+	if g.shouldEncrypt(remote) {
+		econn, key, err := g.encrypt(conn, false, local, remote)
+		if err != nil {
+			conn.Close()
+			g.log.Printf("INFO: %v wanted to connect, but the key exchange failed: %v", addr, err)
+			return
+		}
+		conn, p.key, p.encrypted = econn, key, true
+	} else if g.encryptionRequired() {
 		conn.Close()
-		g.log.Printf("INFO: could not write version ack to %v: %v", addr, err)
+		g.log.Printf("INFO: %v wanted to connect, but does not support encryption", addr)
 		return
 	}
-	// TODO: connecting peer may disconnect at this point if they reject our
-	// version. This could be handled more gracefully.
+	p.sess = muxado.Server(conn)
 
 	// If we are already fully connected, kick out an old inbound peer to make
 	// room for the new one. Among other things, this ensures that bootstrap
 	// nodes will always be connectible. Worst case, you'll connect, receive a
 	// node list, and immediately get booted. But once you have the node list
 	// you should be able to connect to less full peers.
-	id := g.mu.Lock()
+	id = g.mu.Lock()
 	if len(g.peers) >= fullyConnectedThreshold {
-		oldPeer := g.randomInboundPeer()
-		g.peers[oldPeer].sess.Close()
-		delete(g.peers, oldPeer)
-		g.log.Printf("INFO: disconnected from %v to make room for %v", oldPeer, addr)
+		oldPeer := g.peers[g.randomInboundPeer()]
+		oldPeer.sess.Close()
+		delete(g.peers, oldPeer.key)
+		g.log.Printf("INFO: disconnected from %v to make room for %v", oldPeer.addr, addr)
 	}
 	// add the peer
-	g.addPeer(&peer{addr: addr, sess: muxado.Server(conn), inbound: true})
+	err = g.addPeer(p)
 	g.mu.Unlock(id)
+	if err != nil {
+		p.sess.Close()
+		g.log.Printf("INFO: rejected connection from %v: %v", addr, err)
+		return
+	}
 
-	g.log.Printf("INFO: accepted connection from new peer %v (v%v)", addr, remoteVersion)
+	g.log.Printf("INFO: accepted connection from new peer %v (v%v)", addr, remote.Version)
 }
 
 // Connect establishes a persistent connection to a peer, and adds it to the
@@ -157,38 +227,51 @@ func (g *Gateway) Connect(addr modules.NetAddress) error {
 	}
 
 	id := g.mu.RLock()
-	_, exists := g.peers[addr]
+	_, exists := g.peerByAddr(addr)
+	banned := g.isBanned(addr)
 	g.mu.RUnlock(id)
 	if exists {
-		return errors.New("peer already added")
+		return errPeerExists
+	} else if banned {
+		return errBanned
 	}
 
 	conn, err := net.DialTimeout("tcp", string(addr), dialTimeout)
 	if err != nil {
 		return err
 	}
-	// send our version
-	if err := encoding.WriteObject(conn, "0.3.3"); err != nil {
-		return err
-	}
-	// read version ack
-	var remoteVersion string
-	if err := encoding.ReadObject(conn, &remoteVersion, maxAddrLength); err != nil {
+	// exchange versions and handshakes
+	local := g.localHandshake()
+	remote, err := g.connectHandshake(conn, local)
+	if err != nil {
+		conn.Close()
 		return err
-	} else if remoteVersion == "reject" {
-		return errors.New("peer rejected connection")
 	}
-	// decide whether to accept this version
-	if build.VersionCmp(remoteVersion, "0.3.3") < 0 {
+
+	// encrypt the connection if both sides support it
+	p := &peer{addr: addr, inbound: false, remote: remote, key: addrKey(addr)}
+	if g.shouldEncrypt(remote) {
+		econn, key, err := g.encrypt(conn, true, local, remote)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		conn, p.key, p.encrypted = econn, key, true
+	} else if g.encryptionRequired() {
 		conn.Close()
-		return errors.New("unacceptable version: " + remoteVersion)
+		return errEncryptionRequired
 	}
-
-	g.log.Println("INFO: connected to new peer", addr)
+	p.sess = muxado.Client(conn)
 
 	id = g.mu.Lock()
-	g.addPeer(&peer{addr: addr, sess: muxado.Client(conn), inbound: false})
+	err = g.addPeer(p)
 	g.mu.Unlock(id)
+	if err != nil {
+		p.sess.Close()
+		return err
+	}
+
+	g.log.Printf("INFO: connected to new peer %v (v%v)", addr, remote.Version)
 
 	// call initRPCs
 	id = g.mu.RLock()
@@ -211,14 +294,17 @@ func (g *Gateway) Connect(addr modules.NetAddress) error {
 // Gateway's peer list. The peer's address remains in the node list.
 func (g *Gateway) Disconnect(addr modules.NetAddress) error {
 	id := g.mu.RLock()
-	p, exists := g.peers[addr]
+	p, exists := g.peerByAddr(addr)
 	g.mu.RUnlock(id)
 	if !exists {
 		return errors.New("not connected to that node")
 	}
 	p.sess.Close()
 	id = g.mu.Lock()
-	delete(g.peers, addr)
+	// only remove the peer if it has not been replaced in the meantime
+	if g.peers[p.key] == p {
+		delete(g.peers, p.key)
+	}
 	g.mu.Unlock(id)
 
 	g.log.Println("INFO: disconnected from peer", addr)
@@ -255,8 +341,20 @@ func (g *Gateway) Peers() []modules.NetAddress {
 	id := g.mu.RLock()
 	defer g.mu.RUnlock(id)
 	var peers []modules.NetAddress
-	for addr := range g.peers {
-		peers = append(peers, addr)
+	for _, p := range g.peers {
+		peers = append(peers, p.addr)
 	}
 	return peers
 }
+
+// Peer returns what the peer at 'addr' told the Gateway about itself during
+// the handshake.
+func (g *Gateway) Peer(addr modules.NetAddress) (modules.PeerInfo, bool) {
+	id := g.mu.RLock()
+	defer g.mu.RUnlock(id)
+	p, exists := g.peerByAddr(addr)
+	if !exists {
+		return modules.PeerInfo{}, false
+	}
+	return p.info(), true
+}
@@ -18,7 +18,7 @@ func TestAddPeer(t *testing.T) {
 	defer g.Close()
 	id := g.mu.Lock()
 	defer g.mu.Unlock(id)
-	g.addPeer(&peer{addr: "foo", sess: muxado.Client(nil)})
+	g.addPeer(&peer{addr: "foo", sess: muxado.Client(nil), key: addrKey("foo")})
 	if len(g.peers) != 1 {
 		t.Fatal("gateway did not add peer")
 	}
@@ -70,7 +70,7 @@ func TestListen(t *testing.T) {
 	var ok bool
 	for !ok {
 		id := g.mu.RLock()
-		_, ok = g.peers[addr]
+		_, ok = g.peerByAddr(addr)
 		g.mu.RUnlock(id)
 	}
 
@@ -79,7 +79,7 @@ func TestListen(t *testing.T) {
 	// g should remove the peer
 	for ok {
 		id := g.mu.RLock()
-		_, ok = g.peers[addr]
+		_, ok = g.peerByAddr(addr)
 		g.mu.RUnlock(id)
 	}
 
@@ -188,7 +188,7 @@ func TestMakeOutboundConnections(t *testing.T) {
 	id := g1.mu.Lock()
 	for i := 0; i < 8; i++ {
 		peerAddr := modules.NetAddress("foo" + strconv.Itoa(i))
-		g1.peers[peerAddr] = &peer{addr: peerAddr, sess: nil}
+		g1.peers[addrKey(peerAddr)] = &peer{addr: peerAddr, sess: nil}
 	}
 	g1.mu.Unlock(id)
 
@@ -198,7 +198,7 @@ func TestMakeOutboundConnections(t *testing.T) {
 	// remove a peer while makeOutboundConnections is asleep, and add a new
 	// connectable address to the node list
 	id = g1.mu.Lock()
-	delete(g1.peers, "foo1")
+	delete(g1.peers, addrKey("foo1"))
 	g1.mu.Unlock(id)
 
 	g2 := newTestingGateway("TestMakeOutboundConnections2", t)
@@ -215,7 +215,7 @@ func TestMakeOutboundConnections(t *testing.T) {
 	if len(g1.peers) != 8 {
 		t.Fatal("gateway did not reach 8 peers:", g1.peers)
 	}
-	if g1.peers[g2.Address()] == nil {
+	if _, exists := g1.peerByAddr(g2.Address()); !exists {
 		t.Fatal("gateway did not connect to g2")
 	}
 }
@@ -4,7 +4,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 )
@@ -14,6 +16,23 @@ var persistMetadata = persist.Metadata{
 	Version: "0.3.3",
 }
 
+var banMetadata = persist.Metadata{
+	Header:  "Sia Ban List",
+	Version: "0.1",
+}
+
+var identityMetadata = persist.Metadata{
+	Header:  "Sia Node Identity",
+	Version: "0.1",
+}
+
+// identity is the persistent key pair that identifies the Gateway to peers
+// over encrypted connections.
+type identity struct {
+	SecretKey crypto.SecretKey
+	PublicKey crypto.PublicKey
+}
+
 func (g *Gateway) save() error {
 	var nodes []modules.NetAddress
 	for node := range g.nodes {
@@ -34,6 +53,63 @@ func (g *Gateway) load() error {
 	return nil
 }
 
+// saveBans stores the ban list. Expired bans are not saved. saveBans is called
+// with the lock held.
+func (g *Gateway) saveBans() error {
+	var bans []modules.PeerBan
+	now := time.Now()
+	for _, ban := range g.bans {
+		if ban.Expiry.After(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return persist.SaveFile(banMetadata, bans, filepath.Join(g.persistDir, "bans.json"))
+}
+
+// loadBans restores the ban list saved by a previous session.
+func (g *Gateway) loadBans() error {
+	var bans []modules.PeerBan
+	err := persist.LoadFile(banMetadata, &bans, filepath.Join(g.persistDir, "bans.json"))
+	if err != nil {
+		return err
+	}
+	for _, ban := range bans {
+		g.bans[ban.Address] = ban
+	}
+	return nil
+}
+
+// saveIdentity stores the Gateway's node key. The file holds the secret key,
+// so only the owner may read it.
+func saveIdentity(id identity, filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return persist.Save(identityMetadata, id, file)
+}
+
+// loadIdentity loads the Gateway's node key, generating and saving a new one
+// if none exists.
+func (g *Gateway) loadIdentity() error {
+	var id identity
+	filename := filepath.Join(g.persistDir, "identity.json")
+	err := persist.LoadFile(identityMetadata, &id, filename)
+	if os.IsNotExist(err) {
+		id.SecretKey, id.PublicKey, err = crypto.GenerateSignatureKeys()
+		if err != nil {
+			return err
+		}
+		err = saveIdentity(id, filename)
+	}
+	if err != nil {
+		return err
+	}
+	g.secretKey, g.publicKey = id.SecretKey, id.PublicKey
+	return nil
+}
+
 func makeLogger(persistDir string) (*log.Logger, error) {
 	// if the log file already exists, append to it
 	logFile, err := os.OpenFile(filepath.Join(persistDir, "gateway.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
@@ -15,7 +15,7 @@ func TestLoad(t *testing.T) {
 	g.mu.Unlock(id)
 	g.Close()
 
-	g2, err := New(":0", g.persistDir)
+	g2, err := New(":0", g.persistDir, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -38,7 +38,7 @@ func TestLoadPeer(t *testing.T) {
 	g1.Close()
 
 	// g1 should reconnect to g2 upon load
-	g1, err = New(":0", g1.persistDir)
+	g1, err = New(":0", g1.persistDir, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -35,7 +35,7 @@ func (g *Gateway) RPC(addr modules.NetAddress, name string, fn modules.RPCFunc)
 	// TODO: change to debug log
 	//g.log.Printf("INFO: calling RPC \"%v\" on %v", name, addr)
 	id := g.mu.RLock()
-	peer, ok := g.peers[addr]
+	peer, ok := g.peerByAddr(addr)
 	g.mu.RUnlock(id)
 	if !ok {
 		return errors.New("can't call RPC on unconnected peer " + string(addr))
@@ -55,12 +55,32 @@ func (g *Gateway) RPC(addr modules.NetAddress, name string, fn modules.RPCFunc)
 	err = fn(conn)
 	if err != nil {
 		g.log.Printf("WARN: calling RPC \"%v\" on peer %v returned error: %v", name, addr, err)
-		// give peer a strike
-		atomic.AddUint32(&peer.strikes, 1)
 	}
+	g.strike(peer, err)
 	return err
 }
 
+// strike updates the strikes of a peer after an RPC called on it returns
+// 'err'. Peers that break the protocol get a strike, and are banned once they
+// have too many. Every successful RPC takes away a strike, so that occasional
+// violations by a long-lived peer do not add up to a ban.
+func (g *Gateway) strike(p *peer, err error) {
+	if err == nil {
+		for {
+			strikes := atomic.LoadUint32(&p.strikes)
+			if strikes == 0 || atomic.CompareAndSwapUint32(&p.strikes, strikes, strikes-1) {
+				return
+			}
+		}
+	}
+	if _, violation := err.(modules.PeerViolation); !violation {
+		return
+	}
+	if atomic.AddUint32(&p.strikes, 1) == maxStrikes {
+		g.Ban(p.addr, modules.MisbehaviorBanDuration, "too many protocol violations")
+	}
+}
+
 // RegisterRPC registers an RPCFunc as a handler for a given identifier. To
 // call an RPC, use gateway.RPC, supplying the same identifier given to
 // RegisterRPC. Identifiers should always use PascalCase.
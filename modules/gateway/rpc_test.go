@@ -99,7 +99,8 @@ func TestRPC(t *testing.T) {
 		t.Fatal("bad RPC did not produce an error")
 	}
 
-	g1.peers[g2.Address()].sess.Close()
+	p, _ := g1.peerByAddr(g2.Address())
+	p.sess.Close()
 	if err := g1.RPC(g2.Address(), "Foo", nil); err == nil {
 		t.Fatal("RPC on closed peer connection succeeded")
 	}
@@ -130,7 +131,8 @@ func TestThreadedHandleConn(t *testing.T) {
 
 	// custom rpc fn (doesn't automatically write rpcID)
 	rpcFn := func(fn func(modules.PeerConn) error) error {
-		conn, err := g1.peers[g2.Address()].open()
+		p, _ := g1.peerByAddr(g2.Address())
+		conn, err := p.open()
 		if err != nil {
 			return err
 		}
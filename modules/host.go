@@ -1,12 +1,17 @@
 package modules
 
 import (
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
 	AcceptTermsResponse = "accept"
 	HostDir             = "host"
+
+	// DownloadChunkSize is the number of bytes that a host sends for each
+	// payment made during a download.
+	DownloadChunkSize = 1 << 18
 )
 
 // ContractTerms are the parameters agreed upon by a client and a host when
@@ -20,6 +25,85 @@ type ContractTerms struct {
 	Collateral         types.Currency        // Host contribution towards payout each window
 	ValidProofOutputs  []types.SiacoinOutput // Where money goes if the storage proof is successful.
 	MissedProofOutputs []types.SiacoinOutput // Where the money goes if the storage proof fails.
+	RenterKey          types.SiaPublicKey    // The key the renter uses to sign revisions of the contract.
+	DownloadBudget     types.Currency        // Coins set aside by the renter to pay for downloads.
+}
+
+var (
+	// The types of RevisionAction.
+	ActionAppend   = types.Specifier{'a', 'p', 'p', 'e', 'n', 'd'}
+	ActionTruncate = types.Specifier{'t', 'r', 'u', 'n', 'c', 'a', 't', 'e'}
+	ActionWrite    = types.Specifier{'w', 'r', 'i', 't', 'e'}
+)
+
+// A RevisionAction is a modification to the file covered by a file contract.
+// ActionAppend adds Data to the end of the file, ActionTruncate shortens the
+// file to Offset bytes, and ActionWrite replaces the bytes starting at Offset
+// with Data. Actions are applied in order.
+type RevisionAction struct {
+	Type   types.Specifier
+	Offset uint64
+	Data   []byte
+}
+
+// RevisionUploadSize returns the number of bytes of data that a set of
+// revision actions sends to the host. The host charges for each of them.
+func RevisionUploadSize(actions []RevisionAction) (size uint64) {
+	for _, action := range actions {
+		size += uint64(len(action.Data))
+	}
+	return
+}
+
+// ContractUnlockConditions returns the unlock conditions of a file contract
+// between a renter and a host. Both the renter and the host need to sign a
+// revision of the contract.
+func ContractUnlockConditions(renterKey, hostKey types.SiaPublicKey) types.UnlockConditions {
+	return types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{renterKey, hostKey},
+		SignaturesRequired: 2,
+	}
+}
+
+// RetrieveChallengeHash returns the hash that a renter signs with the renter
+// key of a file contract to prove to the host that it may download the file.
+// The challenge is chosen randomly by the host.
+func RetrieveChallengeHash(fcid types.FileContractID, challenge crypto.Hash) crypto.Hash {
+	return crypto.HashAll(fcid, challenge)
+}
+
+// The outcomes of a contract in the host's contract ledger. A contract is
+// pending until it expires. It is valid if the host's storage proof was
+// confirmed, missed if the proof never made it into the blockchain, and
+// reverted if the contract itself was not in the blockchain when it expired.
+const (
+	ContractOutcomePending  = "pending"
+	ContractOutcomeValid    = "valid"
+	ContractOutcomeMissed   = "missed"
+	ContractOutcomeReverted = "reverted"
+)
+
+// A ContractRecord is an entry in the host's contract ledger. Records are kept
+// after their contracts expire.
+type ContractRecord struct {
+	ID    types.FileContractID
+	Terms ContractTerms // The terms proposed by the renter.
+
+	FileSize    uint64         // Current size of the file, including revisions.
+	Payout      types.Currency // Total payout of the contract.
+	Collateral  types.Currency // Coins locked by the host.
+	Revenue     types.Currency // Host payout less collateral, once the contract is valid.
+	WindowStart types.BlockHeight
+	WindowEnd   types.BlockHeight
+
+	FormationHeight    types.BlockHeight // Height at which the contract was negotiated.
+	ConfirmationHeight types.BlockHeight // Height of the block containing the contract. Zero if unconfirmed.
+	ProofHeight        types.BlockHeight // Height of the block containing the storage proof. Zero if unconfirmed.
+	Outcome            string
+
+	// TransactionIDs lists the transactions submitted by the host for the
+	// contract: the contract itself, its revisions, and its storage proofs.
+	TransactionIDs []crypto.Hash
 }
 
 // HostInfo contains HostSettings and details pertinent to the host's understanding
@@ -33,6 +117,78 @@ type HostInfo struct {
 	PotentialProfit  types.Currency
 
 	Competition types.Currency
+
+	CollateralLocked    types.Currency // Collateral locked in unresolved contracts.
+	CollateralAvailable types.Currency // Collateral that can still be locked in new contracts.
+}
+
+// A DrainReport describes the obligations that a host needs to fulfill before
+// it can be shut down without missing a storage proof.
+type DrainReport struct {
+	Maintenance     bool              // Whether the host is refusing new contracts.
+	Obligations     int               // Number of obligations that have not been resolved.
+	StorageInUse    uint64            // Bytes stored for the remaining obligations.
+	LastWindowEnd   types.BlockHeight // End of the last proof window of the remaining obligations.
+	DrainHeight     types.BlockHeight // Height at which the last obligation is resolved.
+	BlocksRemaining types.BlockHeight // Blocks until the host is drained.
+}
+
+// HostConnectionLimits bound the load that renters can put on a host.
+// Connections beyond the limits are closed right away, and negotiations beyond
+// the rate limit are refused.
+type HostConnectionLimits struct {
+	MaxConnections      int     // Maximum number of open connections.
+	MaxConnectionsPerIP int     // Maximum number of open connections from a single IP address.
+	NegotiationRate     float64 // Contract and revision negotiations allowed per minute from a single IP address.
+	NegotiationBurst    int     // Negotiations that a single IP address can make in quick succession.
+}
+
+// A PricingPolicy controls the automatic adjustment of a host's prices. When
+// the policy is enabled, the host periodically adjusts its Price and
+// Collateral according to its storage utilization, the prices of competing
+// hosts, and the demand for contracts, staying within the bounds set by the
+// operator.
+type PricingPolicy struct {
+	Enabled       bool
+	MinPrice      types.Currency
+	MaxPrice      types.Currency
+	MinCollateral types.Currency
+	MaxCollateral types.Currency
+}
+
+// ScrubSettings control the host's scrubber, which periodically reads every
+// file that the host stores and checks it against the Merkle root of its file
+// contract. Corruption is then found before a storage proof fails.
+type ScrubSettings struct {
+	Enabled  bool
+	Interval types.BlockHeight // Blocks between the starts of two scrubs.
+	ReadRate uint64            // Bytes per second read from disk while scrubbing.
+}
+
+// A CorruptFile is a file that no longer matches the Merkle root of its file
+// contract. Error is set instead of Root if the file could not be read.
+type CorruptFile struct {
+	ContractID   types.FileContractID
+	Path         string
+	ExpectedRoot crypto.Hash
+	Root         crypto.Hash
+	Error        string
+}
+
+// ScrubStatus reports the progress and findings of the host's scrubber.
+type ScrubStatus struct {
+	Scrubbing    bool
+	LastScrub    types.BlockHeight // Height at which the last scrub started.
+	FilesChecked int               // Files checked during the current or last scrub.
+	CorruptFiles []CorruptFile
+}
+
+// StorageFolderMetadata contains information about a storage folder that the
+// host is using to store files.
+type StorageFolderMetadata struct {
+	Path          string // Absolute path to the folder on disk.
+	Size          uint64 // Number of bytes the host may store in the folder.
+	SizeRemaining uint64 // Number of bytes in the folder that are not in use.
 }
 
 type Host interface {
@@ -40,9 +196,33 @@ type Host interface {
 	Address() NetAddress
 
 	// Announce announces the host on the blockchain, returning an error if the
-	// host cannot reach itself or if the external ip address is unknown.
+	// host cannot reach itself or if the external ip address is unknown. The
+	// host announces itself again whenever its external IP changes.
 	Announce() error
 
+	// AnnounceAddress announces the host on the blockchain under 'addr',
+	// which may contain a DNS hostname instead of an IP address. The host
+	// keeps announcing 'addr' instead of its external IP until Announce or
+	// ForceAnnounce is called.
+	AnnounceAddress(addr NetAddress) error
+
+	// AddStorageFolder adds a folder to the host that can hold up to 'size'
+	// bytes of data. Files are spread across all of the host's storage
+	// folders.
+	AddStorageFolder(path string, size uint64) error
+
+	// ConnectionLimits returns the limits on the connections that the host
+	// accepts.
+	ConnectionLimits() HostConnectionLimits
+
+	// Contracts returns the host's contract ledger, sorted by formation
+	// height.
+	Contracts() []ContractRecord
+
+	// DrainReport returns a report of the obligations that the host needs to
+	// fulfill before it can be shut down.
+	DrainReport() DrainReport
+
 	// ForceAnnounce announces the host on the blockchain, regardless of
 	// connectivity.
 	ForceAnnounce() error
@@ -51,12 +231,56 @@ type Host interface {
 	// is received.
 	HostNotify() <-chan struct{}
 
-	// SetConfig sets the hosting parameters of the host.
-	SetSettings(HostSettings)
+	// Maintenance returns true if the host is in maintenance mode.
+	Maintenance() bool
+
+	// PricingPolicy returns the policy that the host uses to adjust its
+	// prices.
+	PricingPolicy() PricingPolicy
+
+	// RemoveStorageFolder removes a storage folder from the host. Any files in
+	// the folder are migrated to the remaining storage folders first.
+	RemoveStorageFolder(path string) error
+
+	// ResizeStorageFolder changes the number of bytes that the host may store
+	// in a storage folder. A folder cannot be shrunk below the amount of data
+	// it already holds.
+	ResizeStorageFolder(path string, size uint64) error
+
+	// ScrubSettings returns the settings of the host's scrubber.
+	ScrubSettings() ScrubSettings
+
+	// ScrubStatus returns the progress of the host's scrubber and the corrupt
+	// files that it has found.
+	ScrubStatus() ScrubStatus
+
+	// SetConnectionLimits sets the limits on the connections that the host
+	// accepts.
+	SetConnectionLimits(HostConnectionLimits) error
+
+	// SetMaintenance puts the host in or takes it out of maintenance mode. In
+	// maintenance mode the host refuses new contracts, but keeps storing
+	// files and submitting storage proofs for its existing obligations.
+	SetMaintenance(bool) error
+
+	// SetPricingPolicy sets the policy that the host uses to adjust its
+	// prices.
+	SetPricingPolicy(PricingPolicy) error
+
+	// SetScrubSettings sets the settings of the host's scrubber.
+	SetScrubSettings(ScrubSettings) error
+
+	// SetConfig sets the hosting parameters of the host. TotalStorage cannot
+	// be raised beyond what the host's disks can hold.
+	SetSettings(HostSettings) error
 
 	// Settings returns the host's settings.
 	Settings() HostSettings
 
+	// StorageFolders returns information about each of the host's storage
+	// folders.
+	StorageFolders() []StorageFolderMetadata
+
 	// Info returns info about the host, including its hosting parameters, the
 	// amount of storage remaining, and the number of active contracts.
 	Info() HostInfo
@@ -5,13 +5,24 @@ import (
 	"net"
 	"time"
 
-	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
 	pingTimeout = 10 * time.Second
+
+	// addressCheckInterval is the number of blocks between checks of the
+	// host's external IP.
+	addressCheckInterval = 6 // 1 hour
+)
+
+var (
+	errBadAnnounceAddress = errors.New("announce address must be a hostname or IP address followed by a port")
+
+	// lookupExternalIP returns the host's current external IP. It is a
+	// variable so that tests can change the address.
+	lookupExternalIP = modules.LookupExternalIP
 )
 
 // ping establishes a connection to addr and then immediately closes it. It is
@@ -25,6 +36,16 @@ func ping(addr modules.NetAddress) bool {
 	return true
 }
 
+// announceAddress returns the address that the host announces: the address
+// set by AnnounceAddress if there is one, or else the host's external IP.
+// announceAddress is called with the lock held.
+func (h *Host) announceAddress() modules.NetAddress {
+	if h.customAddress != "" {
+		return h.customAddress
+	}
+	return h.myAddr
+}
+
 // announce creates an announcement transaction and submits it to the network.
 func (h *Host) announce(addr modules.NetAddress) error {
 	// create the transaction that will hold the announcement
@@ -34,12 +55,15 @@ func (h *Host) announce(addr modules.NetAddress) error {
 		return err
 	}
 
-	// create and encode the announcement and add it to the arbitrary data of
+	// create and sign the announcement and add it to the arbitrary data of
 	// the transaction.
-	announcement := encoding.Marshal(modules.HostAnnouncement{
-		IPAddress: addr,
-	})
-	_, _, err = h.wallet.AddArbitraryData(id, append(modules.PrefixHostAnnouncement[:], announcement...))
+	lockID := h.mu.RLock()
+	announcement, err := modules.CreateAnnouncement(addr, h.blockHeight, h.PublicKey, h.secretKey)
+	h.mu.RUnlock(lockID)
+	if err != nil {
+		return err
+	}
+	_, _, err = h.wallet.AddArbitraryData(id, announcement)
 	if err != nil {
 		return err
 	}
@@ -57,16 +81,55 @@ func (h *Host) announce(addr modules.NetAddress) error {
 		return err
 	}
 
+	// Remember the announced price, so that the host can announce itself
+	// again if its price changes significantly.
+	lockID = h.mu.Lock()
+	h.announced = true
+	h.announcedPrice = h.Price
+	h.save()
+	h.mu.Unlock(lockID)
 	return nil
 }
 
+// threadedCheckAddress looks up the host's external IP, and announces the
+// host again if the IP has changed since the host last announced itself.
+// Hosts announced under a custom address are left alone, as the address is
+// expected to be kept up to date through DNS.
+func (h *Host) threadedCheckAddress() {
+	ip, err := lookupExternalIP()
+	if err != nil {
+		h.log.Println("WARN: could not look up external IP:", err)
+		return
+	}
+
+	lockID := h.mu.Lock()
+	addr := modules.NetAddress(net.JoinHostPort(ip, h.myAddr.Port()))
+	if addr == h.myAddr {
+		h.mu.Unlock(lockID)
+		return
+	}
+	h.log.Printf("INFO: external address changed from %v to %v\n", h.myAddr, addr)
+	h.myAddr = addr
+	reannounce := h.announced && h.customAddress == ""
+	h.mu.Unlock(lockID)
+
+	if reannounce {
+		err = h.announce(addr)
+		if err != nil {
+			h.log.Println("WARN: could not re-announce host after an address change:", err)
+		}
+	}
+}
+
 // Announce creates a host announcement transaction, adding information to the
 // arbitrary data, signing the transaction, and submitting it to the
-// transaction pool.
+// transaction pool. The host's external IP is announced, replacing any
+// address set by AnnounceAddress.
 func (h *Host) Announce() error {
-	lockID := h.mu.RLock()
+	lockID := h.mu.Lock()
 	addr := h.myAddr
-	h.mu.RUnlock(lockID)
+	h.customAddress = ""
+	h.mu.Unlock(lockID)
 	if addr.Host() == "::1" {
 		return errors.New("can't announce without knowing external IP")
 	} else if !ping(addr) {
@@ -78,8 +141,23 @@ func (h *Host) Announce() error {
 // ForceAnnounce skips the check for knowing your external IP and for checking
 // your port.
 func (h *Host) ForceAnnounce() error {
-	lockID := h.mu.RLock()
+	lockID := h.mu.Lock()
 	addr := h.myAddr
-	h.mu.RUnlock(lockID)
+	h.customAddress = ""
+	h.mu.Unlock(lockID)
+	return h.announce(addr)
+}
+
+// AnnounceAddress announces the host under 'addr', which may contain a DNS
+// hostname instead of an IP address. The host keeps announcing 'addr' until
+// Announce or ForceAnnounce is called, and does not announce itself again
+// when its external IP changes.
+func (h *Host) AnnounceAddress(addr modules.NetAddress) error {
+	if addr.Host() == "" || addr.Port() == "" {
+		return errBadAnnounceAddress
+	}
+	lockID := h.mu.Lock()
+	h.customAddress = addr
+	h.mu.Unlock(lockID)
 	return h.announce(addr)
 }
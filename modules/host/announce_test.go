@@ -1,8 +1,11 @@
 package host
 
 import (
+	"bytes"
+	"net"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -25,13 +28,169 @@ func TestAnnouncement(t *testing.T) {
 	if len(txns) != 1 {
 		t.Error("Expecting 1 transaction in transaction pool, instead there was", len(txns))
 	}
-	encodedAnnouncement := txns[0].ArbitraryData[0][types.SpecifierLen:]
-	var ha modules.HostAnnouncement
-	err = encoding.Unmarshal([]byte(encodedAnnouncement), &ha)
+	ha, err := modules.DecodeAnnouncement(txns[0].ArbitraryData[0])
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if ha.IPAddress != ht.host.Address() || !bytes.Equal(ha.PublicKey.Key, ht.host.PublicKey.Key) {
+		t.Error("announcement does not contain the host's address and public key")
 	}
 
 	// TODO: Need to check that the host announcement gets the host into the
 	// hostdb.
 }
+
+// TestSignedSettings checks that the settings sent by the host are signed by
+// the host's key, along with the caller's challenge.
+func TestSignedSettings(t *testing.T) {
+	ht := CreateHostTester("TestSignedSettings", t)
+	conn, hostConn := net.Pipe()
+	defer conn.Close()
+	go func() {
+		ht.host.rpcSettings(hostConn)
+		hostConn.Close()
+	}()
+
+	challenge := crypto.HashObject("challenge")
+	err := encoding.WriteObject(conn, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings modules.HostSettings
+	err = encoding.ReadObject(conn, &settings, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig crypto.Signature
+	err = encoding.ReadObject(conn, &sig, crypto.SignatureSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = modules.VerifySettings(settings, challenge, sig, ht.host.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature should not verify against a different challenge, which
+	// is what a replayed signature would be checked against.
+	if modules.VerifySettings(settings, crypto.HashObject("other"), sig, ht.host.PublicKey) != modules.ErrBadHostSignature {
+		t.Error("signature verified against a different challenge")
+	}
+
+	// The signature should not verify against altered settings.
+	settings.Price = settings.Price.Add(settings.Price)
+	if modules.VerifySettings(settings, challenge, sig, ht.host.PublicKey) != modules.ErrBadHostSignature {
+		t.Error("signature verified against altered settings")
+	}
+}
+
+// announcedAddresses returns the addresses announced by the transactions in
+// the transaction pool.
+func (ht *hostTester) announcedAddresses() (addrs []modules.NetAddress) {
+	for _, txn := range ht.tpool.TransactionSet() {
+		for _, data := range txn.ArbitraryData {
+			ha, err := modules.DecodeAnnouncement(data)
+			if err == nil {
+				addrs = append(addrs, ha.IPAddress)
+			}
+		}
+	}
+	return addrs
+}
+
+// containsAddress reports whether 'addrs' contains 'addr'.
+func containsAddress(addrs []modules.NetAddress, addr modules.NetAddress) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// TestAddressChange checks that the host announces itself again when its
+// external IP changes, unless it was announced under a custom address.
+func TestAddressChange(t *testing.T) {
+	ht := CreateHostTester("TestAddressChange", t)
+	defer func(lookup func() (string, error)) {
+		lookupExternalIP = lookup
+	}(lookupExternalIP)
+	ip := "203.0.113.1"
+	lookupExternalIP = func() (string, error) { return ip, nil }
+
+	// An unannounced host updates its address without announcing.
+	ht.host.threadedCheckAddress()
+	addr := ht.host.Address()
+	if addr.Host() != ip {
+		t.Fatal("host address was not updated:", addr)
+	}
+	if len(ht.announcedAddresses()) != 0 {
+		t.Fatal("unannounced host announced itself")
+	}
+
+	// An announced host announces its new address.
+	err := ht.host.ForceAnnounce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.tpUpdateWait()
+	ip = "203.0.113.2"
+	ht.host.threadedCheckAddress()
+	ht.tpUpdateWait()
+	addrs := ht.announcedAddresses()
+	if len(addrs) != 2 || !containsAddress(addrs, ht.host.Address()) || ht.host.Address().Host() != ip {
+		t.Fatal("host did not announce its new address:", addrs)
+	}
+
+	// A custom address can contain a hostname, and is not replaced when the
+	// IP changes.
+	err = ht.host.AnnounceAddress("example.com")
+	if err != errBadAnnounceAddress {
+		t.Fatal("expected errBadAnnounceAddress, got", err)
+	}
+	err = ht.host.AnnounceAddress("example.com:9982")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip = "203.0.113.3"
+	ht.host.threadedCheckAddress()
+	ht.tpUpdateWait()
+	addrs = ht.announcedAddresses()
+	if len(addrs) != 3 || !containsAddress(addrs, "example.com:9982") {
+		t.Fatal("host did not announce its custom address:", addrs)
+	}
+	if ht.host.Address() != "example.com:9982" {
+		t.Error("host does not report its custom address:", ht.host.Address())
+	}
+}
+
+// TestAddressCheckInterval checks that the host checks its external IP once
+// addressCheckInterval blocks have passed since the last check, even when the
+// block at a multiple of the interval was never the newest block.
+func TestAddressCheckInterval(t *testing.T) {
+	ht := CreateHostTester("TestAddressCheckInterval", t)
+
+	// Find a height that is not a multiple of the interval.
+	var next types.BlockHeight
+	for {
+		lockID := ht.host.mu.RLock()
+		next = ht.host.blockHeight + 1
+		ht.host.mu.RUnlock(lockID)
+		if next > addressCheckInterval && next%addressCheckInterval != 0 {
+			break
+		}
+		ht.mineBlock()
+	}
+
+	// The check is due even though the new height is not a multiple of the
+	// interval.
+	lockID := ht.host.mu.Lock()
+	ht.host.lastAddressCheck = next - addressCheckInterval - 1
+	ht.host.mu.Unlock(lockID)
+	ht.mineBlock()
+	lockID = ht.host.mu.RLock()
+	defer ht.host.mu.RUnlock(lockID)
+	if ht.host.lastAddressCheck != next {
+		t.Error("host did not check its address at height", next)
+	}
+}
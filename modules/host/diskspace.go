@@ -0,0 +1,92 @@
+package host
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var (
+	errDiskTooSmall = errors.New("not enough free disk space to back the requested storage")
+)
+
+// zeroReader is an io.Reader that returns zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// fillZeros writes 'size' zeros to 'file' and seeks back to the start of the
+// file.
+func fillZeros(file *os.File, size uint64) error {
+	_, err := io.CopyN(file, zeroReader{}, int64(size))
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(0, 0)
+	return err
+}
+
+// backedStorage returns the number of bytes that the host's disks can hold,
+// counting the data that the host already stores. Storage folders cannot
+// hold more than their size. Folders that share a disk each count the free
+// space of the disk. backedStorage is called with the lock held.
+func (h *Host) backedStorage() (uint64, error) {
+	if len(h.storageFolders) == 0 {
+		free, err := freeSpace(h.saveDir)
+		if err != nil {
+			return 0, err
+		}
+		return free + uint64(h.TotalStorage-h.spaceRemaining), nil
+	}
+	var total uint64
+	for _, sf := range h.storageFolders {
+		free, err := freeSpace(sf.Path)
+		if err != nil {
+			return 0, err
+		}
+		backed := free + sf.Size - sf.SizeRemaining
+		if backed > sf.Size {
+			backed = sf.Size
+		}
+		total += backed
+	}
+	return total, nil
+}
+
+// checkDiskSpace shrinks the host's storage folders and TotalStorage to what
+// its disks can actually hold, returning true if anything was shrunk. Data
+// that the host already stores is never affected. checkDiskSpace is called
+// with the lock held.
+func (h *Host) checkDiskSpace() (shrunk bool) {
+	for _, sf := range h.storageFolders {
+		free, err := freeSpace(sf.Path)
+		if err != nil {
+			h.log.Println("WARN: could not check the free space of storage folder", sf.Path+":", err)
+			continue
+		}
+		if sf.SizeRemaining > free {
+			h.log.Printf("WARN: storage folder %v has only %v bytes of free space; shrinking it from %v to %v bytes\n", sf.Path, free, sf.Size, sf.Size-sf.SizeRemaining+free)
+			sf.Size -= sf.SizeRemaining - free
+			sf.SizeRemaining = free
+			shrunk = true
+		}
+	}
+
+	backed, err := h.backedStorage()
+	if err != nil {
+		h.log.Println("WARN: could not check free disk space:", err)
+		return
+	}
+	if h.TotalStorage > int64(backed) {
+		h.log.Printf("WARN: disks can only hold %v bytes; shrinking total storage from %v bytes\n", backed, h.TotalStorage)
+		h.spaceRemaining -= h.TotalStorage - int64(backed)
+		h.TotalStorage = int64(backed)
+		shrunk = true
+	}
+	return
+}
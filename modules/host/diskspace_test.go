@@ -0,0 +1,72 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// hugeStorage is more storage than any test machine has.
+const hugeStorage = 1 << 60
+
+// TestPreallocate checks that allocated files take up their full size on disk.
+func TestPreallocate(t *testing.T) {
+	ht := CreateHostTester("TestPreallocate", t)
+	file, path, err := ht.allocate(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stat, err := os.Stat(ht.host.filePath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != 4e3 {
+		t.Error("file was not preallocated:", stat.Size())
+	}
+}
+
+// TestDiskSpaceLimits checks that the host does not offer more storage than
+// its disks can hold.
+func TestDiskSpaceLimits(t *testing.T) {
+	ht := CreateHostTester("TestDiskSpaceLimits", t)
+	settings := ht.host.Settings()
+	settings.TotalStorage = hugeStorage
+	if ht.host.SetSettings(settings) != errDiskTooSmall {
+		t.Fatal("host accepted more storage than its disk can hold")
+	}
+	folder := filepath.Join(ht.host.saveDir, "folder")
+	if ht.host.AddStorageFolder(folder, hugeStorage) != errDiskTooSmall {
+		t.Fatal("host accepted a storage folder larger than its disk")
+	}
+	err := ht.host.AddStorageFolder(folder, 10e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.ResizeStorageFolder(folder, hugeStorage) != errDiskTooSmall {
+		t.Fatal("host grew a storage folder beyond its disk")
+	}
+
+	// Settings that the disks can no longer back are shrunk at startup.
+	lockID := ht.host.mu.Lock()
+	defer ht.host.mu.Unlock(lockID)
+	ht.host.storageFolders[0].Size = hugeStorage
+	ht.host.storageFolders[0].SizeRemaining = hugeStorage
+	ht.host.TotalStorage = hugeStorage
+	ht.host.spaceRemaining = hugeStorage
+	if !ht.host.checkDiskSpace() {
+		t.Fatal("checkDiskSpace did not shrink the host's storage")
+	}
+	free, err := freeSpace(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Allow for other processes using the disk in the meantime.
+	sf := ht.host.storageFolders[0]
+	if sf.Size > free+1e6 || sf.Size != sf.SizeRemaining {
+		t.Error("storage folder was not shrunk to the free space of its disk:", sf.Size, free)
+	}
+	if uint64(ht.host.TotalStorage) > sf.Size || ht.host.spaceRemaining != ht.host.TotalStorage {
+		t.Error("total storage was not shrunk to the storage folder:", ht.host.TotalStorage)
+	}
+}
@@ -0,0 +1,18 @@
+// +build !windows
+
+package host
+
+import (
+	"syscall"
+)
+
+// freeSpace returns the number of bytes available to the host on the
+// filesystem containing 'path'.
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -2,9 +2,11 @@ package host
 
 import (
 	"errors"
+	"log"
 	"net"
 	"os"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
 	"github.com/NebulousLabs/Sia/sync"
@@ -19,12 +21,28 @@ const (
 	maxContractLen         = 1 << 16 // The maximum allowed size of a file contract coming in over the wire. This does not include the file.
 )
 
+// An obligationStatus indicates how far along the host is in fulfilling a
+// contract obligation. The status is saved to disk so that the host can resume
+// unfinished storage proofs after a restart.
+type obligationStatus int
+
+const (
+	obligationPending        obligationStatus = iota // No storage proof has been submitted.
+	obligationProofSubmitted                         // A storage proof has been given to the transaction pool.
+	obligationProofConfirmed                         // A storage proof has appeared in the blockchain.
+)
+
 // A contractObligation tracks a file contract that the host is obligated to
 // fulfill.
 type contractObligation struct {
 	ID           types.FileContractID
 	FileContract types.FileContract
-	Path         string // Where on disk the file is stored.
+	Path         string // Where on disk the file is stored. Relative paths are relative to the save directory.
+	Status       obligationStatus
+
+	// UnlockConditions are the conditions that the renter and host use to
+	// sign revisions of the file contract.
+	UnlockConditions types.UnlockConditions
 }
 
 // A Host contains all the fields necessary for storing files for clients and
@@ -37,22 +55,62 @@ type Host struct {
 	blockHeight types.BlockHeight
 
 	consensusHeight types.BlockHeight
-	myAddr          modules.NetAddress
+	myAddr          modules.NetAddress // External IP and port; updated when the IP changes.
+	customAddress   modules.NetAddress // Address announced instead of myAddr, such as a DNS hostname.
 	saveDir         string
 	spaceRemaining  int64
 	fileCounter     int
 	profit          types.Currency
+	storageFolders  []*storageFolder
+	secretKey       crypto.SecretKey // Used to sign file contract revisions.
+
+	// The external IP is checked every addressCheckInterval blocks.
+	lastAddressCheck types.BlockHeight
+
+	// Automatic price adjustment. The host re-announces itself when its price
+	// changes significantly from the price it last announced.
+	pricingPolicy       modules.PricingPolicy
+	lastPriceAdjustment types.BlockHeight
+	contractsFormed     int // Contracts formed since the last price adjustment.
+	announced           bool
+	announcedPrice      types.Currency
+
+	// Connection limits. Connections are counted per IP address, and
+	// negotiations are rate limited using a token bucket for each recently
+	// seen address.
+	connectionLimits   modules.HostConnectionLimits
+	connections        map[string]int
+	totalConnections   int
+	negotiationBuckets *bucketSet
+
+	// In maintenance mode the host refuses new contracts.
+	maintenance bool
+
+	// reservedCollateral is the collateral of contracts that are being
+	// negotiated, which counts towards the collateral budget.
+	reservedCollateral types.Currency
+
+	// Scrubbing. Every scrubSettings.Interval blocks the host reads each of
+	// its files to check for corruption.
+	scrubSettings modules.ScrubSettings
+	scrubStatus   modules.ScrubStatus
 
 	listener net.Listener
 
-	obligationsByID     map[types.FileContractID]contractObligation
-	obligationsByHeight map[types.BlockHeight][]contractObligation
+	obligationsByID map[types.FileContractID]contractObligation
+	proving         map[types.FileContractID]bool // Obligations with a storage proof currently being built.
+	revising        map[types.FileContractID]bool // Obligations with a revision currently being negotiated.
+
+	// The contract ledger records every contract the host has formed,
+	// including contracts that have expired.
+	contracts map[types.FileContractID]*modules.ContractRecord
 
 	modules.HostSettings
 
 	subscriptions []chan struct{}
 
-	mu *sync.RWMutex
+	log *log.Logger
+	mu  *sync.RWMutex
 }
 
 // New returns an initialized Host.
@@ -74,6 +132,12 @@ func New(cs *consensus.State, hdb modules.HostDB, tpool modules.TransactionPool,
 	if err != nil {
 		return nil, err
 	}
+	// The keys are replaced by the saved keys if the host has been run
+	// before.
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		return nil, err
+	}
 	h := &Host{
 		cs:     cs,
 		hostdb: hdb,
@@ -89,12 +153,28 @@ func New(cs *consensus.State, hdb modules.HostDB, tpool modules.TransactionPool,
 			Price:        types.NewCurrency64(100e12), // 0.1 siacoin / mb / week
 			Collateral:   types.NewCurrency64(0),
 			UnlockHash:   coinAddr,
+
+			DownloadPrice: types.NewCurrency64(100e12), // 0.1 siacoin / gb
+			PublicKey: types.SiaPublicKey{
+				Algorithm: types.SignatureEd25519,
+				Key:       pk[:],
+			},
 		},
 
-		saveDir: saveDir,
+		saveDir:   saveDir,
+		secretKey: sk,
+
+		connectionLimits:   defaultConnectionLimits,
+		connections:        make(map[string]int),
+		negotiationBuckets: newBucketSet(),
+
+		scrubSettings: defaultScrubSettings,
+
+		obligationsByID: make(map[types.FileContractID]contractObligation),
+		proving:         make(map[types.FileContractID]bool),
+		revising:        make(map[types.FileContractID]bool),
 
-		obligationsByID:     make(map[types.FileContractID]contractObligation),
-		obligationsByHeight: make(map[types.BlockHeight][]contractObligation),
+		contracts: make(map[types.FileContractID]*modules.ContractRecord),
 
 		mu: sync.New(modules.SafeMutexDelay, 1),
 	}
@@ -112,10 +192,21 @@ func New(cs *consensus.State, hdb modules.HostDB, tpool modules.TransactionPool,
 	if err != nil {
 		return nil, err
 	}
+	err = h.initLog()
+	if err != nil {
+		return nil, err
+	}
 	err = h.load()
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
+	h.removeOrphanedFiles()
+	if h.checkDiskSpace() {
+		err = h.save()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// spawn listener
 	go h.listen()
@@ -126,13 +217,24 @@ func New(cs *consensus.State, hdb modules.HostDB, tpool modules.TransactionPool,
 }
 
 // SetConfig updates the host's internal HostSettings object. To modify
-// a specific field, use a combination of Info and SetConfig
-func (h *Host) SetSettings(settings modules.HostSettings) {
+// a specific field, use a combination of Info and SetConfig. TotalStorage
+// cannot be raised beyond what the host's disks can hold.
+func (h *Host) SetSettings(settings modules.HostSettings) error {
 	lockID := h.mu.Lock()
 	defer h.mu.Unlock(lockID)
+	if settings.TotalStorage > h.TotalStorage {
+		backed, err := h.backedStorage()
+		if err != nil {
+			return err
+		}
+		if settings.TotalStorage > int64(backed) {
+			return errDiskTooSmall
+		}
+	}
 	h.spaceRemaining += settings.TotalStorage - h.TotalStorage
+	settings.PublicKey = h.PublicKey // The public key cannot be changed.
 	h.HostSettings = settings
-	h.save()
+	return h.save()
 }
 
 // Settings returns the settings of a host.
@@ -142,9 +244,11 @@ func (h *Host) Settings() modules.HostSettings {
 	return h.HostSettings
 }
 
+// Address returns the address that the host announces.
 func (h *Host) Address() modules.NetAddress {
-	// no lock needed; h.myAddr is only set once (in New).
-	return h.myAddr
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.announceAddress()
 }
 
 func (h *Host) Info() modules.HostInfo {
@@ -165,21 +269,25 @@ func (h *Host) Info() modules.HostInfo {
 	}
 
 	// Calculate estimated competition (reported in per GB per month). Price
-	// calculated by taking the average of 8 ranomly selected weighted hosts.
-	var averagePrice types.Currency
-	// TODO: 8 is the sample size - to be made a constant.
-	hosts := h.hostdb.RandomHosts(8)
-	for _, host := range hosts {
-		averagePrice = averagePrice.Add(host.Price)
-	}
-	if len(hosts) == 0 {
-		return info
-	}
-	averagePrice = averagePrice.Div(types.NewCurrency64(uint64(len(hosts))))
+	// calculated by taking the average of randomly selected weighted hosts.
+	competingPrice := averagePrice(h.hostdb.RandomHosts(competitionSampleSize))
 	// HACK: 4320 is one month, and 1024^3 is a GB. Price is reported as per GB
 	// per month.
-	estimatedCost := averagePrice.Mul(types.NewCurrency64(4320)).Mul(types.NewCurrency64(1024 * 1024 * 1024))
+	estimatedCost := competingPrice.Mul(types.NewCurrency64(4320)).Mul(types.NewCurrency64(1024 * 1024 * 1024))
 	info.Competition = estimatedCost
 
+	// Collateral is available up to the host's budget, and no more than the
+	// wallet holds.
+	info.CollateralLocked = h.lockedCollateral()
+	info.CollateralAvailable = h.wallet.Balance(false)
+	if !h.CollateralBudget.IsZero() {
+		var remaining types.Currency
+		if h.CollateralBudget.Cmp(info.CollateralLocked) > 0 {
+			remaining = h.CollateralBudget.Sub(info.CollateralLocked)
+		}
+		if remaining.Cmp(info.CollateralAvailable) < 0 {
+			info.CollateralAvailable = remaining
+		}
+	}
 	return info
 }
@@ -1,6 +1,7 @@
 package host
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -50,12 +51,31 @@ func (ht *hostTester) tpUpdateWait() {
 	<-ht.walletUpdateChan
 }
 
+// allocate reserves space for a file and creates it, the same way that the
+// host does when negotiating a contract.
+func (ht *hostTester) allocate(filesize uint64) (*os.File, string, error) {
+	lockID := ht.host.mu.Lock()
+	path, err := ht.host.reserve(filesize)
+	ht.host.mu.Unlock(lockID)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := ht.host.createFile(path, filesize)
+	if err != nil {
+		lockID = ht.host.mu.Lock()
+		ht.host.deallocate(filesize, path)
+		ht.host.mu.Unlock(lockID)
+		return nil, "", err
+	}
+	return file, path, nil
+}
+
 // CreateHostTester initializes a HostTester.
 func CreateHostTester(name string, t *testing.T) *hostTester {
 	testdir := build.TempDir(modules.HostDir, name)
 
 	// Create the modules.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir), false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -75,7 +95,7 @@ func CreateHostTester(name string, t *testing.T) *hostTester {
 	if err != nil {
 		t.Fatal(err)
 	}
-	hdb, err := hostdb.New(cs, g)
+	hdb, err := hostdb.New(cs, g, filepath.Join(testdir, modules.HostDBDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,132 @@
+package host
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// contractCollateral returns the collateral that the host locks in a contract
+// formed with 'terms'.
+func contractCollateral(terms modules.ContractTerms) types.Currency {
+	return terms.Collateral.Mul(types.NewCurrency64(terms.FileSize)).Mul(types.NewCurrency64(uint64(terms.Duration)))
+}
+
+// lockedCollateral returns the collateral locked in the host's unresolved
+// contracts, including contracts that are being negotiated. lockedCollateral
+// is called with the lock held.
+func (h *Host) lockedCollateral() types.Currency {
+	locked := h.reservedCollateral
+	for id := range h.obligationsByID {
+		if cr, exists := h.contracts[id]; exists {
+			locked = locked.Add(cr.Collateral)
+		}
+	}
+	return locked
+}
+
+// recordContract adds a newly formed contract to the ledger. recordContract
+// is called with the lock held.
+func (h *Host) recordContract(co contractObligation, terms modules.ContractTerms, txnID crypto.Hash) {
+	h.contracts[co.ID] = &modules.ContractRecord{
+		ID:    co.ID,
+		Terms: terms,
+
+		FileSize:    co.FileContract.FileSize,
+		Payout:      co.FileContract.Payout,
+		Collateral:  contractCollateral(terms),
+		WindowStart: co.FileContract.WindowStart,
+		WindowEnd:   co.FileContract.WindowEnd,
+
+		FormationHeight: h.cs.Height(),
+		Outcome:         modules.ContractOutcomePending,
+		TransactionIDs:  []crypto.Hash{txnID},
+	}
+}
+
+// recordTransaction adds a transaction submitted for a contract to the
+// ledger. recordTransaction is called with the lock held.
+func (h *Host) recordTransaction(fcid types.FileContractID, txnID crypto.Hash) {
+	cr, exists := h.contracts[fcid]
+	if !exists {
+		return
+	}
+	for _, id := range cr.TransactionIDs {
+		if id == txnID {
+			return
+		}
+	}
+	cr.TransactionIDs = append(cr.TransactionIDs, txnID)
+}
+
+// recordBlock updates the confirmation and proof heights of the contracts in
+// the ledger for a block at 'height'. If the block is being reverted, the
+// heights are cleared instead. recordBlock is called with the lock held.
+func (h *Host) recordBlock(b types.Block, height types.BlockHeight, reverted bool) {
+	if reverted {
+		height = 0
+	}
+	for _, txn := range b.Transactions {
+		for i := range txn.FileContracts {
+			if cr, exists := h.contracts[txn.FileContractID(i)]; exists {
+				cr.ConfirmationHeight = height
+			}
+		}
+		for _, sp := range txn.StorageProofs {
+			if cr, exists := h.contracts[sp.ParentID]; exists {
+				cr.ProofHeight = height
+			}
+		}
+	}
+}
+
+// resolveContract records the outcome of an obligation that has expired.
+// resolveContract is called with the lock held.
+func (h *Host) resolveContract(co contractObligation) {
+	cr, exists := h.contracts[co.ID]
+	if !exists {
+		return
+	}
+	switch {
+	case co.Status == obligationProofConfirmed:
+		cr.Outcome = modules.ContractOutcomeValid
+		hostPayout := co.FileContract.ValidProofOutputs[0].Value
+		if hostPayout.Cmp(cr.Collateral) > 0 {
+			cr.Revenue = hostPayout.Sub(cr.Collateral)
+		}
+	case cr.ConfirmationHeight == 0:
+		cr.Outcome = modules.ContractOutcomeReverted
+	default:
+		cr.Outcome = modules.ContractOutcomeMissed
+	}
+}
+
+// Contracts returns the host's contract ledger, sorted by formation height.
+func (h *Host) Contracts() []modules.ContractRecord {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	records := make([]modules.ContractRecord, 0, len(h.contracts))
+	for _, cr := range h.contracts {
+		record := *cr
+		record.TransactionIDs = append([]crypto.Hash(nil), cr.TransactionIDs...)
+		records = append(records, record)
+	}
+	sort.Sort(byFormationHeight(records))
+	return records
+}
+
+// byFormationHeight sorts contract records by the height at which they were
+// formed.
+type byFormationHeight []modules.ContractRecord
+
+func (rs byFormationHeight) Len() int      { return len(rs) }
+func (rs byFormationHeight) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+func (rs byFormationHeight) Less(i, j int) bool {
+	if rs[i].FormationHeight != rs[j].FormationHeight {
+		return rs[i].FormationHeight < rs[j].FormationHeight
+	}
+	return bytes.Compare(rs[i].ID[:], rs[j].ID[:]) < 0
+}
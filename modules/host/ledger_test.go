@@ -0,0 +1,113 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestContractLedger follows contracts through confirmation, storage proofs,
+// and expiration, checking the records kept in the host's ledger.
+func TestContractLedger(t *testing.T) {
+	ht := CreateHostTester("TestContractLedger", t)
+	terms := modules.ContractTerms{FileSize: 10, Duration: 5, Collateral: types.NewCurrency64(1)}
+
+	// Form three contracts, each with its own transaction.
+	var txns []types.Transaction
+	var obligations []contractObligation
+	lockID := ht.host.mu.Lock()
+	for i := uint64(0); i < 3; i++ {
+		txn := types.Transaction{FileContracts: []types.FileContract{{FileSize: 10, WindowStart: types.BlockHeight(i)}}}
+		co := contractObligation{
+			ID: txn.FileContractID(0),
+			FileContract: types.FileContract{
+				FileSize:          10,
+				ValidProofOutputs: []types.SiacoinOutput{{Value: types.NewCurrency64(80)}},
+			},
+		}
+		ht.host.recordContract(co, terms, txn.ID())
+		txns = append(txns, txn)
+		obligations = append(obligations, co)
+	}
+	ht.host.mu.Unlock(lockID)
+
+	// Confirm the first two contracts and a storage proof for the first.
+	height := ht.cs.Height()
+	if cr := ht.host.Contracts()[0]; cr.FormationHeight != height {
+		t.Error("wrong formation height recorded:", cr.FormationHeight)
+	}
+	proofBlock := types.Block{Transactions: []types.Transaction{{
+		StorageProofs: []types.StorageProof{{ParentID: obligations[0].ID}},
+	}}}
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{
+		AppliedBlocks: []types.Block{{Transactions: txns[:2]}, proofBlock},
+	})
+	records := ht.host.Contracts()
+	if len(records) != 3 {
+		t.Fatal("expected 3 records, got", len(records))
+	}
+	for _, cr := range records {
+		switch cr.ID {
+		case obligations[0].ID:
+			if cr.ConfirmationHeight != height+1 || cr.ProofHeight != height+2 {
+				t.Error("wrong heights recorded for the proven contract:", cr.ConfirmationHeight, cr.ProofHeight)
+			}
+		case obligations[1].ID:
+			if cr.ConfirmationHeight != height+1 || cr.ProofHeight != 0 {
+				t.Error("wrong heights recorded for the unproven contract:", cr.ConfirmationHeight, cr.ProofHeight)
+			}
+		case obligations[2].ID:
+			if cr.ConfirmationHeight != 0 {
+				t.Error("unconfirmed contract has a confirmation height")
+			}
+		}
+		if cr.Outcome != modules.ContractOutcomePending || cr.Collateral.Cmp(types.NewCurrency64(50)) != 0 {
+			t.Error("contract recorded incorrectly:", cr)
+		}
+	}
+
+	// Reverting the proof clears its height.
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{
+		RevertedBlocks: []types.Block{proofBlock},
+		AppliedBlocks:  []types.Block{proofBlock},
+	})
+	lockID = ht.host.mu.Lock()
+	if ht.host.contracts[obligations[0].ID].ProofHeight != height+2 {
+		t.Error("reapplied proof was not recorded")
+	}
+	ht.host.recordBlock(proofBlock, 0, true)
+	if ht.host.contracts[obligations[0].ID].ProofHeight != 0 {
+		t.Error("reverted proof was not cleared")
+	}
+
+	// Resolve the contracts.
+	obligations[0].Status = obligationProofConfirmed
+	for _, co := range obligations {
+		ht.host.resolveContract(co)
+	}
+	outcomes := []string{modules.ContractOutcomeValid, modules.ContractOutcomeMissed, modules.ContractOutcomeReverted}
+	for i, co := range obligations {
+		if cr := ht.host.contracts[co.ID]; cr.Outcome != outcomes[i] {
+			t.Errorf("contract %v: expected outcome %v, got %v", i, outcomes[i], cr.Outcome)
+		}
+	}
+	if ht.host.contracts[obligations[0].ID].Revenue.Cmp(types.NewCurrency64(30)) != 0 {
+		t.Error("wrong revenue recorded for the valid contract")
+	}
+
+	// The ledger is kept across restarts.
+	err := ht.host.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.contracts = make(map[types.FileContractID]*modules.ContractRecord)
+	err = ht.host.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ht.host.contracts) != 3 || ht.host.contracts[obligations[0].ID].Outcome != modules.ContractOutcomeValid {
+		t.Error("ledger was not restored")
+	}
+	ht.host.mu.Unlock(lockID)
+}
@@ -0,0 +1,154 @@
+package host
+
+import (
+	"container/list"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// maxNegotiationBuckets is the number of token buckets the host keeps
+	// before it starts discarding the least recently used buckets.
+	maxNegotiationBuckets = 1000
+)
+
+var (
+	// defaultConnectionLimits are the limits used by a new host.
+	defaultConnectionLimits = modules.HostConnectionLimits{
+		MaxConnections:      100,
+		MaxConnectionsPerIP: 10,
+		NegotiationRate:     6,
+		NegotiationBurst:    10,
+	}
+
+	errBadConnectionLimits = errors.New("connection limits must be positive")
+	errNegotiationRate     = errors.New("too many negotiations; try again later")
+)
+
+// A tokenBucket limits the rate of negotiations from a single IP address.
+type tokenBucket struct {
+	ip     string
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens gained since the bucket was last used, adding 'rate'
+// tokens per minute up to a maximum of 'burst' tokens.
+func (tb *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	tb.tokens += now.Sub(tb.last).Minutes() * rate
+	if tb.tokens > float64(burst) {
+		tb.tokens = float64(burst)
+	}
+	tb.last = now
+}
+
+// take removes a token from the bucket, returning false if the bucket is
+// empty.
+func (tb *tokenBucket) take() bool {
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// A bucketSet holds the token buckets of the IP addresses that negotiated most
+// recently. Once it holds maxNegotiationBuckets buckets, the least recently
+// used bucket is discarded to make room for a new one.
+type bucketSet struct {
+	buckets map[string]*list.Element
+	lru     *list.List // most recently used at the front
+}
+
+// newBucketSet returns an empty bucketSet.
+func newBucketSet() *bucketSet {
+	return &bucketSet{
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// bucket returns the bucket of 'ip', creating a bucket holding 'burst' tokens
+// if there is none.
+func (bs *bucketSet) bucket(ip string, burst int, now time.Time) *tokenBucket {
+	if e, exists := bs.buckets[ip]; exists {
+		bs.lru.MoveToFront(e)
+		return e.Value.(*tokenBucket)
+	}
+	if bs.lru.Len() >= maxNegotiationBuckets {
+		oldest := bs.lru.Remove(bs.lru.Back()).(*tokenBucket)
+		delete(bs.buckets, oldest.ip)
+	}
+	tb := &tokenBucket{ip: ip, tokens: float64(burst), last: now}
+	bs.buckets[ip] = bs.lru.PushFront(tb)
+	return tb
+}
+
+// connIP returns the IP address that a connection comes from.
+func connIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// openConnection records a new connection from 'ip', returning false if the
+// connection would exceed the host's connection limits.
+func (h *Host) openConnection(ip string) bool {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if h.totalConnections >= h.connectionLimits.MaxConnections || h.connections[ip] >= h.connectionLimits.MaxConnectionsPerIP {
+		return false
+	}
+	h.totalConnections++
+	h.connections[ip]++
+	return true
+}
+
+// closeConnection records that a connection from 'ip' has been closed.
+func (h *Host) closeConnection(ip string) {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.totalConnections--
+	h.connections[ip]--
+	if h.connections[ip] == 0 {
+		delete(h.connections, ip)
+	}
+}
+
+// allowNegotiation takes a token from the bucket of 'ip', returning false if
+// the address has been negotiating too often.
+func (h *Host) allowNegotiation(ip string) bool {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	now := time.Now()
+	limits := h.connectionLimits
+	tb := h.negotiationBuckets.bucket(ip, limits.NegotiationBurst, now)
+	tb.refill(now, limits.NegotiationRate, limits.NegotiationBurst)
+	return tb.take()
+}
+
+// ConnectionLimits returns the limits on the connections that the host
+// accepts.
+func (h *Host) ConnectionLimits() modules.HostConnectionLimits {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.connectionLimits
+}
+
+// SetConnectionLimits sets the limits on the connections that the host
+// accepts. Connections that are already open are not affected.
+func (h *Host) SetConnectionLimits(limits modules.HostConnectionLimits) error {
+	if limits.MaxConnections <= 0 || limits.MaxConnectionsPerIP <= 0 || limits.NegotiationRate <= 0 || limits.NegotiationBurst <= 0 {
+		return errBadConnectionLimits
+	}
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.connectionLimits = limits
+	return h.save()
+}
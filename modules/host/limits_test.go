@@ -0,0 +1,110 @@
+package host
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestTokenBucket checks that a token bucket refills at the right rate and
+// never holds more than its burst.
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	tb := &tokenBucket{tokens: 2, last: start}
+	if !tb.take() || !tb.take() || tb.take() {
+		t.Fatal("bucket did not allow exactly its burst")
+	}
+
+	// At 6 tokens per minute, a token is added every 10 seconds.
+	tb.refill(start.Add(9*time.Second), 6, 2)
+	if tb.take() {
+		t.Fatal("token was added too early")
+	}
+	tb.refill(start.Add(11*time.Second), 6, 2)
+	if !tb.take() {
+		t.Fatal("token was not added")
+	}
+	tb.refill(start.Add(time.Hour), 6, 2)
+	if tb.tokens != 2 {
+		t.Fatal("bucket holds more than its burst:", tb.tokens)
+	}
+}
+
+// TestConnectionLimits checks that the host refuses connections and
+// negotiations beyond its limits.
+func TestConnectionLimits(t *testing.T) {
+	ht := CreateHostTester("TestConnectionLimits", t)
+	err := ht.host.SetConnectionLimits(modules.HostConnectionLimits{})
+	if err != errBadConnectionLimits {
+		t.Fatal("expected errBadConnectionLimits, got", err)
+	}
+	err = ht.host.SetConnectionLimits(modules.HostConnectionLimits{
+		MaxConnections:      3,
+		MaxConnectionsPerIP: 2,
+		NegotiationRate:     1,
+		NegotiationBurst:    2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Connections are limited per IP address and in total.
+	if !ht.host.openConnection("1.1.1.1") || !ht.host.openConnection("1.1.1.1") {
+		t.Fatal("connections within the limits were refused")
+	}
+	if ht.host.openConnection("1.1.1.1") {
+		t.Fatal("connection beyond the per-IP limit was accepted")
+	}
+	if !ht.host.openConnection("2.2.2.2") {
+		t.Fatal("connection from another IP address was refused")
+	}
+	if ht.host.openConnection("3.3.3.3") {
+		t.Fatal("connection beyond the total limit was accepted")
+	}
+	ht.host.closeConnection("1.1.1.1")
+	if !ht.host.openConnection("3.3.3.3") {
+		t.Fatal("closed connection was not released")
+	}
+
+	// Negotiations are rate limited per IP address.
+	if !ht.host.allowNegotiation("1.1.1.1") || !ht.host.allowNegotiation("1.1.1.1") {
+		t.Fatal("negotiations within the burst were refused")
+	}
+	if ht.host.allowNegotiation("1.1.1.1") {
+		t.Fatal("negotiation beyond the burst was allowed")
+	}
+	if !ht.host.allowNegotiation("2.2.2.2") {
+		t.Fatal("negotiation from another IP address was refused")
+	}
+}
+
+// TestBucketSet checks that a bucketSet never holds more than
+// maxNegotiationBuckets buckets, and that it discards the least recently used
+// bucket first.
+func TestBucketSet(t *testing.T) {
+	bs := newBucketSet()
+	now := time.Now()
+	first := bs.bucket("0", 1, now)
+	first.take()
+	for i := 1; i < maxNegotiationBuckets; i++ {
+		bs.bucket(strconv.Itoa(i), 1, now)
+	}
+
+	// Using the first bucket again makes the second bucket the least
+	// recently used.
+	if bs.bucket("0", 1, now) != first {
+		t.Fatal("bucket was not reused")
+	}
+	bs.bucket("new", 1, now)
+	if len(bs.buckets) != maxNegotiationBuckets || bs.lru.Len() != maxNegotiationBuckets {
+		t.Fatal("bucket set exceeded its limit:", len(bs.buckets), bs.lru.Len())
+	}
+	if _, exists := bs.buckets["1"]; exists {
+		t.Error("least recently used bucket was not discarded")
+	}
+	if _, exists := bs.buckets["0"]; !exists {
+		t.Error("recently used bucket was discarded")
+	}
+}
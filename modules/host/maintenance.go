@@ -0,0 +1,59 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var errMaintenance = errors.New("host is in maintenance mode and is not accepting new contracts")
+
+// DrainReport returns a report of the obligations that the host needs to
+// fulfill before it can be shut down without missing a storage proof.
+func (h *Host) DrainReport() modules.DrainReport {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+
+	report := modules.DrainReport{
+		Maintenance: h.maintenance,
+		Obligations: len(h.obligationsByID),
+	}
+	for _, co := range h.obligationsByID {
+		report.StorageInUse += co.FileContract.FileSize
+		if co.FileContract.WindowEnd > report.LastWindowEnd {
+			report.LastWindowEnd = co.FileContract.WindowEnd
+		}
+		if co.expirationHeight() > report.DrainHeight {
+			report.DrainHeight = co.expirationHeight()
+		}
+	}
+	if report.DrainHeight > h.blockHeight {
+		report.BlocksRemaining = report.DrainHeight - h.blockHeight
+	}
+	return report
+}
+
+// Maintenance returns true if the host is in maintenance mode.
+func (h *Host) Maintenance() bool {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.maintenance
+}
+
+// SetMaintenance puts the host in or takes it out of maintenance mode. In
+// maintenance mode the host refuses new contracts, but keeps storing files,
+// serving downloads, and submitting storage proofs for its existing
+// obligations.
+func (h *Host) SetMaintenance(maintenance bool) error {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if maintenance != h.maintenance {
+		if maintenance {
+			h.log.Println("INFO: entering maintenance mode; new contracts will be refused")
+		} else {
+			h.log.Println("INFO: leaving maintenance mode; accepting new contracts")
+		}
+	}
+	h.maintenance = maintenance
+	return h.save()
+}
@@ -0,0 +1,71 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestMaintenance checks that a host in maintenance mode refuses new
+// contracts, and that the drain report shows when its obligations end.
+func TestMaintenance(t *testing.T) {
+	ht := CreateHostTester("TestMaintenance", t)
+	report := ht.host.DrainReport()
+	if report.Maintenance || report.Obligations != 0 || report.BlocksRemaining != 0 {
+		t.Fatal("unexpected drain report for an empty host:", report)
+	}
+
+	err := ht.host.SetMaintenance(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID := ht.host.mu.RLock()
+	err = ht.host.considerTerms(modules.ContractTerms{})
+	ht.host.mu.RUnlock(lockID)
+	if err != errMaintenance {
+		t.Fatal("expected errMaintenance, got", err)
+	}
+
+	// Add two obligations; the host is drained once the later one is
+	// resolved.
+	co1 := ht.addTestObligation(4e3)
+	co2 := ht.addTestObligation(6e3)
+	lockID = ht.host.mu.Lock()
+	co1.FileContract.WindowEnd = ht.host.blockHeight + 30
+	co2.FileContract.WindowEnd = ht.host.blockHeight + 50
+	ht.host.obligationsByID[co1.ID] = co1
+	ht.host.obligationsByID[co2.ID] = co2
+	height := ht.host.blockHeight
+	ht.host.mu.Unlock(lockID)
+	report = ht.host.DrainReport()
+	if !report.Maintenance || report.Obligations != 2 || report.StorageInUse != 10e3 {
+		t.Error("drain report does not describe the obligations:", report)
+	}
+	if report.LastWindowEnd != height+50 || report.DrainHeight != co2.expirationHeight() || report.BlocksRemaining != 50+StorageProofReorgDepth {
+		t.Error("drain report has the wrong heights:", report)
+	}
+
+	// Maintenance mode is kept across restarts.
+	lockID = ht.host.mu.Lock()
+	ht.host.maintenance = false
+	err = ht.host.load()
+	maintenance := ht.host.maintenance
+	ht.host.mu.Unlock(lockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maintenance {
+		t.Error("maintenance mode was not restored")
+	}
+
+	err = ht.host.SetMaintenance(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID = ht.host.mu.RLock()
+	err = ht.host.considerTerms(modules.ContractTerms{})
+	ht.host.mu.RUnlock(lockID)
+	if err == errMaintenance {
+		t.Error("host refused contracts after leaving maintenance mode")
+	}
+}
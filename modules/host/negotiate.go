@@ -6,7 +6,6 @@ import (
 	"net"
 	"os"
 	"path/filepath"
-	"strconv"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -16,32 +15,66 @@ import (
 
 var (
 	HostCapacityErr = errors.New("host is at capacity and can not take more files")
+
+	errCollateralBudget   = errors.New("host has no collateral budget left for the contract")
+	errContractCollateral = errors.New("collateral exceeds the host's maximum for a single contract")
 )
 
-// allocate allocates space for a file and creates it on disk.
-func (h *Host) allocate(filesize uint64) (file *os.File, path string, err error) {
+// reserve reserves space for a file and returns the path that the file should
+// be created at. If the host has storage folders, the file is placed in the
+// folder with the most free space. The reservation is released with
+// deallocate. reserve is called with the lock held.
+func (h *Host) reserve(filesize uint64) (path string, err error) {
+	var sf *storageFolder
+	if len(h.storageFolders) != 0 {
+		sf = h.selectStorageFolder(filesize)
+		if sf == nil {
+			return "", HostCapacityErr
+		}
+	}
+	path = h.newFilePath(sf)
 	h.spaceRemaining -= int64(filesize)
-	h.fileCounter++
-	path = strconv.Itoa(h.fileCounter)
-	fullpath := filepath.Join(h.saveDir, path)
-	file, err = os.Create(fullpath)
+	if sf != nil {
+		sf.SizeRemaining -= filesize
+	}
+	return path, nil
+}
+
+// createFile creates the file for a reservation made by reserve. The space
+// for the file is preallocated on disk, so that a full disk is detected before
+// any data is received. Preallocating can mean writing the whole file, so
+// createFile is called without the lock.
+func (h *Host) createFile(path string, filesize uint64) (*os.File, error) {
+	file, err := os.Create(h.filePath(path))
 	if err != nil {
-		return
+		return nil, err
 	}
-	return
+	err = preallocate(file, filesize)
+	if err != nil {
+		file.Close()
+		os.Remove(h.filePath(path))
+		h.log.Printf("WARN: could not preallocate %v bytes for %v: %v\n", filesize, path, err)
+		return nil, errors.New("could not allocate space for the file: " + err.Error())
+	}
+	return file, nil
 }
 
 // deallocate deletes a file and restores its allocated space.
 func (h *Host) deallocate(filesize uint64, path string) {
-	fullpath := filepath.Join(h.saveDir, path)
-	os.Remove(fullpath)
+	os.Remove(h.filePath(path))
 	h.spaceRemaining += int64(filesize)
+	if sf := h.storageFolder(filepath.Dir(path)); sf != nil {
+		sf.SizeRemaining += filesize
+	}
 }
 
 // considerTerms checks that the terms of a potential file contract fall
 // within acceptable bounds, as defined by the host.
 func (h *Host) considerTerms(terms modules.ContractTerms) error {
 	switch {
+	case h.maintenance:
+		return errMaintenance
+
 	case terms.FileSize < h.MinFilesize:
 		return errors.New("file is too small")
 
@@ -51,6 +84,9 @@ func (h *Host) considerTerms(terms modules.ContractTerms) error {
 	case terms.FileSize > uint64(h.spaceRemaining):
 		return HostCapacityErr
 
+	case len(h.storageFolders) != 0 && h.selectStorageFolder(terms.FileSize) == nil:
+		return HostCapacityErr
+
 	case terms.Duration < h.MinDuration || terms.Duration > h.MaxDuration:
 		return errors.New("duration is out of bounds")
 
@@ -66,17 +102,31 @@ func (h *Host) considerTerms(terms modules.ContractTerms) error {
 	case terms.Collateral.Cmp(h.Collateral) > 0:
 		return errors.New("collateral does not match host settings")
 
-	case len(terms.ValidProofOutputs) != 1:
+	case !h.MaxContractCollateral.IsZero() && contractCollateral(terms).Cmp(h.MaxContractCollateral) > 0:
+		return errContractCollateral
+
+	case !h.CollateralBudget.IsZero() && h.lockedCollateral().Add(contractCollateral(terms)).Cmp(h.CollateralBudget) > 0:
+		return errCollateralBudget
+
+	case len(terms.ValidProofOutputs) != 1 && len(terms.ValidProofOutputs) != 2:
 		return errors.New("payment len does not match host settings")
 
 	case terms.ValidProofOutputs[0].UnlockHash != h.UnlockHash:
 		return errors.New("payment output does not match host settings")
 
-	case len(terms.MissedProofOutputs) != 1:
+	case len(terms.MissedProofOutputs) != len(terms.ValidProofOutputs):
 		return errors.New("refund len does not match host settings")
 
 	case terms.MissedProofOutputs[0].UnlockHash != types.ZeroUnlockHash:
 		return errors.New("coins are not paying out to correct address")
+
+	// A download budget is held in a second output that returns to the
+	// renter whether or not the storage proof is successful.
+	case (len(terms.ValidProofOutputs) == 2) == terms.DownloadBudget.IsZero():
+		return errors.New("download budget does not match proof outputs")
+
+	case len(terms.ValidProofOutputs) == 2 && terms.ValidProofOutputs[1].UnlockHash != terms.MissedProofOutputs[1].UnlockHash:
+		return errors.New("download budget is not refunded to the same address")
 	}
 
 	return nil
@@ -84,8 +134,9 @@ func (h *Host) considerTerms(terms modules.ContractTerms) error {
 
 // verifyTransaction checks that the provided transaction matches the provided
 // contract terms, and that the Merkle root provided is equal to the merkle
-// root of the transaction file contract.
-func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, merkleRoot crypto.Hash) error {
+// root of the transaction file contract. The contract must be revisable using
+// 'unlockHash'.
+func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, merkleRoot crypto.Hash, unlockHash types.UnlockHash) error {
 	// Check that there is only one file contract.
 	if len(txn.FileContracts) != 1 {
 		return errors.New("transaction should have only one file contract.")
@@ -97,7 +148,7 @@ func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, merkl
 	durationCurrency := types.NewCurrency64(uint64(terms.Duration))
 	clientCost := terms.Price.Mul(sizeCurrency).Mul(durationCurrency)
 	hostCollateral := terms.Collateral.Mul(sizeCurrency).Mul(durationCurrency)
-	expectedPayout := clientCost.Add(hostCollateral)
+	expectedPayout := clientCost.Add(hostCollateral).Add(terms.DownloadBudget)
 
 	switch {
 	case fc.FileSize != terms.FileSize:
@@ -115,20 +166,31 @@ func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, merkl
 	case fc.Payout.Cmp(expectedPayout) != 0:
 		return errors.New("bad file contract payout")
 
-	case len(fc.ValidProofOutputs) != 1:
+	case len(fc.ValidProofOutputs) != len(terms.ValidProofOutputs):
 		return errors.New("bad file contract valid proof outputs")
 
-	case fc.ValidProofOutputs[0].UnlockHash != terms.ValidProofOutputs[0].UnlockHash:
-		return errors.New("bad file contract valid proof outputs")
-
-	case len(fc.MissedProofOutputs) != 1:
+	case len(fc.MissedProofOutputs) != len(terms.MissedProofOutputs):
 		return errors.New("bad file contract missed proof outputs")
 
-	case fc.MissedProofOutputs[0].UnlockHash != terms.MissedProofOutputs[0].UnlockHash:
-		return errors.New("bad file contract missed proof outputs")
+	case fc.UnlockHash != unlockHash:
+		return errors.New("bad file contract unlock hash")
+	}
 
-	case fc.UnlockHash != types.ZeroUnlockHash:
-		return errors.New("bad file contract termination hash")
+	for i, output := range fc.ValidProofOutputs {
+		if output.UnlockHash != terms.ValidProofOutputs[i].UnlockHash {
+			return errors.New("bad file contract valid proof outputs")
+		}
+	}
+	for i, output := range fc.MissedProofOutputs {
+		if output.UnlockHash != terms.MissedProofOutputs[i].UnlockHash {
+			return errors.New("bad file contract missed proof outputs")
+		}
+	}
+	// The renter's output can hold no more than the download budget.
+	if len(fc.ValidProofOutputs) == 2 {
+		if fc.ValidProofOutputs[1].Value.Cmp(terms.DownloadBudget) != 0 || fc.MissedProofOutputs[1].Value.Cmp(terms.DownloadBudget) != 0 {
+			return errors.New("bad file contract download budget")
+		}
 	}
 	return nil
 }
@@ -137,9 +199,7 @@ func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, merkl
 // collateral to the transaction.
 func (h *Host) addCollateral(txn types.Transaction, terms modules.ContractTerms) (fundedTxn types.Transaction, txnID string, err error) {
 	// Determine the amount of colletaral the host needs to provide.
-	sizeCurrency := types.NewCurrency64(terms.FileSize)
-	durationCurrency := types.NewCurrency64(uint64(terms.Duration))
-	collateral := terms.Collateral.Mul(sizeCurrency).Mul(durationCurrency)
+	collateral := contractCollateral(terms)
 
 	txnID, err = h.wallet.RegisterTransaction(txn)
 	if err != nil {
@@ -160,30 +220,49 @@ func (h *Host) addCollateral(txn types.Transaction, terms modules.ContractTerms)
 // submitting proofs of storage.
 func (h *Host) rpcContract(conn net.Conn) (err error) {
 	// Read the contract terms.
+	conn.SetDeadline(phaseDeadline())
 	var terms modules.ContractTerms
 	err = encoding.ReadObject(conn, &terms, maxContractLen)
 	if err != nil {
 		return
 	}
+	if !h.allowNegotiation(connIP(conn)) {
+		return encoding.WriteObject(conn, errNegotiationRate.Error())
+	}
 
 	// Consider the contract terms. If they are unacceptable, return an error
 	// describing why.
 	lockID := h.mu.RLock()
 	err = h.considerTerms(terms)
+	unlockConditions := modules.ContractUnlockConditions(terms.RenterKey, h.PublicKey)
 	h.mu.RUnlock(lockID)
 	if err != nil {
 		err = encoding.WriteObject(conn, err.Error())
 		return
 	}
 
-	// terms are acceptable; allocate space for file
+	// terms are acceptable; allocate space for file and reserve the
+	// collateral. The budget is checked again in case another contract was
+	// negotiated in the meantime.
+	collateral := contractCollateral(terms)
 	lockID = h.mu.Lock()
-	file, path, err := h.allocate(terms.FileSize)
+	if !h.CollateralBudget.IsZero() && h.lockedCollateral().Add(collateral).Cmp(h.CollateralBudget) > 0 {
+		h.mu.Unlock(lockID)
+		return encoding.WriteObject(conn, errCollateralBudget.Error())
+	}
+	path, err := h.reserve(terms.FileSize)
+	if err == nil {
+		h.reservedCollateral = h.reservedCollateral.Add(collateral)
+	}
 	h.mu.Unlock(lockID)
 	if err != nil {
-		return
+		return encoding.WriteObject(conn, err.Error())
 	}
-	defer file.Close()
+	defer func() {
+		lockID := h.mu.Lock()
+		h.reservedCollateral = h.reservedCollateral.Sub(collateral)
+		h.mu.Unlock(lockID)
+	}()
 
 	// rollback everything if something goes wrong
 	defer func() {
@@ -194,6 +273,13 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 		}
 	}()
 
+	file, err := h.createFile(path, terms.FileSize)
+	if err != nil {
+		encoding.WriteObject(conn, err.Error())
+		return
+	}
+	defer file.Close()
+
 	// signal that we are ready to download file
 	err = encoding.WriteObject(conn, modules.AcceptTermsResponse)
 	if err != nil {
@@ -201,6 +287,7 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 	}
 
 	// simultaneously download file and calculate its Merkle root.
+	conn.SetDeadline(transferDeadline(terms.FileSize))
 	tee := io.TeeReader(
 		// use a LimitedReader to ensure we don't read indefinitely
 		io.LimitReader(conn, int64(terms.FileSize)),
@@ -214,6 +301,7 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 
 	// Data has been sent, read in the unsigned transaction with the file
 	// contract.
+	conn.SetDeadline(phaseDeadline())
 	var unsignedTxn types.Transaction
 	err = encoding.ReadObject(conn, &unsignedTxn, maxContractLen)
 	if err != nil {
@@ -223,7 +311,7 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 	// Verify that the transaction matches the agreed upon terms, and that the
 	// Merkle root in the file contract matches our independently calculated
 	// Merkle root.
-	err = verifyTransaction(unsignedTxn, terms, merkleRoot)
+	err = verifyTransaction(unsignedTxn, terms, merkleRoot, unlockConditions.UnlockHash())
 	if err != nil {
 		err = errors.New("transaction does not satisfy terms: " + err.Error())
 		return
@@ -241,6 +329,7 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 
 	// Read in the renter-signed transaction and check that it matches the
 	// previously accepted transaction.
+	conn.SetDeadline(phaseDeadline())
 	var signedTxn types.Transaction
 	err = encoding.ReadObject(conn, &signedTxn, maxContractLen)
 	if err != nil {
@@ -270,20 +359,21 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 
 	// Add this contract to the host's list of obligations.
 	fcid := signedTxn.FileContractID(0)
-	fc := signedTxn.FileContracts[0]
-	proofHeight := fc.WindowStart + StorageProofReorgDepth
 	co := contractObligation{
-		ID:           fcid,
-		FileContract: fc,
-		Path:         path,
+		ID:               fcid,
+		FileContract:     signedTxn.FileContracts[0],
+		Path:             path,
+		UnlockConditions: unlockConditions,
 	}
 	lockID = h.mu.Lock()
-	h.obligationsByHeight[proofHeight] = append(h.obligationsByHeight[proofHeight], co)
 	h.obligationsByID[fcid] = co
+	h.recordContract(co, terms, fullTxn.ID())
+	h.contractsFormed++
 	h.save()
 	h.mu.Unlock(lockID)
 
 	// Send an ack to the renter that all is well.
+	conn.SetDeadline(phaseDeadline())
 	err = encoding.WriteObject(conn, true)
 	if err != nil {
 		return
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -16,7 +17,7 @@ func (ht *hostTester) testAllocation() {
 	const filesize = 4e3
 
 	// Allocate a 4kb file.
-	file, path, err := ht.host.allocate(filesize)
+	file, path, err := ht.allocate(filesize)
 	if err != nil {
 		ht.t.Fatal(err)
 	}
@@ -84,3 +85,64 @@ func TestConsiderTerms(t *testing.T) {
 	ht := CreateHostTester("TestConsiderTerms", t)
 	ht.testConsiderTerms()
 }
+
+// TestCollateralLimits checks that the host refuses contracts that would lock
+// more collateral than its limits allow.
+func TestCollateralLimits(t *testing.T) {
+	ht := CreateHostTester("TestCollateralLimits", t)
+	settings := ht.host.Settings()
+	settings.Collateral = types.NewCurrency64(1)
+	settings.MaxContractCollateral = types.NewCurrency64(60e3)
+	settings.CollateralBudget = types.NewCurrency64(90e3)
+	ht.host.SetSettings(settings)
+	terms := modules.ContractTerms{
+		FileSize:           4e3,
+		Duration:           12,
+		WindowSize:         settings.WindowSize,
+		Price:              settings.Price,
+		Collateral:         settings.Collateral,
+		ValidProofOutputs:  []types.SiacoinOutput{{UnlockHash: settings.UnlockHash}},
+		MissedProofOutputs: []types.SiacoinOutput{{UnlockHash: types.ZeroUnlockHash}},
+	}
+	considerTerms := func(terms modules.ContractTerms) error {
+		lockID := ht.host.mu.RLock()
+		defer ht.host.mu.RUnlock(lockID)
+		return ht.host.considerTerms(terms)
+	}
+
+	// 4e3 bytes for 12 blocks locks 48e3 hastings of collateral.
+	err := considerTerms(terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms.Duration = 16
+	err = considerTerms(terms)
+	if err != errContractCollateral {
+		t.Fatal("expected errContractCollateral, got", err)
+	}
+
+	// Lock collateral in an existing contract, leaving too little of the
+	// budget for another.
+	terms.Duration = 12
+	co := ht.addTestObligation(4e3)
+	lockID := ht.host.mu.Lock()
+	ht.host.recordContract(co, terms, crypto.Hash{})
+	ht.host.mu.Unlock(lockID)
+	err = considerTerms(terms)
+	if err != errCollateralBudget {
+		t.Fatal("expected errCollateralBudget, got", err)
+	}
+	info := ht.host.Info()
+	if info.CollateralLocked.Cmp(types.NewCurrency64(48e3)) != 0 || info.CollateralAvailable.Cmp(types.NewCurrency64(42e3)) > 0 {
+		t.Error("wrong collateral reported:", info.CollateralLocked, info.CollateralAvailable)
+	}
+
+	// Once the contract resolves, its collateral is available again.
+	lockID = ht.host.mu.Lock()
+	ht.host.deleteObligation(co)
+	ht.host.mu.Unlock(lockID)
+	err = considerTerms(terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
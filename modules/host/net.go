@@ -2,8 +2,21 @@ package host
 
 import (
 	"net"
+	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// rpcPhaseTimeout is the time allowed for each exchange of messages
+	// during an RPC.
+	rpcPhaseTimeout = 30 * time.Second
+
+	// minTransferRate is the slowest rate, in bytes per second, at which a
+	// renter may send or receive file data.
+	minTransferRate = 64e3
 )
 
 type rpcID [8]byte
@@ -12,21 +25,44 @@ var (
 	idSettings = rpcID{'S', 'e', 't', 't', 'i', 'n', 'g', 's'}
 	idContract = rpcID{'C', 'o', 'n', 't', 'r', 'a', 'c', 't'}
 	idRetrieve = rpcID{'R', 'e', 't', 'r', 'i', 'e', 'v', 'e'}
+	idRevise   = rpcID{'R', 'e', 'v', 'i', 's', 'e'}
 )
 
+// phaseDeadline returns the deadline for an exchange of messages that starts
+// now.
+func phaseDeadline() time.Time {
+	return time.Now().Add(rpcPhaseTimeout)
+}
+
+// transferDeadline returns the deadline for an exchange of messages that
+// includes 'size' bytes of file data.
+func transferDeadline(size uint64) time.Time {
+	return phaseDeadline().Add(time.Duration(size/minTransferRate) * time.Second)
+}
+
 // listen listens for incoming RPCs and spawns an appropriate handler for each.
+// Connections that exceed the host's connection limits are closed right away.
 func (h *Host) listen() {
 	for {
 		conn, err := h.listener.Accept()
 		if err != nil {
 			return
 		}
-		go h.handleConn(conn)
+		ip := connIP(conn)
+		if !h.openConnection(ip) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			h.handleConn(conn)
+			h.closeConnection(ip)
+		}()
 	}
 }
 
 func (h *Host) handleConn(conn net.Conn) {
 	defer conn.Close()
+	conn.SetDeadline(phaseDeadline())
 	var id rpcID
 	if err := encoding.ReadObject(conn, &id, 8); err != nil {
 		// log
@@ -39,11 +75,35 @@ func (h *Host) handleConn(conn net.Conn) {
 		h.rpcContract(conn)
 	case idRetrieve:
 		h.rpcRetrieve(conn)
+	case idRevise:
+		h.rpcRevise(conn)
 	default:
 		// log
 	}
 }
 
+// rpcSettings reads a random challenge from the caller and sends back the
+// host's settings, followed by the host's signature of the settings and the
+// challenge. The signature lets the caller check that the settings came from
+// the host that owns the announced public key, and the challenge keeps old
+// signatures from being replayed.
 func (h *Host) rpcSettings(conn net.Conn) error {
-	return encoding.WriteObject(conn, h.Settings())
+	var challenge crypto.Hash
+	err := encoding.ReadObject(conn, &challenge, crypto.HashSize)
+	if err != nil {
+		return err
+	}
+	lockID := h.mu.RLock()
+	settings := h.HostSettings
+	sk := h.secretKey
+	h.mu.RUnlock(lockID)
+	sig, err := crypto.SignHash(modules.SettingsChallengeHash(settings, challenge), sk)
+	if err != nil {
+		return err
+	}
+	err = encoding.WriteObject(conn, settings)
+	if err != nil {
+		return err
+	}
+	return encoding.WriteObject(conn, sig)
 }
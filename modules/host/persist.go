@@ -1,8 +1,13 @@
 package host
 
 import (
+	"io/ioutil"
+	"log"
+	"os"
 	"path/filepath"
+	"strconv"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
@@ -19,6 +24,28 @@ type savedHost struct {
 	Profit         types.Currency
 	HostSettings   modules.HostSettings
 	Obligations    []contractObligation
+	Contracts      []modules.ContractRecord
+	StorageFolders []storageFolder
+	SecretKey      crypto.SecretKey
+	PricingPolicy  modules.PricingPolicy
+	Announced      bool
+	AnnouncedPrice types.Currency
+	Maintenance    bool
+	CustomAddress  modules.NetAddress
+
+	ConnectionLimits modules.HostConnectionLimits
+	ScrubSettings    modules.ScrubSettings
+}
+
+// initLog opens the host's log file.
+func (h *Host) initLog() error {
+	logFile, err := os.OpenFile(filepath.Join(h.saveDir, "host.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return err
+	}
+	h.log = log.New(logFile, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	h.log.Println("INFO: Host logger opened, logging has started.")
+	return nil
 }
 
 func (h *Host) save() error {
@@ -28,10 +55,27 @@ func (h *Host) save() error {
 		Profit:         h.profit,
 		HostSettings:   h.HostSettings,
 		Obligations:    make([]contractObligation, 0, len(h.obligationsByID)),
+		Contracts:      make([]modules.ContractRecord, 0, len(h.contracts)),
+		StorageFolders: make([]storageFolder, 0, len(h.storageFolders)),
+		SecretKey:      h.secretKey,
+		PricingPolicy:  h.pricingPolicy,
+		Announced:      h.announced,
+		AnnouncedPrice: h.announcedPrice,
+		Maintenance:    h.maintenance,
+		CustomAddress:  h.customAddress,
+
+		ConnectionLimits: h.connectionLimits,
+		ScrubSettings:    h.scrubSettings,
 	}
 	for _, obligation := range h.obligationsByID {
 		sHost.Obligations = append(sHost.Obligations, obligation)
 	}
+	for _, cr := range h.contracts {
+		sHost.Contracts = append(sHost.Contracts, *cr)
+	}
+	for _, sf := range h.storageFolders {
+		sHost.StorageFolders = append(sHost.StorageFolders, *sf)
+	}
 
 	return persist.SaveFile(persistMetadata, sHost, filepath.Join(h.saveDir, "settings.json"))
 }
@@ -43,18 +87,96 @@ func (h *Host) load() error {
 		return err
 	}
 
+	// Hosts saved before revisions were supported have no keys, and keep the
+	// keys generated in New.
+	if sHost.SecretKey != (crypto.SecretKey{}) {
+		h.secretKey = sHost.SecretKey
+	} else {
+		sHost.HostSettings.PublicKey = h.PublicKey
+	}
+
 	h.spaceRemaining = sHost.HostSettings.TotalStorage
 	h.fileCounter = sHost.FileCounter
 	h.HostSettings = sHost.HostSettings
 	h.profit = sHost.Profit
+	h.pricingPolicy = sHost.PricingPolicy
+	h.announced = sHost.Announced
+	h.announcedPrice = sHost.AnnouncedPrice
+	h.maintenance = sHost.Maintenance
+	h.customAddress = sHost.CustomAddress
+	// Hosts saved before connection limits were added keep the defaults.
+	if sHost.ConnectionLimits != (modules.HostConnectionLimits{}) {
+		h.connectionLimits = sHost.ConnectionLimits
+	}
+	if sHost.ScrubSettings != (modules.ScrubSettings{}) {
+		h.scrubSettings = sHost.ScrubSettings
+	}
+	h.storageFolders = make([]*storageFolder, 0, len(sHost.StorageFolders))
+	for i := range sHost.StorageFolders {
+		sf := sHost.StorageFolders[i]
+		sf.SizeRemaining = sf.Size
+		h.storageFolders = append(h.storageFolders, &sf)
+	}
 	// recreate maps
+	for i := range sHost.Contracts {
+		cr := sHost.Contracts[i]
+		h.contracts[cr.ID] = &cr
+	}
 	for _, obligation := range sHost.Obligations {
-		height := obligation.FileContract.WindowStart + StorageProofReorgDepth
-		h.obligationsByHeight[height] = append(h.obligationsByHeight[height], obligation)
+		// The transaction pool is not saved, so a proof that was submitted
+		// but not confirmed before shutdown needs to be submitted again.
+		if obligation.Status == obligationProofSubmitted {
+			obligation.Status = obligationPending
+		}
 		h.obligationsByID[obligation.ID] = obligation
+		// Hosts saved before the contract ledger was added have no records
+		// for their obligations.
+		if _, exists := h.contracts[obligation.ID]; !exists {
+			h.contracts[obligation.ID] = &modules.ContractRecord{
+				ID:          obligation.ID,
+				FileSize:    obligation.FileContract.FileSize,
+				Payout:      obligation.FileContract.Payout,
+				WindowStart: obligation.FileContract.WindowStart,
+				WindowEnd:   obligation.FileContract.WindowEnd,
+				Outcome:     modules.ContractOutcomePending,
+			}
+		}
 		// update spaceRemaining
 		h.spaceRemaining -= int64(obligation.FileContract.FileSize)
+		if sf := h.storageFolder(filepath.Dir(obligation.Path)); sf != nil {
+			sf.SizeRemaining -= obligation.FileContract.FileSize
+		}
 	}
 
 	return nil
 }
+
+// removeOrphanedFiles deletes files in the host's save directory and storage
+// folders that do not belong to any obligation. Such files are left behind if
+// the host shuts down while a contract is being negotiated.
+func (h *Host) removeOrphanedFiles() {
+	inUse := make(map[string]bool)
+	for _, co := range h.obligationsByID {
+		inUse[h.filePath(co.Path)] = true
+	}
+	dirs := []string{h.saveDir}
+	for _, sf := range h.storageFolders {
+		dirs = append(dirs, sf.Path)
+	}
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			// Only files named by the host's file counter are considered.
+			if _, err := strconv.Atoi(info.Name()); err != nil || info.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, info.Name())
+			if !inUse[path] {
+				os.Remove(path)
+			}
+		}
+	}
+}
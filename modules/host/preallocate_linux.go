@@ -0,0 +1,20 @@
+package host
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate reserves 'size' bytes on disk for 'file', so that writing the
+// file cannot fail for lack of space. Filesystems that do not support
+// fallocate have the file filled with zeros instead.
+func preallocate(file *os.File, size uint64) error {
+	if size == 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, int64(size))
+	if err == syscall.EOPNOTSUPP {
+		return fillZeros(file, size)
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package host
+
+import (
+	"os"
+)
+
+// preallocate reserves 'size' bytes on disk for 'file', so that writing the
+// file cannot fail for lack of space.
+func preallocate(file *os.File, size uint64) error {
+	return fillZeros(file, size)
+}
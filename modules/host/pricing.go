@@ -0,0 +1,191 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// pricingInterval is the number of blocks between automatic price
+	// adjustments.
+	pricingInterval = 36 // 6 hours
+
+	// competitionSampleSize is the number of hosts sampled from the hostdb
+	// when estimating the prices of competing hosts.
+	competitionSampleSize = 8
+
+	// highDemand is the number of contracts that need to be formed between
+	// price adjustments for demand to be considered high.
+	highDemand = 5
+
+	// reannounceThreshold is the percentage by which the price needs to
+	// change since the host last announced itself before the host announces
+	// itself again, prompting renters to pick up the new price.
+	reannounceThreshold = 10
+)
+
+var errBadPricingBounds = errors.New("pricing policy minimum is greater than its maximum")
+
+// pricingInputs are the conditions that the host considers when adjusting its
+// price.
+type pricingInputs struct {
+	utilization     float64        // Fraction of the host's storage that is in use.
+	competition     types.Currency // Average price of competing hosts. Zero if unknown.
+	contractsFormed int            // Contracts formed since the last adjustment.
+}
+
+// averagePrice returns the average storage price of a set of hosts.
+func averagePrice(hosts []modules.HostSettings) types.Currency {
+	if len(hosts) == 0 {
+		return types.ZeroCurrency
+	}
+	var total types.Currency
+	for _, host := range hosts {
+		total = total.Add(host.Price)
+	}
+	return total.Div(types.NewCurrency64(uint64(len(hosts))))
+}
+
+// clamp returns c limited to the range [min, max].
+func clamp(c, min, max types.Currency) types.Currency {
+	if c.Cmp(min) < 0 {
+		return min
+	}
+	if c.Cmp(max) > 0 {
+		return max
+	}
+	return c
+}
+
+// adjustedPrice returns the price that the host should charge given the
+// current conditions. The price first moves a quarter of the way towards the
+// price of the competition. It is then raised when the host is nearly full or
+// many contracts are being formed, and lowered when the host is mostly empty
+// or no contracts are being formed.
+func adjustedPrice(price types.Currency, in pricingInputs) types.Currency {
+	if !in.competition.IsZero() {
+		if in.competition.Cmp(price) > 0 {
+			price = price.Add(in.competition.Sub(price).Div(types.NewCurrency64(4)))
+		} else {
+			price = price.Sub(price.Sub(in.competition).Div(types.NewCurrency64(4)))
+		}
+	}
+
+	percent := uint64(100)
+	if in.utilization > 0.9 {
+		percent += 10
+	} else if in.utilization < 0.25 {
+		percent -= 5
+	}
+	if in.contractsFormed >= highDemand {
+		percent += 5
+	} else if in.contractsFormed == 0 {
+		percent -= 5
+	}
+	return price.Mul(types.NewCurrency64(percent)).Div(types.NewCurrency64(100))
+}
+
+// significantChange returns true if 'newPrice' differs from 'oldPrice' by at
+// least reannounceThreshold percent.
+func significantChange(oldPrice, newPrice types.Currency) bool {
+	var diff types.Currency
+	if newPrice.Cmp(oldPrice) > 0 {
+		diff = newPrice.Sub(oldPrice)
+	} else {
+		diff = oldPrice.Sub(newPrice)
+	}
+	if diff.IsZero() {
+		return false
+	}
+	return diff.Mul(types.NewCurrency64(100)).Cmp(oldPrice.Mul(types.NewCurrency64(reannounceThreshold))) >= 0
+}
+
+// adjustPrices updates the host's price and collateral according to its
+// pricing policy. Collateral is scaled along with the price, so that the
+// ratio between the two is kept where the bounds allow it. adjustPrices is
+// called with the lock held.
+func (h *Host) adjustPrices(competition types.Currency) {
+	var utilization float64
+	if h.TotalStorage > 0 {
+		utilization = float64(h.TotalStorage-h.spaceRemaining) / float64(h.TotalStorage)
+	}
+	in := pricingInputs{
+		utilization:     utilization,
+		competition:     competition,
+		contractsFormed: h.contractsFormed,
+	}
+	h.contractsFormed = 0
+
+	policy := h.pricingPolicy
+	oldPrice, oldCollateral := h.Price, h.Collateral
+	newPrice := clamp(adjustedPrice(oldPrice, in), policy.MinPrice, policy.MaxPrice)
+	newCollateral := oldCollateral
+	if !oldPrice.IsZero() {
+		newCollateral = oldCollateral.Mul(newPrice).Div(oldPrice)
+	}
+	newCollateral = clamp(newCollateral, policy.MinCollateral, policy.MaxCollateral)
+	if newPrice.Cmp(oldPrice) == 0 && newCollateral.Cmp(oldCollateral) == 0 {
+		return
+	}
+
+	h.Price = newPrice
+	h.Collateral = newCollateral
+	h.log.Printf("INFO: adjusted price from %v to %v and collateral from %v to %v (utilization %.2f, competition %v, %v new contracts)\n",
+		oldPrice, newPrice, oldCollateral, newCollateral, in.utilization, in.competition, in.contractsFormed)
+	h.save()
+
+	if h.announced && significantChange(h.announcedPrice, newPrice) {
+		go h.threadedReannounce()
+	}
+}
+
+// threadedAdjustPrices estimates the prices of competing hosts and then
+// applies the host's pricing policy.
+func (h *Host) threadedAdjustPrices() {
+	competition := averagePrice(h.hostdb.RandomHosts(competitionSampleSize))
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if h.pricingPolicy.Enabled {
+		h.adjustPrices(competition)
+	}
+}
+
+// threadedReannounce announces the host again after a significant price
+// change.
+func (h *Host) threadedReannounce() {
+	lockID := h.mu.RLock()
+	addr := h.announceAddress()
+	h.mu.RUnlock(lockID)
+	err := h.announce(addr)
+	if err != nil {
+		h.log.Println("WARN: could not re-announce host after a price change:", err)
+	}
+}
+
+// PricingPolicy returns the policy that the host uses to adjust its prices.
+func (h *Host) PricingPolicy() modules.PricingPolicy {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.pricingPolicy
+}
+
+// SetPricingPolicy sets the policy that the host uses to adjust its prices.
+// The host's current prices are brought within the bounds of the policy right
+// away.
+func (h *Host) SetPricingPolicy(policy modules.PricingPolicy) error {
+	if policy.MinPrice.Cmp(policy.MaxPrice) > 0 || policy.MinCollateral.Cmp(policy.MaxCollateral) > 0 {
+		return errBadPricingBounds
+	}
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.pricingPolicy = policy
+	if policy.Enabled {
+		h.Price = clamp(h.Price, policy.MinPrice, policy.MaxPrice)
+		h.Collateral = clamp(h.Collateral, policy.MinCollateral, policy.MaxCollateral)
+	}
+	return h.save()
+}
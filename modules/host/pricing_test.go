@@ -0,0 +1,117 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestAdjustedPrice checks the price adjustments made for different market
+// conditions.
+func TestAdjustedPrice(t *testing.T) {
+	tests := []struct {
+		in    pricingInputs
+		price uint64
+	}{
+		// Moderate utilization and demand leave the price unchanged.
+		{pricingInputs{utilization: 0.5, contractsFormed: 1}, 1000},
+		// The price moves a quarter of the way towards the competition.
+		{pricingInputs{utilization: 0.5, contractsFormed: 1, competition: types.NewCurrency64(2000)}, 1250},
+		{pricingInputs{utilization: 0.5, contractsFormed: 1, competition: types.NewCurrency64(200)}, 800},
+		// A full host with high demand raises its price.
+		{pricingInputs{utilization: 0.95, contractsFormed: highDemand}, 1150},
+		// An empty host without demand lowers its price.
+		{pricingInputs{utilization: 0.1, contractsFormed: 0}, 900},
+	}
+	for i, test := range tests {
+		price := adjustedPrice(types.NewCurrency64(1000), test.in)
+		if price.Cmp(types.NewCurrency64(test.price)) != 0 {
+			t.Errorf("test %v: expected %v, got %v", i, test.price, price)
+		}
+	}
+}
+
+// TestSignificantChange checks which price changes cause the host to announce
+// itself again.
+func TestSignificantChange(t *testing.T) {
+	tests := []struct {
+		oldPrice, newPrice uint64
+		significant        bool
+	}{
+		{100, 100, false},
+		{100, 109, false},
+		{100, 110, true},
+		{100, 91, false},
+		{100, 90, true},
+		{0, 1, true},
+		{0, 0, false},
+	}
+	for _, test := range tests {
+		if significantChange(types.NewCurrency64(test.oldPrice), types.NewCurrency64(test.newPrice)) != test.significant {
+			t.Errorf("change from %v to %v: expected %v", test.oldPrice, test.newPrice, test.significant)
+		}
+	}
+}
+
+// TestAdjustPrices checks that the host keeps its prices within the bounds of
+// its pricing policy and scales its collateral along with its price.
+func TestAdjustPrices(t *testing.T) {
+	ht := CreateHostTester("TestAdjustPrices", t)
+
+	// The policy bounds cannot be inverted.
+	err := ht.host.SetPricingPolicy(modules.PricingPolicy{
+		MinPrice: types.NewCurrency64(2),
+		MaxPrice: types.NewCurrency64(1),
+	})
+	if err != errBadPricingBounds {
+		t.Fatal("expected errBadPricingBounds, got", err)
+	}
+
+	// Enabling the policy brings the prices within the bounds.
+	settings := ht.host.Settings()
+	settings.Price = types.NewCurrency64(1000)
+	settings.Collateral = types.NewCurrency64(100)
+	ht.host.SetSettings(settings)
+	err = ht.host.SetPricingPolicy(modules.PricingPolicy{
+		Enabled:       true,
+		MinPrice:      types.NewCurrency64(850),
+		MaxPrice:      types.NewCurrency64(2000),
+		MinCollateral: types.NewCurrency64(0),
+		MaxCollateral: types.NewCurrency64(1000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty host with no demand lowers its price, and its collateral
+	// follows.
+	lockID := ht.host.mu.Lock()
+	ht.host.adjustPrices(types.ZeroCurrency)
+	price, collateral := ht.host.Price, ht.host.Collateral
+	ht.host.mu.Unlock(lockID)
+	if price.Cmp(types.NewCurrency64(900)) != 0 || collateral.Cmp(types.NewCurrency64(90)) != 0 {
+		t.Fatalf("expected price 900 and collateral 90, got %v and %v", price, collateral)
+	}
+
+	// The price cannot drop below the policy's minimum.
+	lockID = ht.host.mu.Lock()
+	ht.host.adjustPrices(types.ZeroCurrency)
+	ht.host.adjustPrices(types.ZeroCurrency)
+	price = ht.host.Price
+	ht.host.mu.Unlock(lockID)
+	if price.Cmp(types.NewCurrency64(850)) != 0 {
+		t.Fatal("price dropped below the policy minimum:", price)
+	}
+
+	// Formed contracts count as demand until the next adjustment.
+	lockID = ht.host.mu.Lock()
+	ht.host.contractsFormed = highDemand
+	ht.host.adjustPrices(types.NewCurrency64(850))
+	price = ht.host.Price
+	contractsFormed := ht.host.contractsFormed
+	ht.host.mu.Unlock(lockID)
+	if price.Cmp(types.NewCurrency64(850)) != 0 || contractsFormed != 0 {
+		t.Fatal("demand was not counted correctly:", price, contractsFormed)
+	}
+}
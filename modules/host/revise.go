@@ -0,0 +1,445 @@
+package host
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errBadRenterSignature  = errors.New("revision is not signed by the renter key of the file contract")
+	errBadRevisionAction   = errors.New("revision contains an invalid action")
+	errBadRevisionPayouts  = errors.New("revision changes the payouts of the file contract")
+	errContractNotFound    = errors.New("no record of that file contract")
+	errContractRevising    = errors.New("file contract is already being revised")
+	errPaymentTooLate      = errors.New("file contract is too close to its proof window to accept payments")
+	errRevisionHardfork    = errors.New("file contracts cannot be revised until the revision hardfork")
+	errRevisionPayment     = errors.New("revision does not pay enough for the uploaded data")
+	errRevisionTooLate     = errors.New("file contract is too close to its proof window to be revised")
+	errUnrevisableContract = errors.New("file contract cannot be revised")
+
+	// renterCoveredFields are the fields covered by the renter's signature of
+	// a revision.
+	renterCoveredFields = types.CoveredFields{FileContractRevisions: []uint64{0}}
+)
+
+// revisedFileSize checks that each revision action can be applied to a file
+// of 'filesize' bytes, and returns the size of the file once all of the
+// actions have been applied.
+func revisedFileSize(filesize uint64, actions []modules.RevisionAction) (uint64, error) {
+	for _, action := range actions {
+		switch action.Type {
+		case modules.ActionAppend:
+			filesize += uint64(len(action.Data))
+		case modules.ActionTruncate:
+			if action.Offset > filesize {
+				return 0, errBadRevisionAction
+			}
+			filesize = action.Offset
+		case modules.ActionWrite:
+			if action.Offset > filesize || uint64(len(action.Data)) > filesize-action.Offset {
+				return 0, errBadRevisionAction
+			}
+		default:
+			return 0, errBadRevisionAction
+		}
+	}
+	return filesize, nil
+}
+
+// applyRevisionActions applies a set of revision actions to a file of
+// 'filesize' bytes. The actions must already have been checked by
+// revisedFileSize.
+func applyRevisionActions(file *os.File, filesize uint64, actions []modules.RevisionAction) (err error) {
+	for _, action := range actions {
+		switch action.Type {
+		case modules.ActionAppend:
+			_, err = file.WriteAt(action.Data, int64(filesize))
+			filesize += uint64(len(action.Data))
+		case modules.ActionTruncate:
+			err = file.Truncate(int64(action.Offset))
+			filesize = action.Offset
+		case modules.ActionWrite:
+			_, err = file.WriteAt(action.Data, int64(action.Offset))
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// verifyRevision checks that a file contract revision is a valid revision of
+// the obligation's contract for a file of 'filesize' bytes. The proof window,
+// unlock hash and output addresses of the contract cannot be changed. The
+// Merkle root and payouts are checked by the caller.
+func verifyRevision(co contractObligation, rev types.FileContractRevision, filesize uint64) error {
+	fc := co.FileContract
+	switch {
+	case rev.ParentID != co.ID:
+		return errors.New("revision is for the wrong file contract")
+
+	case rev.UnlockConditions.UnlockHash() != fc.UnlockHash:
+		return errors.New("bad revision unlock conditions")
+
+	case rev.NewRevisionNumber <= fc.RevisionNumber:
+		return errors.New("revision number was not increased")
+
+	case rev.NewFileSize != filesize:
+		return errors.New("bad revision file size")
+
+	case rev.NewWindowStart != fc.WindowStart || rev.NewWindowEnd != fc.WindowEnd:
+		return errors.New("revision cannot change the proof window")
+
+	case rev.NewUnlockHash != fc.UnlockHash:
+		return errors.New("revision cannot change the unlock hash")
+
+	case len(rev.NewValidProofOutputs) != len(fc.ValidProofOutputs):
+		return errors.New("bad revision valid proof outputs")
+
+	case len(rev.NewMissedProofOutputs) != len(fc.MissedProofOutputs):
+		return errors.New("bad revision missed proof outputs")
+	}
+
+	for i, output := range rev.NewValidProofOutputs {
+		if output.UnlockHash != fc.ValidProofOutputs[i].UnlockHash {
+			return errors.New("bad revision valid proof outputs")
+		}
+	}
+	for i, output := range rev.NewMissedProofOutputs {
+		if output.UnlockHash != fc.MissedProofOutputs[i].UnlockHash {
+			return errors.New("bad revision missed proof outputs")
+		}
+	}
+	return nil
+}
+
+// verifyPayouts checks that the payouts of a revision are those of 'fc',
+// except that at least 'payment' has been moved from the renter's download
+// budget to the host. The budget is held in the second valid and missed proof
+// outputs, and the payment is moved to the first output of each, so that the
+// renter cannot take back a payment, or the collateral burned by a missed
+// storage proof, by changing the missed proof outputs.
+func verifyPayouts(fc types.FileContract, rev types.FileContractRevision, payment types.Currency) error {
+	oldPayment := fc.ValidProofOutputs[0].Value
+	newPayment := rev.NewValidProofOutputs[0].Value
+	if newPayment.Cmp(oldPayment) < 0 {
+		return errors.New("revision reduces the payment to the host")
+	}
+	shift := newPayment.Sub(oldPayment)
+	if shift.Cmp(payment) < 0 {
+		return errRevisionPayment
+	}
+	if !shift.IsZero() && len(fc.ValidProofOutputs) < 2 {
+		return errors.New("file contract has no download budget")
+	}
+
+	outputs := [][2][]types.SiacoinOutput{
+		{fc.ValidProofOutputs, rev.NewValidProofOutputs},
+		{fc.MissedProofOutputs, rev.NewMissedProofOutputs},
+	}
+	for _, o := range outputs {
+		for i, output := range o[0] {
+			expected := output.Value
+			switch i {
+			case 0:
+				expected = expected.Add(shift)
+			case 1:
+				if expected.Cmp(shift) < 0 {
+					return errors.New("payment exceeds the download budget")
+				}
+				expected = expected.Sub(shift)
+			}
+			if o[1][i].Value.Cmp(expected) != 0 {
+				return errBadRevisionPayouts
+			}
+		}
+	}
+	return nil
+}
+
+// verifyRenterSignature checks that 'sig' is the renter's signature of a
+// revision of the obligation's contract.
+func verifyRenterSignature(co contractObligation, rev types.FileContractRevision, sig types.TransactionSignature) error {
+	pk, err := renterKey(co)
+	if err != nil {
+		return err
+	}
+	if sig.ParentID != crypto.Hash(co.ID) || sig.PublicKeyIndex != 0 || sig.Timelock != 0 ||
+		!bytes.Equal(encoding.Marshal(sig.CoveredFields), encoding.Marshal(renterCoveredFields)) ||
+		len(sig.Signature) != crypto.SignatureSize {
+		return errBadRenterSignature
+	}
+	txn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev},
+		TransactionSignatures: []types.TransactionSignature{sig},
+	}
+	var cryptoSig crypto.Signature
+	copy(cryptoSig[:], sig.Signature)
+	if crypto.VerifyHash(txn.SigHash(0), pk, cryptoSig) != nil {
+		return errBadRenterSignature
+	}
+	return nil
+}
+
+// markRevising marks an obligation as being revised, returning an error if
+// the obligation cannot be revised. Revisions are refused with 'tooLate' once
+// the proof window of the contract is less than 'margin' blocks away.
+func (h *Host) markRevising(fcid types.FileContractID, margin types.BlockHeight, tooLate error) (contractObligation, error) {
+	co, exists := h.obligationsByID[fcid]
+	switch {
+	case !exists:
+		return contractObligation{}, errContractNotFound
+	case co.FileContract.UnlockHash != co.UnlockConditions.UnlockHash():
+		return contractObligation{}, errUnrevisableContract
+	case h.revising[fcid]:
+		return contractObligation{}, errContractRevising
+	case h.blockHeight < types.RevisionPayoutHardforkHeight:
+		return contractObligation{}, errRevisionHardfork
+	case h.blockHeight+margin > co.FileContract.WindowStart:
+		return contractObligation{}, tooLate
+	}
+	h.revising[fcid] = true
+	return co, nil
+}
+
+// startRevision marks an obligation as being revised by the Revise RPC.
+// Revisions that change the file are only accepted until
+// StorageProofReorgDepth blocks before the proof window opens, which gives the
+// revision time to make it into the blockchain before the host has to prove
+// storage of the revised file.
+func (h *Host) startRevision(fcid types.FileContractID) (contractObligation, error) {
+	return h.markRevising(fcid, StorageProofReorgDepth, errRevisionTooLate)
+}
+
+// startPayment marks an obligation as being revised by the payments of a paid
+// download. Payments do not change the file, so they are accepted until the
+// block before the proof window opens. A payment that does not make it into
+// the blockchain only costs the host that payment.
+func (h *Host) startPayment(fcid types.FileContractID) (contractObligation, error) {
+	return h.markRevising(fcid, 1, errPaymentTooLate)
+}
+
+// writeRevisedFile copies the file of an obligation into 'file' and applies
+// the revision actions, returning the Merkle root of the revised file.
+func (h *Host) writeRevisedFile(file *os.File, co contractObligation, filesize uint64, actions []modules.RevisionAction) (merkleRoot crypto.Hash, err error) {
+	original, err := os.Open(h.filePath(co.Path))
+	if err != nil {
+		return
+	}
+	defer original.Close()
+	_, err = io.CopyN(file, original, int64(co.FileContract.FileSize))
+	if err != nil {
+		return
+	}
+	err = applyRevisionActions(file, co.FileContract.FileSize, actions)
+	if err != nil {
+		return
+	}
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return
+	}
+	return crypto.ReaderMerkleRoot(io.LimitReader(file, int64(filesize)))
+}
+
+// rpcRevise is an RPC that modifies the file of an existing file contract.
+// Like rpcRetrieve, the host first challenges the renter to sign a random
+// challenge with the renter key of the contract. The host then replies with
+// the AcceptTermsResponse and its price per uploaded byte. The renter sends a
+// set of revision actions followed by a file contract revision that pays for
+// the uploaded data, and the renter's signature of the revision. The revision
+// and signature are checked before anything is written to disk. The actions
+// are then applied to a copy of the file, and if the revision matches the
+// revised file, the host signs the revision and submits it to the transaction
+// pool. The copy then replaces the original file.
+//
+// The lock is not held while the file is being copied.
+func (h *Host) rpcRevise(conn net.Conn) (err error) {
+	conn.SetDeadline(phaseDeadline())
+	var fcid types.FileContractID
+	err = encoding.ReadObject(conn, &fcid, crypto.HashSize)
+	if err != nil {
+		return
+	}
+	if !h.allowNegotiation(connIP(conn)) {
+		return encoding.WriteObject(conn, errNegotiationRate.Error())
+	}
+	challenge, sig, err := readChallengeResponse(conn)
+	if err != nil {
+		return
+	}
+
+	// Check that the renter answered the challenge and that the contract can
+	// be revised. If it cannot, return an error describing why. Uploaded data
+	// is paid for at the storage price for the rest of the contract.
+	lockID := h.mu.Lock()
+	co, exists := h.obligationsByID[fcid]
+	if !exists {
+		err = errContractNotFound
+	} else {
+		err = verifyChallenge(co, challenge, sig)
+	}
+	if err == nil {
+		co, err = h.startRevision(fcid)
+	}
+	var price types.Currency
+	if err == nil {
+		price = h.Price.Mul(types.NewCurrency64(uint64(co.FileContract.WindowStart - h.blockHeight)))
+	}
+	maxActionsLen := h.MaxFilesize + maxContractLen
+	h.mu.Unlock(lockID)
+	if err != nil {
+		return encoding.WriteObject(conn, err.Error())
+	}
+	defer func() {
+		lockID := h.mu.Lock()
+		delete(h.revising, fcid)
+		h.mu.Unlock(lockID)
+	}()
+	err = encoding.WriteObject(conn, modules.AcceptTermsResponse)
+	if err != nil {
+		return
+	}
+	err = encoding.WriteObject(conn, price)
+	if err != nil {
+		return
+	}
+
+	// Read the revision actions, the revision, and the renter's signature.
+	conn.SetDeadline(transferDeadline(maxActionsLen))
+	var actions []modules.RevisionAction
+	err = encoding.ReadObject(conn, &actions, maxActionsLen)
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(phaseDeadline())
+	var rev types.FileContractRevision
+	err = encoding.ReadObject(conn, &rev, maxContractLen)
+	if err != nil {
+		return
+	}
+	var renterSig types.TransactionSignature
+	err = encoding.ReadObject(conn, &renterSig, maxContractLen)
+	if err != nil {
+		return
+	}
+
+	// Check the revision before touching the disk.
+	filesize, err := revisedFileSize(co.FileContract.FileSize, actions)
+	if err != nil {
+		return
+	}
+	err = verifyRevision(co, rev, filesize)
+	if err == nil {
+		payment := price.Mul(types.NewCurrency64(modules.RevisionUploadSize(actions)))
+		err = verifyPayouts(co.FileContract, rev, payment)
+	}
+	if err == nil {
+		err = verifyRenterSignature(co, rev, renterSig)
+	}
+	if err != nil {
+		err = errors.New("bad revision: " + err.Error())
+		return
+	}
+
+	// Allocate space for the revised file.
+	lockID = h.mu.Lock()
+	if filesize > h.MaxFilesize {
+		err = errors.New("file is too large")
+	} else if filesize > co.FileContract.FileSize && int64(filesize-co.FileContract.FileSize) > h.spaceRemaining {
+		err = HostCapacityErr
+	}
+	var path string
+	if err == nil {
+		path, err = h.reserve(filesize)
+	}
+	h.mu.Unlock(lockID)
+	if err != nil {
+		return
+	}
+
+	// rollback everything if something goes wrong
+	defer func() {
+		lockID := h.mu.Lock()
+		defer h.mu.Unlock(lockID)
+		if err != nil {
+			h.deallocate(filesize, path)
+		}
+	}()
+
+	file, err := h.createFile(path, filesize)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	merkleRoot, err := h.writeRevisedFile(file, co, filesize, actions)
+	if err != nil {
+		return
+	}
+	if merkleRoot != rev.NewFileMerkleRoot {
+		err = errors.New("revision does not match the revised file")
+		return
+	}
+
+	// Add the host's signature and submit the revision.
+	txn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev},
+		TransactionSignatures: []types.TransactionSignature{
+			renterSig,
+			{
+				ParentID:       crypto.Hash(fcid),
+				CoveredFields:  types.CoveredFields{WholeTransaction: true},
+				PublicKeyIndex: 1,
+			},
+		},
+	}
+	hostSig, err := crypto.SignHash(txn.SigHash(1), h.secretKey)
+	if err != nil {
+		return
+	}
+	txn.TransactionSignatures[1].Signature = hostSig[:]
+	err = h.tpool.AcceptTransaction(txn)
+	if err != nil {
+		return
+	}
+	// Replace the original file with the revised file. The original file is
+	// looked up again in case it was moved to another storage folder.
+	lockID = h.mu.Lock()
+	current, exists := h.obligationsByID[fcid]
+	if exists {
+		h.deallocate(current.FileContract.FileSize, current.Path)
+		current.FileContract.FileSize = rev.NewFileSize
+		current.FileContract.FileMerkleRoot = rev.NewFileMerkleRoot
+		current.FileContract.ValidProofOutputs = rev.NewValidProofOutputs
+		current.FileContract.MissedProofOutputs = rev.NewMissedProofOutputs
+		current.FileContract.RevisionNumber = rev.NewRevisionNumber
+		current.Path = path
+		h.obligationsByID[fcid] = current
+		h.recordTransaction(fcid, txn.ID())
+		if cr, exists := h.contracts[fcid]; exists {
+			cr.FileSize = rev.NewFileSize
+		}
+		h.save()
+	} else {
+		err = errContractNotFound
+	}
+	h.mu.Unlock(lockID)
+	if err != nil {
+		return
+	}
+
+	// TODO: we don't currently watch the blockchain to make sure that the
+	// revision actually gets into the blockchain.
+
+	conn.SetDeadline(phaseDeadline())
+	return encoding.WriteObject(conn, txn)
+}
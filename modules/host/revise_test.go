@@ -0,0 +1,378 @@
+package host
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// addRevisableObligation puts a file contract for 'data' into the transaction
+// pool and adds an obligation for it to the host. The contract can be revised
+// by the host and 'renterKey', and has a download budget of 1e6 hastings.
+func (ht *hostTester) addRevisableObligation(data []byte, renterKey types.SiaPublicKey) contractObligation {
+	merkleRoot, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	unlockConditions := modules.ContractUnlockConditions(renterKey, ht.host.PublicKey)
+	fc := types.FileContract{
+		FileSize:       uint64(len(data)),
+		FileMerkleRoot: merkleRoot,
+		WindowStart:    ht.cs.Height() + 40,
+		WindowEnd:      ht.cs.Height() + 60,
+		Payout:         types.NewCurrency64(1e7),
+		UnlockHash:     unlockConditions.UnlockHash(),
+	}
+	downloadBudget := types.SiacoinOutput{Value: types.NewCurrency64(1e6), UnlockHash: types.UnlockHash{1}}
+	outputValue := fc.Payout.Sub(fc.Tax()).Sub(downloadBudget.Value)
+	fc.ValidProofOutputs = []types.SiacoinOutput{{Value: outputValue, UnlockHash: ht.host.UnlockHash}, downloadBudget}
+	fc.MissedProofOutputs = []types.SiacoinOutput{{Value: outputValue, UnlockHash: types.ZeroUnlockHash}, downloadBudget}
+
+	// Create the file contract.
+	id, err := ht.wallet.RegisterTransaction(types.Transaction{})
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	_, err = ht.wallet.FundTransaction(id, fc.Payout)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	ht.tpUpdateWait()
+	_, _, err = ht.wallet.AddFileContract(id, fc)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	txn, err := ht.wallet.SignTransaction(id, true)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	err = ht.tpool.AcceptTransaction(txn)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	ht.tpUpdateWait()
+
+	// Store the file and add the obligation.
+	file, path, err := ht.allocate(fc.FileSize)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	lockID := ht.host.mu.Lock()
+	defer ht.host.mu.Unlock(lockID)
+	_, err = file.Write(data)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	file.Close()
+	co := contractObligation{
+		ID:               txn.FileContractID(0),
+		FileContract:     fc,
+		Path:             path,
+		UnlockConditions: unlockConditions,
+	}
+	ht.host.obligationsByID[co.ID] = co
+	return co
+}
+
+// payRevision moves 'payment' from the download budget of 'fc' to the host in
+// the payouts of 'rev'.
+func payRevision(rev types.FileContractRevision, fc types.FileContract, payment types.Currency) types.FileContractRevision {
+	rev.NewValidProofOutputs = []types.SiacoinOutput{
+		{Value: fc.ValidProofOutputs[0].Value.Add(payment), UnlockHash: fc.ValidProofOutputs[0].UnlockHash},
+		{Value: fc.ValidProofOutputs[1].Value.Sub(payment), UnlockHash: fc.ValidProofOutputs[1].UnlockHash},
+	}
+	rev.NewMissedProofOutputs = []types.SiacoinOutput{
+		{Value: fc.MissedProofOutputs[0].Value.Add(payment), UnlockHash: fc.MissedProofOutputs[0].UnlockHash},
+		{Value: fc.MissedProofOutputs[1].Value.Sub(payment), UnlockHash: fc.MissedProofOutputs[1].UnlockHash},
+	}
+	return rev
+}
+
+// reviseObligation acts as a renter calling the Revise RPC on the host. The
+// host's challenge is signed using 'challengeKey', and the revision is signed
+// using 'revisionKey'. The fully signed revision transaction sent back by the
+// host is returned.
+func (ht *hostTester) reviseObligation(rev types.FileContractRevision, actions []modules.RevisionAction, challengeKey, revisionKey crypto.SecretKey) (txn types.Transaction, err error) {
+	conn, hostConn := net.Pipe()
+	defer conn.Close()
+	go func() {
+		ht.host.rpcRevise(hostConn)
+		hostConn.Close()
+	}()
+
+	err = encoding.WriteObject(conn, rev.ParentID)
+	if err != nil {
+		return
+	}
+	var challenge crypto.Hash
+	err = encoding.ReadObject(conn, &challenge, crypto.HashSize)
+	if err != nil {
+		return
+	}
+	challengeSig, err := crypto.SignHash(modules.RetrieveChallengeHash(rev.ParentID, challenge), challengeKey)
+	if err != nil {
+		return
+	}
+	err = encoding.WriteObject(conn, challengeSig)
+	if err != nil {
+		return
+	}
+	var response string
+	err = encoding.ReadObject(conn, &response, 128)
+	if err != nil {
+		return
+	}
+	if response != modules.AcceptTermsResponse {
+		return txn, errors.New(response)
+	}
+	var price types.Currency
+	err = encoding.ReadObject(conn, &price, maxContractLen)
+	if err != nil {
+		return
+	}
+	err = encoding.WriteObject(conn, actions)
+	if err != nil {
+		return
+	}
+
+	// Sign and send the revision.
+	renterTxn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev},
+		TransactionSignatures: []types.TransactionSignature{{
+			ParentID:       crypto.Hash(rev.ParentID),
+			CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+			PublicKeyIndex: 0,
+		}},
+	}
+	sig, err := crypto.SignHash(renterTxn.SigHash(0), revisionKey)
+	if err != nil {
+		return
+	}
+	renterTxn.TransactionSignatures[0].Signature = sig[:]
+	err = encoding.WriteObject(conn, rev)
+	if err != nil {
+		return
+	}
+	err = encoding.WriteObject(conn, renterTxn.TransactionSignatures[0])
+	if err != nil {
+		return
+	}
+
+	err = encoding.ReadObject(conn, &txn, maxContractLen)
+	return
+}
+
+// TestRevisedFileSize checks that revisedFileSize rejects actions that do not
+// fit the file.
+func TestRevisedFileSize(t *testing.T) {
+	tests := []struct {
+		actions []modules.RevisionAction
+		size    uint64
+		err     error
+	}{
+		{[]modules.RevisionAction{{Type: modules.ActionAppend, Data: make([]byte, 5)}}, 15, nil},
+		{[]modules.RevisionAction{{Type: modules.ActionTruncate, Offset: 4}}, 4, nil},
+		{[]modules.RevisionAction{{Type: modules.ActionTruncate, Offset: 11}}, 0, errBadRevisionAction},
+		{[]modules.RevisionAction{{Type: modules.ActionWrite, Offset: 5, Data: make([]byte, 5)}}, 10, nil},
+		{[]modules.RevisionAction{{Type: modules.ActionWrite, Offset: 6, Data: make([]byte, 5)}}, 0, errBadRevisionAction},
+		{[]modules.RevisionAction{{Type: modules.ActionWrite, Offset: 1 << 63, Data: make([]byte, 5)}}, 0, errBadRevisionAction},
+		{[]modules.RevisionAction{{Type: types.Specifier{'b', 'a', 'd'}}}, 0, errBadRevisionAction},
+	}
+	for i, test := range tests {
+		size, err := revisedFileSize(10, test.actions)
+		if err != test.err || size != test.size {
+			t.Errorf("test %v: expected (%v, %v), got (%v, %v)", i, test.size, test.err, size, err)
+		}
+	}
+}
+
+// TestRevise revises the file of an obligation and checks that the host
+// updates the file and the obligation, and that bad revisions are rejected
+// before anything is written to disk.
+func TestRevise(t *testing.T) {
+	ht := CreateHostTester("TestRevise", t)
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renterKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	data := make([]byte, 4e3)
+	rand.Read(data)
+	co := ht.addRevisableObligation(data, renterKey)
+	ht.mineBlock()
+
+	// Replace the start of the file, append to the file, and then cut off
+	// part of the appended data.
+	actions := []modules.RevisionAction{
+		{Type: modules.ActionWrite, Offset: 0, Data: []byte("revised")},
+		{Type: modules.ActionAppend, Data: bytes.Repeat([]byte{1}, 1e3)},
+		{Type: modules.ActionTruncate, Offset: 4500},
+	}
+	revised := append([]byte("revised"), data[7:]...)
+	revised = append(revised, bytes.Repeat([]byte{1}, 500)...)
+	merkleRoot, err := crypto.ReaderMerkleRoot(bytes.NewReader(revised))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The renter pays for every uploaded byte, at the storage price for the
+	// rest of the contract.
+	lockID := ht.host.mu.Lock()
+	ht.host.Price = types.NewCurrency64(1)
+	ht.host.mu.Unlock(lockID)
+	fc := co.FileContract
+	payment := types.NewCurrency64(uint64(fc.WindowStart-ht.cs.Height()) * modules.RevisionUploadSize(actions))
+	unpaidRev := types.FileContractRevision{
+		ParentID:              co.ID,
+		UnlockConditions:      co.UnlockConditions,
+		NewRevisionNumber:     fc.RevisionNumber + 1,
+		NewFileSize:           uint64(len(revised)),
+		NewFileMerkleRoot:     merkleRoot,
+		NewWindowStart:        fc.WindowStart,
+		NewWindowEnd:          fc.WindowEnd,
+		NewValidProofOutputs:  fc.ValidProofOutputs,
+		NewMissedProofOutputs: fc.MissedProofOutputs,
+		NewUnlockHash:         fc.UnlockHash,
+	}
+	rev := payRevision(unpaidRev, fc, payment)
+
+	wrongKey, _, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spaceRemaining := ht.host.spaceRemaining
+
+	// A renter that cannot sign the challenge should be turned away.
+	_, err = ht.reviseObligation(rev, actions, wrongKey, sk)
+	if err == nil || err.Error() != errBadChallengeSignature.Error() {
+		t.Fatal("expected errBadChallengeSignature, got", err)
+	}
+
+	// A revision with the wrong Merkle root should be rejected.
+	badRev := rev
+	badRev.NewFileMerkleRoot = crypto.Hash{}
+	_, err = ht.reviseObligation(badRev, actions, sk, sk)
+	if err == nil {
+		t.Fatal("revision with a bad Merkle root was accepted")
+	}
+
+	// A revision that does not pay for the uploaded data should be rejected.
+	_, err = ht.reviseObligation(unpaidRev, actions, sk, sk)
+	if err == nil {
+		t.Fatal("unpaid revision was accepted")
+	}
+
+	// A revision that moves the burned collateral to the renter should be
+	// rejected.
+	badRev = payRevision(unpaidRev, fc, payment)
+	badRev.NewMissedProofOutputs = []types.SiacoinOutput{
+		{Value: types.ZeroCurrency, UnlockHash: fc.MissedProofOutputs[0].UnlockHash},
+		{Value: fc.MissedProofOutputs[0].Value.Add(fc.MissedProofOutputs[1].Value), UnlockHash: fc.MissedProofOutputs[1].UnlockHash},
+	}
+	_, err = ht.reviseObligation(badRev, actions, sk, sk)
+	if err == nil {
+		t.Fatal("revision that changes the missed proof outputs was accepted")
+	}
+
+	// A revision that is not signed by the renter should be rejected.
+	_, err = ht.reviseObligation(rev, actions, sk, wrongKey)
+	if err == nil {
+		t.Fatal("revision with a bad renter signature was accepted")
+	}
+	if ht.host.spaceRemaining != spaceRemaining {
+		t.Error("space was not released after failed revisions")
+	}
+
+	// Submit the correct revision.
+	txn, err := ht.reviseObligation(rev, actions, sk, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.tpUpdateWait()
+	if len(txn.TransactionSignatures) != 2 {
+		t.Fatal("host did not sign the revision")
+	}
+	inPool := false
+	for _, poolTxn := range ht.tpool.TransactionSet() {
+		if poolTxn.ID() == txn.ID() {
+			inPool = true
+		}
+	}
+	if !inPool {
+		t.Error("revision was not submitted to the transaction pool")
+	}
+
+	// Check that the obligation and the file were updated.
+	lockID = ht.host.mu.RLock()
+	revisedCO := ht.host.obligationsByID[co.ID]
+	ht.host.mu.RUnlock(lockID)
+	if revisedCO.FileContract.FileMerkleRoot != merkleRoot || revisedCO.FileContract.FileSize != 4500 || revisedCO.FileContract.RevisionNumber != 1 {
+		t.Error("obligation was not updated to match the revision")
+	}
+	if revisedCO.FileContract.ValidProofOutputs[0].Value.Cmp(rev.NewValidProofOutputs[0].Value) != 0 {
+		t.Error("obligation does not include the payment")
+	}
+	contents, err := ioutil.ReadFile(ht.host.filePath(revisedCO.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, revised) {
+		t.Error("revised file has the wrong contents")
+	}
+	if ht.host.spaceRemaining != spaceRemaining-500 {
+		t.Error("space remaining was not updated after the revision")
+	}
+
+	// The revision should make it into the blockchain.
+	ht.mineBlock()
+	if len(ht.tpool.TransactionSet()) != 0 {
+		t.Error("revision was not put into a block")
+	}
+}
+
+// TestVerifyPayouts checks that a revision may only move coins from the
+// download budget to the host, in both the valid and missed proof outputs.
+func TestVerifyPayouts(t *testing.T) {
+	fc := types.FileContract{
+		ValidProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(100), UnlockHash: types.UnlockHash{1}},
+			{Value: types.NewCurrency64(50), UnlockHash: types.UnlockHash{2}},
+		},
+		MissedProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(100), UnlockHash: types.ZeroUnlockHash},
+			{Value: types.NewCurrency64(50), UnlockHash: types.UnlockHash{2}},
+		},
+	}
+	paid := payRevision(types.FileContractRevision{}, fc, types.NewCurrency64(10))
+	if err := verifyPayouts(fc, paid, types.NewCurrency64(10)); err != nil {
+		t.Error("payment was rejected:", err)
+	}
+	if err := verifyPayouts(fc, paid, types.NewCurrency64(11)); err != errRevisionPayment {
+		t.Error("expected errRevisionPayment, got", err)
+	}
+
+	// Moving the burned collateral to the renter should be rejected.
+	stolen := payRevision(types.FileContractRevision{}, fc, types.NewCurrency64(10))
+	stolen.NewMissedProofOutputs = []types.SiacoinOutput{
+		{Value: types.NewCurrency64(10), UnlockHash: types.ZeroUnlockHash},
+		{Value: types.NewCurrency64(140), UnlockHash: types.UnlockHash{2}},
+	}
+	if err := verifyPayouts(fc, stolen, types.NewCurrency64(10)); err != errBadRevisionPayouts {
+		t.Error("expected errBadRevisionPayouts, got", err)
+	}
+
+	// Paying more than the budget should be rejected.
+	over := payRevision(types.FileContractRevision{}, fc, types.NewCurrency64(10))
+	over.NewValidProofOutputs[0].Value = types.NewCurrency64(160)
+	if err := verifyPayouts(fc, over, types.ZeroCurrency); err == nil {
+		t.Error("payment exceeding the budget was accepted")
+	}
+}
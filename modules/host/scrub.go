@@ -0,0 +1,151 @@
+package host
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// defaultScrubSettings are the scrub settings used by a new host.
+	defaultScrubSettings = modules.ScrubSettings{
+		Enabled:  true,
+		Interval: 1008, // 1 week
+		ReadRate: 4e6,  // 4 MB/s
+	}
+
+	errBadScrubSettings = errors.New("scrub interval and read rate must be positive")
+)
+
+// A throttledReader limits the rate at which data is read from a reader.
+type throttledReader struct {
+	r     io.Reader
+	rate  uint64 // bytes per second
+	read  uint64
+	start time.Time
+}
+
+// Read reads from the underlying reader, sleeping as long as needed to keep
+// the average read rate below the limit.
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if uint64(len(p)) > tr.rate {
+		p = p[:tr.rate]
+	}
+	n, err := tr.r.Read(p)
+	tr.read += uint64(n)
+	expected := time.Duration(float64(tr.read) / float64(tr.rate) * float64(time.Second))
+	if elapsed := time.Since(tr.start); elapsed < expected {
+		time.Sleep(expected - elapsed)
+	}
+	return n, err
+}
+
+// scrubFile recomputes the Merkle root of the file of an obligation, reading
+// at most 'rate' bytes per second. If the file does not match its contract,
+// a description of the corruption is returned along with false.
+func (h *Host) scrubFile(co contractObligation, rate uint64) (modules.CorruptFile, bool) {
+	cf := modules.CorruptFile{
+		ContractID:   co.ID,
+		Path:         h.filePath(co.Path),
+		ExpectedRoot: co.FileContract.FileMerkleRoot,
+	}
+	file, err := os.Open(cf.Path)
+	if err != nil {
+		cf.Error = err.Error()
+		return cf, false
+	}
+	defer file.Close()
+
+	// A file that is shorter than its contract produces a different root, so
+	// it does not need to be checked separately.
+	tr := &throttledReader{
+		r:     io.LimitReader(file, int64(co.FileContract.FileSize)),
+		rate:  rate,
+		start: time.Now(),
+	}
+	cf.Root, err = crypto.ReaderMerkleRoot(tr)
+	if err != nil {
+		cf.Error = err.Error()
+		return cf, false
+	}
+	return cf, cf.Root == cf.ExpectedRoot
+}
+
+// threadedScrub checks the file of every obligation against the Merkle root
+// of its file contract, recording and logging the files that do not match. The
+// lock is not held while files are being read.
+func (h *Host) threadedScrub() {
+	lockID := h.mu.Lock()
+	obligations := make([]contractObligation, 0, len(h.obligationsByID))
+	for _, co := range h.obligationsByID {
+		obligations = append(obligations, co)
+	}
+	rate := h.scrubSettings.ReadRate
+	h.scrubStatus.Scrubbing = true
+	h.scrubStatus.LastScrub = h.blockHeight
+	h.scrubStatus.FilesChecked = 0
+	h.mu.Unlock(lockID)
+
+	var corrupt []modules.CorruptFile
+	for _, co := range obligations {
+		cf, ok := h.scrubFile(co, rate)
+
+		// The result is discarded if the file was replaced by a revision or
+		// moved to another storage folder while it was being read, or if the
+		// obligation has been deleted.
+		lockID = h.mu.Lock()
+		current, exists := h.obligationsByID[co.ID]
+		if exists && current.Path == co.Path && current.FileContract.FileMerkleRoot == co.FileContract.FileMerkleRoot {
+			h.scrubStatus.FilesChecked++
+			if !ok {
+				corrupt = append(corrupt, cf)
+				if cf.Error != "" {
+					h.log.Printf("WARN: could not read file %v of contract %v: %v\n", cf.Path, cf.ContractID, cf.Error)
+				} else {
+					h.log.Printf("WARN: file %v of contract %v is corrupt: expected Merkle root %v, got %v\n", cf.Path, cf.ContractID, cf.ExpectedRoot, cf.Root)
+				}
+			}
+		}
+		h.mu.Unlock(lockID)
+	}
+
+	lockID = h.mu.Lock()
+	h.scrubStatus.Scrubbing = false
+	h.scrubStatus.CorruptFiles = corrupt
+	h.log.Printf("INFO: scrub finished, %v files checked, %v corrupt\n", h.scrubStatus.FilesChecked, len(corrupt))
+	h.mu.Unlock(lockID)
+}
+
+// ScrubSettings returns the settings of the host's scrubber.
+func (h *Host) ScrubSettings() modules.ScrubSettings {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.scrubSettings
+}
+
+// ScrubStatus returns the progress of the host's scrubber and the corrupt
+// files found during the last scrub.
+func (h *Host) ScrubStatus() modules.ScrubStatus {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	status := h.scrubStatus
+	status.CorruptFiles = append([]modules.CorruptFile(nil), h.scrubStatus.CorruptFiles...)
+	return status
+}
+
+// SetScrubSettings sets the settings of the host's scrubber. A scrub that is
+// in progress keeps its read rate.
+func (h *Host) SetScrubSettings(settings modules.ScrubSettings) error {
+	if settings.Interval == 0 || settings.ReadRate == 0 {
+		return errBadScrubSettings
+	}
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.scrubSettings = settings
+	return h.save()
+}
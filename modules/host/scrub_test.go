@@ -0,0 +1,85 @@
+package host
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestThrottledReader checks that a throttled reader does not read faster than
+// its rate.
+func TestThrottledReader(t *testing.T) {
+	data := make([]byte, 3e3)
+	tr := &throttledReader{r: bytes.NewReader(data), rate: 10e3, start: time.Now()}
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != len(data) {
+		t.Fatal("throttled reader returned the wrong amount of data")
+	}
+	if time.Since(tr.start) < 300*time.Millisecond {
+		t.Error("throttled reader read faster than its rate")
+	}
+}
+
+// TestScrub corrupts the files of some obligations and checks that the
+// scrubber finds them.
+func TestScrub(t *testing.T) {
+	ht := CreateHostTester("TestScrub", t)
+	err := ht.host.SetScrubSettings(modules.ScrubSettings{Enabled: true})
+	if err != errBadScrubSettings {
+		t.Fatal("expected errBadScrubSettings, got", err)
+	}
+	err = ht.host.SetScrubSettings(modules.ScrubSettings{Enabled: true, Interval: 1, ReadRate: 1e9})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 4e3)
+	rand.Read(data)
+	intact := ht.addRevisableObligation(data, types.SiaPublicKey{})
+	flipped := ht.addRevisableObligation(data, types.SiaPublicKey{})
+	missing := ht.addRevisableObligation(data, types.SiaPublicKey{})
+
+	// Flip a byte in one file and delete another.
+	file, err := os.OpenFile(ht.host.filePath(flipped.Path), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt([]byte{^data[100]}, 100)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(ht.host.filePath(missing.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ht.host.threadedScrub()
+	status := ht.host.ScrubStatus()
+	if status.Scrubbing || status.FilesChecked != 3 || len(status.CorruptFiles) != 2 {
+		t.Fatalf("unexpected scrub status: %+v", status)
+	}
+	for _, cf := range status.CorruptFiles {
+		switch cf.ContractID {
+		case flipped.ID:
+			if cf.Error != "" || cf.Root == cf.ExpectedRoot {
+				t.Error("flipped file reported incorrectly:", cf)
+			}
+		case missing.ID:
+			if cf.Error == "" {
+				t.Error("missing file reported without an error")
+			}
+		case intact.ID:
+			t.Error("intact file reported as corrupt")
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package host
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errStorageFolderBusy      = errors.New("storage folder has uploads in progress")
+	errStorageFolderExists    = errors.New("storage folder is already in use by the host")
+	errStorageFolderNotDir    = errors.New("storage folder path is not a directory")
+	errStorageFolderNotFound  = errors.New("no storage folder at that path")
+	errStorageFolderTooSmall  = errors.New("storage folder holds more data than the requested size")
+	errStorageFolderZeroBytes = errors.New("storage folder must have a non-zero size")
+)
+
+// A storageFolder is a directory on disk that the host stores files in. Each
+// folder has its own capacity, which allows the host to spread data across
+// several disks. When the host has no storage folders, files are stored in the
+// host's save directory.
+type storageFolder struct {
+	Path          string
+	Size          uint64
+	SizeRemaining uint64
+}
+
+// filePath returns the full path of a file stored by the host. Files in
+// storage folders are tracked by their absolute path, while files in the
+// host's save directory are tracked relative to it.
+func (h *Host) filePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(h.saveDir, path)
+}
+
+// storageFolder returns the storage folder with the given path, or nil if the
+// host has no such folder.
+func (h *Host) storageFolder(path string) *storageFolder {
+	for _, sf := range h.storageFolders {
+		if sf.Path == path {
+			return sf
+		}
+	}
+	return nil
+}
+
+// selectStorageFolder picks the storage folder that a file of size 'filesize'
+// should be placed in. The folder with the most remaining space is chosen so
+// that data is spread evenly across folders. nil is returned if no folder has
+// enough space.
+func (h *Host) selectStorageFolder(filesize uint64) *storageFolder {
+	var best *storageFolder
+	for _, sf := range h.storageFolders {
+		if sf.SizeRemaining < filesize {
+			continue
+		}
+		if best == nil || sf.SizeRemaining > best.SizeRemaining {
+			best = sf
+		}
+	}
+	return best
+}
+
+// newFilePath returns the path of a new file in the storage folder 'sf'. If
+// 'sf' is nil, the path points to the host's save directory.
+func (h *Host) newFilePath(sf *storageFolder) string {
+	h.fileCounter++
+	name := strconv.Itoa(h.fileCounter)
+	if sf == nil {
+		return name
+	}
+	return filepath.Join(sf.Path, name)
+}
+
+// updateObligationPath changes the recorded location of the file belonging to
+// an obligation.
+func (h *Host) updateObligationPath(id types.FileContractID, path string) {
+	co := h.obligationsByID[id]
+	co.Path = path
+	h.obligationsByID[id] = co
+}
+
+// copyFile copies the contents of the file at 'src' into a new file at 'dst'.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// migrateObligation moves the file of an obligation out of the storage folder
+// 'src', which has already been removed from the host's list of folders. The
+// lock is not held while the file is being copied, so the obligation is looked
+// up again before the copy replaces the original. If a revision replaced the
+// file in the meantime, the copy is stale and is discarded. The revised file
+// is not in 'src', since files are no longer placed there.
+func (h *Host) migrateObligation(co contractObligation, src *storageFolder) error {
+	filesize := co.FileContract.FileSize
+
+	// Reserve space for the file in another storage folder.
+	lockID := h.mu.Lock()
+	dst := h.selectStorageFolder(filesize)
+	if dst == nil && len(h.storageFolders) != 0 {
+		h.mu.Unlock(lockID)
+		return HostCapacityErr
+	}
+	if dst != nil {
+		dst.SizeRemaining -= filesize
+	}
+	newPath := h.newFilePath(dst)
+	h.mu.Unlock(lockID)
+
+	err := copyFile(co.Path, h.filePath(newPath))
+
+	lockID = h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	current, exists := h.obligationsByID[co.ID]
+	if err != nil || !exists || current.Path != co.Path {
+		// Either the copy failed, or the obligation was deleted or revised
+		// while the file was being copied. Release the reserved space.
+		if dst != nil {
+			dst.SizeRemaining += filesize
+		}
+		os.Remove(h.filePath(newPath))
+		return err
+	}
+	h.updateObligationPath(co.ID, newPath)
+	src.SizeRemaining += filesize
+	os.Remove(co.Path)
+	return h.save()
+}
+
+// AddStorageFolder adds a storage folder to the host. New files will be
+// placed in the folder until 'size' bytes are in use. The folder's disk must
+// have 'size' bytes of free space.
+func (h *Host) AddStorageFolder(path string, size uint64) error {
+	if size == 0 {
+		return errStorageFolderZeroBytes
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(path, 0700)
+	if err != nil {
+		return err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return errStorageFolderNotDir
+	}
+	free, err := freeSpace(path)
+	if err != nil {
+		return err
+	}
+	if size > free {
+		return errDiskTooSmall
+	}
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if h.storageFolder(path) != nil {
+		return errStorageFolderExists
+	}
+	h.storageFolders = append(h.storageFolders, &storageFolder{
+		Path:          path,
+		Size:          size,
+		SizeRemaining: size,
+	})
+	return h.save()
+}
+
+// RemoveStorageFolder removes a storage folder from the host. Every file in
+// the folder is moved to one of the remaining folders before the folder is
+// removed. If the last storage folder is removed, its files are moved into the
+// host's save directory.
+func (h *Host) RemoveStorageFolder(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	lockID := h.mu.Lock()
+	i := 0
+	for i < len(h.storageFolders) && h.storageFolders[i].Path != path {
+		i++
+	}
+	if i == len(h.storageFolders) {
+		h.mu.Unlock(lockID)
+		return errStorageFolderNotFound
+	}
+	sf := h.storageFolders[i]
+
+	// Find the obligations that have files in the folder. If they do not
+	// account for all of the space in use, an upload to the folder is in
+	// progress.
+	var migrations []contractObligation
+	var used uint64
+	for _, co := range h.obligationsByID {
+		if filepath.Dir(co.Path) == sf.Path {
+			migrations = append(migrations, co)
+			used += co.FileContract.FileSize
+		}
+	}
+	if used != sf.Size-sf.SizeRemaining {
+		h.mu.Unlock(lockID)
+		return errStorageFolderBusy
+	}
+
+	// Remove the folder from the host so that no new files are placed in it.
+	h.storageFolders = append(h.storageFolders[:i], h.storageFolders[i+1:]...)
+	h.mu.Unlock(lockID)
+
+	for _, co := range migrations {
+		err = h.migrateObligation(co, sf)
+		if err != nil {
+			// Restore the folder so that the files which could not be
+			// moved are still tracked.
+			lockID = h.mu.Lock()
+			h.storageFolders = append(h.storageFolders, sf)
+			h.save()
+			h.mu.Unlock(lockID)
+			return err
+		}
+	}
+
+	lockID = h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	return h.save()
+}
+
+// ResizeStorageFolder changes the number of bytes that the host may store in
+// a storage folder. A folder cannot grow beyond the free space of its disk.
+func (h *Host) ResizeStorageFolder(path string, size uint64) error {
+	if size == 0 {
+		return errStorageFolderZeroBytes
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	sf := h.storageFolder(path)
+	if sf == nil {
+		return errStorageFolderNotFound
+	}
+	used := sf.Size - sf.SizeRemaining
+	if size < used {
+		return errStorageFolderTooSmall
+	}
+	if size > sf.Size {
+		free, err := freeSpace(path)
+		if err != nil {
+			return err
+		}
+		if size-used > free {
+			return errDiskTooSmall
+		}
+	}
+	sf.Size = size
+	sf.SizeRemaining = size - used
+	return h.save()
+}
+
+// StorageFolders returns information about each of the host's storage
+// folders.
+func (h *Host) StorageFolders() []modules.StorageFolderMetadata {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	folders := make([]modules.StorageFolderMetadata, 0, len(h.storageFolders))
+	for _, sf := range h.storageFolders {
+		folders = append(folders, modules.StorageFolderMetadata{
+			Path:          sf.Path,
+			Size:          sf.Size,
+			SizeRemaining: sf.SizeRemaining,
+		})
+	}
+	return folders
+}
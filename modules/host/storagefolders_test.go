@@ -0,0 +1,164 @@
+package host
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// addTestObligation allocates a file of 'filesize' bytes, fills it with data,
+// and adds an obligation for it to the host.
+func (ht *hostTester) addTestObligation(filesize uint64) contractObligation {
+	file, path, err := ht.allocate(filesize)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	lockID := ht.host.mu.Lock()
+	defer ht.host.mu.Unlock(lockID)
+	_, err = file.Write(bytes.Repeat([]byte{byte(ht.host.fileCounter)}, int(filesize)))
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	file.Close()
+
+	co := contractObligation{
+		ID: types.FileContractID{byte(ht.host.fileCounter)},
+		FileContract: types.FileContract{
+			FileSize:    filesize,
+			WindowStart: ht.cs.Height() + 20,
+		},
+		Path: path,
+	}
+	ht.host.obligationsByID[co.ID] = co
+	return co
+}
+
+// TestStorageFolders adds, resizes, and removes storage folders, checking that
+// files are spread across the folders and migrated when a folder is removed.
+func TestStorageFolders(t *testing.T) {
+	ht := CreateHostTester("TestStorageFolders", t)
+	folder1 := filepath.Join(ht.host.saveDir, "folder1")
+	folder2 := filepath.Join(ht.host.saveDir, "folder2")
+	const filesize = 4e3
+
+	// Add two storage folders.
+	err := ht.host.AddStorageFolder(folder1, 10e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.AddStorageFolder(folder2, 7e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.AddStorageFolder(folder1, 10e3) != errStorageFolderExists {
+		t.Error("expected errStorageFolderExists")
+	}
+
+	// Allocate two files. They should land in different folders.
+	co1 := ht.addTestObligation(filesize)
+	co2 := ht.addTestObligation(filesize)
+	if filepath.Dir(co1.Path) != folder1 || filepath.Dir(co2.Path) != folder2 {
+		t.Fatal("files were not spread across storage folders:", co1.Path, co2.Path)
+	}
+	folders := ht.host.StorageFolders()
+	if folders[0].SizeRemaining != 6e3 || folders[1].SizeRemaining != 3e3 {
+		t.Fatal("storage folder space was not allocated correctly:", folders)
+	}
+
+	// A folder cannot be shrunk below the data it holds.
+	if ht.host.ResizeStorageFolder(folder2, 2e3) != errStorageFolderTooSmall {
+		t.Error("expected errStorageFolderTooSmall")
+	}
+	err = ht.host.ResizeStorageFolder(folder2, 5e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove folder2. Its file should be migrated to folder1.
+	err = ht.host.RemoveStorageFolder(folder2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders = ht.host.StorageFolders()
+	if len(folders) != 1 || folders[0].SizeRemaining != 2e3 {
+		t.Fatal("storage folders not updated after removal:", folders)
+	}
+	migrated := ht.host.obligationsByID[co2.ID]
+	if filepath.Dir(migrated.Path) != folder1 {
+		t.Fatal("file was not migrated to the remaining folder:", migrated.Path)
+	}
+	data, err := ioutil.ReadFile(migrated.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat([]byte{co2.ID[0]}, filesize)) {
+		t.Error("migrated file has the wrong contents")
+	}
+
+	// folder1 cannot fit a third file of this size.
+	if ht.host.RemoveStorageFolder(folder2) != errStorageFolderNotFound {
+		t.Error("expected errStorageFolderNotFound")
+	}
+	_, _, err = ht.allocate(filesize)
+	if err != HostCapacityErr {
+		t.Error("expected HostCapacityErr, got", err)
+	}
+
+	// Reload the host and check that the folders are restored.
+	err = ht.host.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders = ht.host.StorageFolders()
+	if len(folders) != 1 || folders[0].SizeRemaining != 2e3 {
+		t.Error("storage folders not restored after load:", folders)
+	}
+}
+
+// TestMigrateRevisedObligation checks that a migration does not replace a file
+// that was revised while it was being copied.
+func TestMigrateRevisedObligation(t *testing.T) {
+	ht := CreateHostTester("TestMigrateRevisedObligation", t)
+	folder1 := filepath.Join(ht.host.saveDir, "folder1")
+	folder2 := filepath.Join(ht.host.saveDir, "folder2")
+	const filesize = 4e3
+	for _, folder := range []string{folder1, folder2} {
+		if err := ht.host.AddStorageFolder(folder, 10e3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	co := ht.addTestObligation(filesize)
+
+	// Simulate a revision that replaced the file after the migration
+	// started.
+	revised := ht.addTestObligation(filesize)
+	lockID := ht.host.mu.Lock()
+	delete(ht.host.obligationsByID, revised.ID)
+	current := ht.host.obligationsByID[co.ID]
+	current.Path = revised.Path
+	ht.host.obligationsByID[co.ID] = current
+	src := ht.host.storageFolder(filepath.Dir(co.Path))
+	ht.host.mu.Unlock(lockID)
+
+	err := ht.host.migrateObligation(co, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID = ht.host.mu.Lock()
+	defer ht.host.mu.Unlock(lockID)
+	if ht.host.obligationsByID[co.ID].Path != revised.Path {
+		t.Error("migration replaced the revised file:", ht.host.obligationsByID[co.ID].Path)
+	}
+	for _, sf := range ht.host.storageFolders {
+		if sf.SizeRemaining != 6e3 {
+			t.Error("space reserved for the migration was not released:", sf.Path, sf.SizeRemaining)
+		}
+	}
+}
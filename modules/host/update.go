@@ -3,54 +3,70 @@ package host
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-// threadedDeleteObligation deletes a file obligation.
-func (h *Host) threadedDeleteObligation(obligation contractObligation) {
-	// Delete the obligation.
-	lockID := h.mu.Lock()
-	defer h.mu.Unlock(lockID)
-
-	fullpath := filepath.Join(h.saveDir, obligation.Path)
-	stat, err := os.Stat(fullpath)
-	if err != nil {
-		fmt.Println(err)
-	}
-	h.deallocate(uint64(stat.Size()), obligation.Path)
+// deleteObligation deletes a file obligation and the file that belongs to it.
+func (h *Host) deleteObligation(obligation contractObligation) {
+	h.deallocate(obligation.FileContract.FileSize, obligation.Path)
 	delete(h.obligationsByID, obligation.ID)
+	h.resolveContract(obligation)
 
-	// Storage proof was successful, so increment profit tracking
-	h.profit = h.profit.Add(obligation.FileContract.Payout)
+	// Profit is only counted if the storage proof made it into the
+	// blockchain.
+	if obligation.Status == obligationProofConfirmed {
+		h.profit = h.profit.Add(obligation.FileContract.Payout)
+	}
+}
 
-	_ = h.save() // TODO: Some way to communicate that the save failed.
+// setObligationStatus updates the status of an obligation, returning true if
+// the status changed.
+func (h *Host) setObligationStatus(id types.FileContractID, status obligationStatus) bool {
+	co, exists := h.obligationsByID[id]
+	if !exists || co.Status == status {
+		return false
+	}
+	co.Status = status
+	h.obligationsByID[id] = co
+	return true
 }
 
 // threadedCreateStorageProof creates a storage proof for a file contract
 // obligation and submits it to the blockchain.
-func (h *Host) threadedCreateStorageProof(obligation contractObligation, heightForProof types.BlockHeight) {
-	defer h.threadedDeleteObligation(obligation)
+func (h *Host) threadedCreateStorageProof(obligation contractObligation) {
+	txnID, err := h.createStorageProof(obligation)
 
-	fullpath := filepath.Join(h.saveDir, obligation.Path)
-	file, err := os.Open(fullpath)
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	delete(h.proving, obligation.ID)
 	if err != nil {
+		// The proof will be attempted again when the next block arrives.
 		fmt.Println(err)
 		return
 	}
+	h.setObligationStatus(obligation.ID, obligationProofSubmitted)
+	h.recordTransaction(obligation.ID, txnID)
+	_ = h.save() // TODO: Some way to communicate that the save failed.
+}
+
+// createStorageProof builds a storage proof for an obligation and submits it
+// to the transaction pool, returning the ID of the proof transaction.
+func (h *Host) createStorageProof(obligation contractObligation) (txnID crypto.Hash, err error) {
+	file, err := os.Open(h.filePath(obligation.Path))
+	if err != nil {
+		return
+	}
 	defer file.Close()
 
 	segmentIndex, err := h.cs.StorageProofSegment(obligation.ID)
 	if err != nil {
-		fmt.Println(err)
 		return
 	}
 	base, hashSet, err := crypto.BuildReaderProof(file, segmentIndex)
 	if err != nil {
-		fmt.Println(err)
 		return
 	}
 
@@ -59,23 +75,66 @@ func (h *Host) threadedCreateStorageProof(obligation contractObligation, heightF
 	// Create and send the transaction.
 	id, err := h.wallet.RegisterTransaction(types.Transaction{})
 	if err != nil {
-		fmt.Println(err)
 		return
 	}
 	_, _, err = h.wallet.AddStorageProof(id, sp)
 	if err != nil {
-		fmt.Println(err)
 		return
 	}
 	t, err := h.wallet.SignTransaction(id, true)
 	if err != nil {
-		fmt.Println(err)
 		return
 	}
 	err = h.tpool.AcceptTransaction(t)
-	if err != nil {
-		fmt.Println(err)
-		return
+	if err == modules.ErrTransactionPoolDuplicate {
+		// The proof is already waiting in the transaction pool.
+		err = nil
+	}
+	return t.ID(), err
+}
+
+// proofHeight returns the height at which the host starts submitting a storage
+// proof for an obligation.
+func (co contractObligation) proofHeight() types.BlockHeight {
+	return co.FileContract.WindowStart + StorageProofReorgDepth
+}
+
+// expirationHeight returns the height at which the obligation is resolved and
+// buried deeply enough that its file can be deleted.
+func (co contractObligation) expirationHeight() types.BlockHeight {
+	return co.FileContract.WindowEnd + StorageProofReorgDepth
+}
+
+// checkSubmittedProofs looks for submitted storage proofs that are no longer
+// in the transaction pool, and marks their obligations as pending so that the
+// proofs are built and submitted again.
+func (h *Host) checkSubmittedProofs() {
+	inPool := make(map[types.FileContractID]bool)
+	for _, txn := range h.tpool.TransactionSet() {
+		for _, sp := range txn.StorageProofs {
+			inPool[sp.ParentID] = true
+		}
+	}
+	for _, co := range h.obligationsByID {
+		if co.Status == obligationProofSubmitted && !inPool[co.ID] {
+			h.setObligationStatus(co.ID, obligationPending)
+		}
+	}
+}
+
+// submitStorageProofs spawns a proof for every pending obligation whose proof
+// window is open. Obligations that were left unfinished when the host was shut
+// down are picked up here as well.
+func (h *Host) submitStorageProofs() {
+	for _, co := range h.obligationsByID {
+		if co.Status != obligationPending || h.proving[co.ID] {
+			continue
+		}
+		if h.blockHeight < co.proofHeight() || h.blockHeight >= co.FileContract.WindowEnd {
+			continue
+		}
+		h.proving[co.ID] = true
+		go h.threadedCreateStorageProof(co)
 	}
 }
 
@@ -86,18 +145,69 @@ func (h *Host) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
 	defer h.mu.Unlock(lockID)
 
 	h.blockHeight -= types.BlockHeight(len(cc.RevertedBlocks))
+	revertHeight := h.blockHeight
+	h.blockHeight += types.BlockHeight(len(cc.AppliedBlocks))
 
-	// Check the applied blocks and see if any of the contracts we have are
-	// ready for storage proofs.
-	for _ = range cc.AppliedBlocks {
-		h.blockHeight++
-		for _, obligation := range h.obligationsByHeight[h.blockHeight] {
-			go h.threadedCreateStorageProof(obligation, h.blockHeight)
+	// If a block containing one of the host's storage proofs was reverted,
+	// the proof needs to be submitted again. Then check the applied blocks for
+	// storage proofs that fulfill the host's obligations.
+	changed := false
+	for _, b := range cc.RevertedBlocks {
+		h.recordBlock(b, 0, true)
+		for _, txn := range b.Transactions {
+			for _, sp := range txn.StorageProofs {
+				if h.setObligationStatus(sp.ParentID, obligationPending) {
+					changed = true
+				}
+			}
+		}
+	}
+	for i, b := range cc.AppliedBlocks {
+		// h.blockHeight counts the genesis block, so the height of the
+		// block is one less than the count.
+		h.recordBlock(b, revertHeight+types.BlockHeight(i), false)
+		for _, txn := range b.Transactions {
+			for _, sp := range txn.StorageProofs {
+				if h.setObligationStatus(sp.ParentID, obligationProofConfirmed) {
+					changed = true
+				}
+			}
 		}
-		// TODO: If something happens while the storage proofs are being
-		// created, those files will never get cleared from the host.
-		delete(h.obligationsByHeight, h.blockHeight)
 	}
+
+	// Delete any obligations that have been resolved. When the host starts
+	// up, the consensus set replays every block, so obligations that resolved
+	// while the host was offline are cleaned up as well.
+	for _, co := range h.obligationsByID {
+		if h.blockHeight >= co.expirationHeight() && !h.proving[co.ID] {
+			h.deleteObligation(co)
+			changed = true
+		}
+	}
+
+	// Only submit storage proofs once the host has caught up to the current
+	// block; proofs created while the host is still replaying old blocks would
+	// be built against the wrong consensus state.
+	if len(cc.AppliedBlocks) != 0 && cc.AppliedBlocks[len(cc.AppliedBlocks)-1].ID() == h.cs.CurrentBlock().ID() {
+		h.checkSubmittedProofs()
+		h.submitStorageProofs()
+		if h.pricingPolicy.Enabled && h.blockHeight >= h.lastPriceAdjustment+pricingInterval {
+			h.lastPriceAdjustment = h.blockHeight
+			go h.threadedAdjustPrices()
+		}
+		if h.blockHeight >= h.lastAddressCheck+addressCheckInterval {
+			h.lastAddressCheck = h.blockHeight
+			go h.threadedCheckAddress()
+		}
+		if h.scrubSettings.Enabled && !h.scrubStatus.Scrubbing && h.blockHeight >= h.scrubStatus.LastScrub+h.scrubSettings.Interval {
+			h.scrubStatus.Scrubbing = true
+			go h.threadedScrub()
+		}
+	}
+	if changed {
+		_ = h.save() // TODO: Some way to communicate that the save failed.
+	}
+
 	h.consensusHeight -= types.BlockHeight(len(cc.RevertedBlocks))
 	h.consensusHeight += types.BlockHeight(len(cc.AppliedBlocks))
 
@@ -0,0 +1,165 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// mineBlock mines a block and waits for it to propagate to the host.
+func (ht *hostTester) mineBlock() {
+	b, _ := ht.miner.FindBlock()
+	err := ht.cs.AcceptBlock(b)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	ht.csUpdateWait()
+}
+
+// TestObligationExpiration checks that an obligation and its file are deleted
+// once the obligation's proof window has closed.
+func TestObligationExpiration(t *testing.T) {
+	ht := CreateHostTester("TestObligationExpiration", t)
+	co := ht.addTestObligation(4e3)
+	lockID := ht.host.mu.Lock()
+	co.FileContract.WindowStart = ht.host.blockHeight
+	co.FileContract.WindowEnd = ht.host.blockHeight
+	ht.host.obligationsByID[co.ID] = co
+	ht.host.mu.Unlock(lockID)
+
+	// The obligation should be deleted once the end of the window is buried
+	// by StorageProofReorgDepth blocks.
+	for i := 0; i < StorageProofReorgDepth-1; i++ {
+		ht.mineBlock()
+	}
+	lockID = ht.host.mu.RLock()
+	_, exists := ht.host.obligationsByID[co.ID]
+	ht.host.mu.RUnlock(lockID)
+	if !exists {
+		t.Fatal("obligation was deleted too early")
+	}
+	ht.mineBlock()
+	lockID = ht.host.mu.RLock()
+	_, exists = ht.host.obligationsByID[co.ID]
+	ht.host.mu.RUnlock(lockID)
+	if exists {
+		t.Fatal("expired obligation was not deleted")
+	}
+	_, err := os.Stat(ht.host.filePath(co.Path))
+	if !os.IsNotExist(err) {
+		t.Error("file of expired obligation was not deleted")
+	}
+}
+
+// TestObligationRecovery checks that unconfirmed storage proofs are resumed
+// after a restart and that orphaned files are removed.
+func TestObligationRecovery(t *testing.T) {
+	ht := CreateHostTester("TestObligationRecovery", t)
+	submitted := ht.addTestObligation(4e3)
+	confirmed := ht.addTestObligation(4e3)
+	lockID := ht.host.mu.Lock()
+	ht.host.setObligationStatus(submitted.ID, obligationProofSubmitted)
+	ht.host.setObligationStatus(confirmed.ID, obligationProofConfirmed)
+	err := ht.host.save()
+	ht.host.mu.Unlock(lockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a file that does not belong to any obligation.
+	orphan := filepath.Join(ht.host.saveDir, "1000")
+	file, err := os.Create(orphan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// Simulate a restart by reloading the host.
+	ht.host.obligationsByID = make(map[types.FileContractID]contractObligation)
+	err = ht.host.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.removeOrphanedFiles()
+
+	if ht.host.obligationsByID[submitted.ID].Status != obligationPending {
+		t.Error("unconfirmed storage proof was not marked for resubmission")
+	}
+	if ht.host.obligationsByID[confirmed.ID].Status != obligationProofConfirmed {
+		t.Error("confirmed storage proof lost its status")
+	}
+	_, err = os.Stat(orphan)
+	if !os.IsNotExist(err) {
+		t.Error("orphaned file was not removed")
+	}
+	_, err = os.Stat(ht.host.filePath(submitted.Path))
+	if err != nil {
+		t.Error("file belonging to an obligation was removed:", err)
+	}
+}
+
+// TestStorageProofConfirmation checks that obligation statuses follow storage
+// proofs as they are confirmed, reverted, and dropped from the transaction
+// pool, and that profit is only counted for confirmed proofs.
+func TestStorageProofConfirmation(t *testing.T) {
+	ht := CreateHostTester("TestStorageProofConfirmation", t)
+	co := ht.addTestObligation(4e3)
+	proofBlock := types.Block{
+		Transactions: []types.Transaction{{
+			StorageProofs: []types.StorageProof{{ParentID: co.ID}},
+		}},
+	}
+
+	// Apply a block containing a storage proof for the obligation.
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{
+		AppliedBlocks: []types.Block{proofBlock},
+	})
+	lockID := ht.host.mu.RLock()
+	status := ht.host.obligationsByID[co.ID].Status
+	ht.host.mu.RUnlock(lockID)
+	if status != obligationProofConfirmed {
+		t.Fatal("obligation was not confirmed by the storage proof")
+	}
+
+	// Revert the block. The proof needs to be submitted again.
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{
+		RevertedBlocks: []types.Block{proofBlock},
+		AppliedBlocks:  []types.Block{{}},
+	})
+	lockID = ht.host.mu.RLock()
+	status = ht.host.obligationsByID[co.ID].Status
+	ht.host.mu.RUnlock(lockID)
+	if status != obligationPending {
+		t.Fatal("obligation was not marked pending after the proof was reverted")
+	}
+
+	// A submitted proof that is not in the transaction pool has been dropped.
+	lockID = ht.host.mu.Lock()
+	ht.host.setObligationStatus(co.ID, obligationProofSubmitted)
+	ht.host.checkSubmittedProofs()
+	status = ht.host.obligationsByID[co.ID].Status
+	ht.host.mu.Unlock(lockID)
+	if status != obligationPending {
+		t.Fatal("dropped storage proof was not marked for resubmission")
+	}
+
+	// Deleting an unconfirmed obligation does not count towards profit.
+	confirmed := ht.addTestObligation(4e3)
+	lockID = ht.host.mu.Lock()
+	defer ht.host.mu.Unlock(lockID)
+	co.FileContract.Payout = types.NewCurrency64(100)
+	co.Status = obligationPending
+	ht.host.deleteObligation(co)
+	if ht.host.profit.Cmp(types.ZeroCurrency) != 0 {
+		t.Error("profit was counted for an unconfirmed storage proof")
+	}
+	confirmed.FileContract.Payout = types.NewCurrency64(100)
+	confirmed.Status = obligationProofConfirmed
+	ht.host.deleteObligation(confirmed)
+	if ht.host.profit.Cmp(types.NewCurrency64(100)) != 0 {
+		t.Error("profit was not counted for a confirmed storage proof")
+	}
+}
@@ -1,39 +1,178 @@
 package host
 
 import (
+	"crypto/rand"
 	"errors"
 	"io"
 	"net"
 	"os"
-	"path/filepath"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+var (
+	errBadChallengeSignature = errors.New("signature does not match the renter key of the file contract")
+	errNoRenterKey           = errors.New("file contract does not have a renter key")
+)
+
+// renterKey returns the renter key of the obligation's contract.
+func renterKey(co contractObligation) (pk crypto.PublicKey, err error) {
+	uc := co.UnlockConditions
+	if co.FileContract.UnlockHash != uc.UnlockHash() || len(uc.PublicKeys) == 0 {
+		return pk, errNoRenterKey
+	}
+	key := uc.PublicKeys[0]
+	if key.Algorithm != types.SignatureEd25519 || len(key.Key) != crypto.PublicKeySize {
+		return pk, errNoRenterKey
+	}
+	copy(pk[:], key.Key)
+	return pk, nil
+}
+
+// verifyChallenge checks that 'sig' is a signature of the retrieve challenge
+// by the renter key of the obligation's contract.
+func verifyChallenge(co contractObligation, challenge crypto.Hash, sig crypto.Signature) error {
+	pk, err := renterKey(co)
+	if err != nil {
+		return err
+	}
+	if crypto.VerifyHash(modules.RetrieveChallengeHash(co.ID, challenge), pk, sig) != nil {
+		return errBadChallengeSignature
+	}
+	return nil
+}
+
+// readChallengeResponse sends a random challenge to the renter and reads the
+// renter's signature of it.
+func readChallengeResponse(conn net.Conn) (challenge crypto.Hash, sig crypto.Signature, err error) {
+	_, err = rand.Read(challenge[:])
+	if err != nil {
+		return
+	}
+	err = encoding.WriteObject(conn, challenge)
+	if err != nil {
+		return
+	}
+	err = encoding.ReadObject(conn, &sig, crypto.SignatureSize)
+	return
+}
+
+// verifyPayment checks that a file contract revision pays the host at least
+// 'payment' more than the obligation's current contract. Only the payouts of
+// the contract may change, and only by moving coins from the renter's download
+// budget to the host.
+func verifyPayment(co contractObligation, rev types.FileContractRevision, payment types.Currency) error {
+	fc := co.FileContract
+	err := verifyRevision(co, rev, fc.FileSize)
+	if err != nil {
+		return err
+	}
+	if rev.NewFileMerkleRoot != fc.FileMerkleRoot {
+		return errors.New("payment cannot change the file")
+	}
+	return verifyPayouts(fc, rev, payment)
+}
+
+// receivePayment reads a payment revision and the renter's signature of it
+// from the renter, and returns the payment transaction signed by both
+// parties.
+func (h *Host) receivePayment(conn net.Conn, co contractObligation, payment types.Currency) (txn types.Transaction, err error) {
+	var rev types.FileContractRevision
+	err = encoding.ReadObject(conn, &rev, maxContractLen)
+	if err != nil {
+		return
+	}
+	var renterSig types.TransactionSignature
+	err = encoding.ReadObject(conn, &renterSig, maxContractLen)
+	if err != nil {
+		return
+	}
+	err = verifyPayment(co, rev, payment)
+	if err != nil {
+		return
+	}
+
+	txn = types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev},
+		TransactionSignatures: []types.TransactionSignature{
+			renterSig,
+			{
+				ParentID:       crypto.Hash(co.ID),
+				CoveredFields:  types.CoveredFields{WholeTransaction: true},
+				PublicKeyIndex: 1,
+			},
+		},
+	}
+	sig, err := crypto.SignHash(txn.SigHash(1), h.secretKey)
+	if err != nil {
+		return
+	}
+	txn.TransactionSignatures[1].Signature = sig[:]
+
+	// The payment is not submitted right away, so the renter's signature
+	// needs to be checked here.
+	err = txn.StandaloneValid(h.cs.Height())
+	return
+}
+
 // rpcRetrieve is an RPC that uploads a specified file to a client.
 //
+// Contract IDs are public, so the host first sends a random challenge, which
+// the renter must sign with the renter key of the contract. The host replies to the request with the AcceptTermsResponse and its price
+// per byte downloaded. If the price is not zero, the file is sent in chunks of
+// modules.DownloadChunkSize bytes, and the renter pays for each chunk with a
+// revision of the file contract that moves coins from the renter's download
+// budget to the host. The host stops sending data when the payments stop.
+// Only the latest payment is submitted to the blockchain, once the download
+// has finished.
+//
 // Mutexes are applied carefully to avoid locking during I/O. All necessary
 // interaction with the host involves looking up the filepath of the file being
 // requested. This is done all at once.
 func (h *Host) rpcRetrieve(conn net.Conn) error {
 	// Get the filename.
+	conn.SetDeadline(phaseDeadline())
 	var contractID types.FileContractID
 	err := encoding.ReadObject(conn, &contractID, crypto.HashSize)
 	if err != nil {
 		return err
 	}
 
-	// Verify the file exists, using a mutex while reading the host.
-	lockID := h.mu.RLock()
+	// Challenge the renter to prove that it controls the contract.
+	challenge, sig, err := readChallengeResponse(conn)
+	if err != nil {
+		return err
+	}
+
+	// Verify the file exists and that the renter answered the challenge,
+	// using a mutex while reading the host. Paid downloads revise the
+	// contract, so the obligation is marked as being revised.
+	lockID := h.mu.Lock()
+	price := h.DownloadPrice
 	contractObligation, exists := h.obligationsByID[contractID]
 	if !exists {
-		h.mu.RUnlock(lockID)
-		return errors.New("no record of that file")
+		err = errContractNotFound
+	} else {
+		err = verifyChallenge(contractObligation, challenge, sig)
+	}
+	if err == nil && !price.IsZero() {
+		contractObligation, err = h.startPayment(contractID)
+	}
+	path := h.filePath(contractObligation.Path)
+	h.mu.Unlock(lockID)
+	if err != nil {
+		return encoding.WriteObject(conn, err.Error())
+	}
+	if !price.IsZero() {
+		defer func() {
+			lockID := h.mu.Lock()
+			delete(h.revising, contractID)
+			h.mu.Unlock(lockID)
+		}()
 	}
-	path := filepath.Join(h.saveDir, contractObligation.Path)
-	h.mu.RUnlock(lockID)
 
 	// Open the file.
 	file, err := os.Open(path)
@@ -42,11 +181,69 @@ func (h *Host) rpcRetrieve(conn net.Conn) error {
 	}
 	defer file.Close()
 
-	// Transmit the file.
-	_, err = io.CopyN(conn, file, int64(contractObligation.FileContract.FileSize))
+	err = encoding.WriteObject(conn, modules.AcceptTermsResponse)
 	if err != nil {
 		return err
 	}
+	err = encoding.WriteObject(conn, price)
+	if err != nil {
+		return err
+	}
+
+	// Transmit the file.
+	if price.IsZero() {
+		conn.SetDeadline(transferDeadline(contractObligation.FileContract.FileSize))
+		_, err = io.CopyN(conn, file, int64(contractObligation.FileContract.FileSize))
+		return err
+	}
+
+	// Submit the latest payment once the renter has stopped paying.
+	var payment types.Transaction
+	defer func() {
+		if len(payment.FileContractRevisions) == 0 {
+			return
+		}
+		err := h.tpool.AcceptTransaction(payment)
+		if err != nil && err != modules.ErrTransactionPoolDuplicate {
+			h.log.Println("WARN: could not submit download payment:", err)
+			return
+		}
+		lockID := h.mu.Lock()
+		h.recordTransaction(contractID, payment.ID())
+		h.save()
+		h.mu.Unlock(lockID)
+	}()
+	for remaining := contractObligation.FileContract.FileSize; remaining > 0; {
+		chunkSize := uint64(modules.DownloadChunkSize)
+		if remaining < chunkSize {
+			chunkSize = remaining
+		}
+		conn.SetDeadline(transferDeadline(chunkSize))
+		payment, err = h.receivePayment(conn, contractObligation, price.Mul(types.NewCurrency64(chunkSize)))
+		if err != nil {
+			return err
+		}
+
+		// Record the payment in the obligation.
+		rev := payment.FileContractRevisions[0]
+		contractObligation.FileContract.ValidProofOutputs = rev.NewValidProofOutputs
+		contractObligation.FileContract.MissedProofOutputs = rev.NewMissedProofOutputs
+		contractObligation.FileContract.RevisionNumber = rev.NewRevisionNumber
+		lockID = h.mu.Lock()
+		current, exists := h.obligationsByID[contractID]
+		if exists {
+			current.FileContract = contractObligation.FileContract
+			h.obligationsByID[contractID] = current
+			h.save()
+		}
+		h.mu.Unlock(lockID)
+
+		_, err = io.CopyN(conn, file, int64(chunkSize))
+		if err != nil {
+			return err
+		}
+		remaining -= chunkSize
+	}
 
 	return nil
 }
@@ -0,0 +1,263 @@
+package host
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// retrieve acts as a renter downloading the file of an obligation. The host's
+// challenge is signed using 'sk'. Each chunk
+// is paid for with a revision moving 'payment' hastings per byte from the
+// download budget to the host. The host's price is returned along with the
+// data. retrieve waits for the host to finish handling the RPC.
+func (ht *hostTester) retrieve(co contractObligation, payment types.Currency, sk crypto.SecretKey) (price types.Currency, data []byte, err error) {
+	conn, hostConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		ht.host.rpcRetrieve(hostConn)
+		hostConn.Close()
+		close(done)
+	}()
+	defer func() {
+		conn.Close()
+		<-done
+	}()
+
+	err = encoding.WriteObject(conn, co.ID)
+	if err != nil {
+		return
+	}
+	var challenge crypto.Hash
+	err = encoding.ReadObject(conn, &challenge, crypto.HashSize)
+	if err != nil {
+		return
+	}
+	challengeSig, err := crypto.SignHash(modules.RetrieveChallengeHash(co.ID, challenge), sk)
+	if err != nil {
+		return
+	}
+	err = encoding.WriteObject(conn, challengeSig)
+	if err != nil {
+		return
+	}
+	var response string
+	err = encoding.ReadObject(conn, &response, 128)
+	if err != nil {
+		return
+	}
+	if response != modules.AcceptTermsResponse {
+		err = errors.New(response)
+		return
+	}
+	err = encoding.ReadObject(conn, &price, 256)
+	if err != nil {
+		return
+	}
+	if price.IsZero() {
+		data = make([]byte, co.FileContract.FileSize)
+		_, err = io.ReadFull(conn, data)
+		return
+	}
+
+	fc := co.FileContract
+	for uint64(len(data)) < fc.FileSize {
+		chunkSize := fc.FileSize - uint64(len(data))
+		if chunkSize > modules.DownloadChunkSize {
+			chunkSize = modules.DownloadChunkSize
+		}
+		chunkPayment := payment.Mul(types.NewCurrency64(chunkSize))
+		fc.RevisionNumber++
+		fc.ValidProofOutputs = []types.SiacoinOutput{
+			{Value: fc.ValidProofOutputs[0].Value.Add(chunkPayment), UnlockHash: fc.ValidProofOutputs[0].UnlockHash},
+			{Value: fc.ValidProofOutputs[1].Value.Sub(chunkPayment), UnlockHash: fc.ValidProofOutputs[1].UnlockHash},
+		}
+		fc.MissedProofOutputs = []types.SiacoinOutput{
+			{Value: fc.MissedProofOutputs[0].Value.Add(chunkPayment), UnlockHash: fc.MissedProofOutputs[0].UnlockHash},
+			{Value: fc.MissedProofOutputs[1].Value.Sub(chunkPayment), UnlockHash: fc.MissedProofOutputs[1].UnlockHash},
+		}
+		rev := types.FileContractRevision{
+			ParentID:              co.ID,
+			UnlockConditions:      co.UnlockConditions,
+			NewRevisionNumber:     fc.RevisionNumber,
+			NewFileSize:           fc.FileSize,
+			NewFileMerkleRoot:     fc.FileMerkleRoot,
+			NewWindowStart:        fc.WindowStart,
+			NewWindowEnd:          fc.WindowEnd,
+			NewValidProofOutputs:  fc.ValidProofOutputs,
+			NewMissedProofOutputs: fc.MissedProofOutputs,
+			NewUnlockHash:         fc.UnlockHash,
+		}
+		txn := types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{rev},
+			TransactionSignatures: []types.TransactionSignature{{
+				ParentID:       crypto.Hash(co.ID),
+				CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+				PublicKeyIndex: 0,
+			}},
+		}
+		var sig crypto.Signature
+		sig, err = crypto.SignHash(txn.SigHash(0), sk)
+		if err != nil {
+			return
+		}
+		txn.TransactionSignatures[0].Signature = sig[:]
+		err = encoding.WriteObject(conn, rev)
+		if err != nil {
+			return
+		}
+		err = encoding.WriteObject(conn, txn.TransactionSignatures[0])
+		if err != nil {
+			return
+		}
+
+		chunk := make([]byte, chunkSize)
+		_, err = io.ReadFull(conn, chunk)
+		if err != nil {
+			return
+		}
+		data = append(data, chunk...)
+	}
+	return
+}
+
+// TestPaidRetrieve downloads a file from the host, paying for each chunk, and
+// checks that the host stops serving data when the payments are too small.
+func TestPaidRetrieve(t *testing.T) {
+	ht := CreateHostTester("TestPaidRetrieve", t)
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renterKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	data := make([]byte, modules.DownloadChunkSize+1e3)
+	rand.Read(data)
+	co := ht.addRevisableObligation(data, renterKey)
+	ht.mineBlock()
+	settings := ht.host.Settings()
+	settings.DownloadPrice = types.NewCurrency64(0)
+	ht.host.SetSettings(settings)
+
+	// Free downloads do not need to be paid for.
+	_, downloaded, err := ht.retrieve(co, types.NewCurrency64(0), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatal("free download returned the wrong data")
+	}
+
+	// A payment below the host's price should be rejected.
+	settings.DownloadPrice = types.NewCurrency64(2)
+	ht.host.SetSettings(settings)
+	_, _, err = ht.retrieve(co, settings.DownloadPrice.Sub(types.NewCurrency64(1)), sk)
+	if err == nil {
+		t.Fatal("host accepted a payment that was too small")
+	}
+
+	// Pay for the download.
+	price, downloaded, err := ht.retrieve(co, settings.DownloadPrice, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.tpUpdateWait()
+	if price.Cmp(settings.DownloadPrice) != 0 {
+		t.Error("host sent the wrong price")
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatal("paid download returned the wrong data")
+	}
+
+	// The host should have recorded the payments and submitted the latest one.
+	lockID := ht.host.mu.RLock()
+	paid := ht.host.obligationsByID[co.ID].FileContract
+	ht.host.mu.RUnlock(lockID)
+	expectedPayment := settings.DownloadPrice.Mul(types.NewCurrency64(uint64(len(data))))
+	if paid.RevisionNumber != 2 || paid.ValidProofOutputs[0].Value.Cmp(co.FileContract.ValidProofOutputs[0].Value.Add(expectedPayment)) != 0 {
+		t.Error("host did not record the download payments")
+	}
+	txns := ht.tpool.TransactionSet()
+	if len(txns) != 1 || len(txns[0].FileContractRevisions) != 1 || txns[0].FileContractRevisions[0].NewRevisionNumber != 2 {
+		t.Error("host did not submit the latest download payment")
+	}
+}
+
+// TestRetrieveChallenge checks that the host only serves files to renters that
+// can sign its challenge with the renter key of the file contract.
+func TestRetrieveChallenge(t *testing.T) {
+	ht := CreateHostTester("TestRetrieveChallenge", t)
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renterKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	data := make([]byte, 4e3)
+	rand.Read(data)
+	co := ht.addRevisableObligation(data, renterKey)
+	settings := ht.host.Settings()
+	settings.DownloadPrice = types.NewCurrency64(0)
+	ht.host.SetSettings(settings)
+
+	wrongKey, _, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ht.retrieve(co, types.NewCurrency64(0), wrongKey)
+	if err == nil || err.Error() != errBadChallengeSignature.Error() {
+		t.Fatal("expected errBadChallengeSignature, got", err)
+	}
+
+	// Contracts without a renter key cannot be downloaded.
+	unkeyed := ht.addTestObligation(4e3)
+	_, _, err = ht.retrieve(unkeyed, types.NewCurrency64(0), sk)
+	if err == nil || err.Error() != errNoRenterKey.Error() {
+		t.Fatal("expected errNoRenterKey, got", err)
+	}
+
+	_, downloaded, err := ht.retrieve(co, types.NewCurrency64(0), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Error("download returned the wrong data")
+	}
+}
+
+// TestStartPayment checks that paid downloads are accepted closer to the proof
+// window than revisions of the file.
+func TestStartPayment(t *testing.T) {
+	ht := CreateHostTester("TestStartPayment", t)
+	_, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renterKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	co := ht.addRevisableObligation([]byte("foo"), renterKey)
+
+	lockID := ht.host.mu.Lock()
+	defer ht.host.mu.Unlock(lockID)
+	co.FileContract.WindowStart = ht.host.blockHeight + StorageProofReorgDepth - 1
+	ht.host.obligationsByID[co.ID] = co
+	if _, err := ht.host.startRevision(co.ID); err != errRevisionTooLate {
+		t.Error("expected errRevisionTooLate, got", err)
+	}
+	if _, err := ht.host.startPayment(co.ID); err != nil {
+		t.Error("payment was refused:", err)
+	}
+	delete(ht.host.revising, co.ID)
+
+	// Payments are refused once the proof window is about to open.
+	co.FileContract.WindowStart = ht.host.blockHeight
+	ht.host.obligationsByID[co.ID] = co
+	if _, err := ht.host.startPayment(co.ID); err != errPaymentTooLate {
+		t.Error("expected errPaymentTooLate, got", err)
+	}
+}
@@ -1,11 +1,42 @@
 package modules
 
 import (
+	"bytes"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// HostDBDir is the name of the directory that is used to store the
+	// hostdb's persistent data.
+	HostDBDir = "hostdb"
+
+	// Reasons given for excluding a host from a random selection.
+	ExclusionSubnet   = "subnet"
+	ExclusionOperator = "operator"
+
+	// Kinds of interactions with a host that the renter reports to the
+	// hostdb.
+	InteractionNegotiate = "negotiate"
+	InteractionDownload  = "download"
+)
+
 var (
+	// HostBaseWeight is the weight of a host before it is divided by the
+	// host's price and adjusted for its other factors. Because most weights
+	// would otherwise be fractional, it is set to 10^120 to give lots of
+	// precision when determining the weight of a host.
+	HostBaseWeight = types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(120), nil))
+
 	PrefixHostAnnouncement = types.Specifier{'H', 'o', 's', 't', 'A', 'n', 'n', 'o', 'u', 'n', 'c', 'e', 'm', 'e', 'n', 't'}
+
+	ErrBadAnnouncement  = errors.New("host announcement is invalid")
+	ErrBadHostSignature = errors.New("signature does not match the host's public key")
 )
 
 // HostAnnouncements are stored in the Arbitrary Data section of transactions
@@ -15,8 +46,16 @@ var (
 // are paired with a volume of 'frozen' coins. The FreezeIndex indicates which
 // output in the transaction contains the frozen coins, and the
 // SpendConditions indicate the number of blocks the coins are frozen for.
+//
+// The PublicKey identifies the host. Announcements are signed by the host, so
+// only the host can announce a new address for its identity. The Height is the
+// height at which the host made the announcement; because anyone can copy an
+// old announcement into a new block, only announcements made at a greater
+// height than the one a host is known by can move the host.
 type HostAnnouncement struct {
 	IPAddress NetAddress
+	PublicKey types.SiaPublicKey
+	Height    types.BlockHeight
 }
 
 // HostSettings are the parameters advertised by the host. These are the
@@ -33,6 +72,206 @@ type HostSettings struct {
 	Price        types.Currency
 	Collateral   types.Currency
 	UnlockHash   types.UnlockHash
+	PublicKey    types.SiaPublicKey // Identifies the host. Used to sign announcements, settings, and file contract revisions.
+
+	DownloadPrice types.Currency // Price per byte of data downloaded from the host.
+
+	// Limits on the collateral that the host locks in contracts. Zero means
+	// no limit.
+	MaxContractCollateral types.Currency // Maximum collateral locked in a single contract.
+	CollateralBudget      types.Currency // Maximum collateral locked in all contracts.
+}
+
+// A HostScan is the result of an attempt by the hostdb to fetch the settings
+// of a host.
+type HostScan struct {
+	Timestamp time.Time
+	Success   bool
+	Latency   time.Duration // Round-trip time of the Settings RPC, not counting the dial. Zero if the scan failed.
+	Settings  HostSettings  // Settings returned by the host. Empty if the scan failed.
+}
+
+// A HostInteraction is the outcome of an interaction between the renter and a
+// host, such as a contract negotiation or a download.
+type HostInteraction struct {
+	Timestamp time.Time
+	Kind      string // One of the Interaction constants.
+	Success   bool
+}
+
+// A HostDBEntry describes a host known to the hostdb, along with statistics
+// computed from its recent scans.
+type HostDBEntry struct {
+	HostSettings
+	Active    bool
+	FirstSeen types.BlockHeight // Height of the block in which the host was first announced.
+
+	Scans          int           // Number of recent scans.
+	LastScan       time.Time     // Zero if the host has not been scanned.
+	LastSuccess    time.Time     // Zero if no recent scan succeeded.
+	Uptime         float64       // Percentage of recent scans that succeeded.
+	AverageLatency time.Duration // Average latency of the recent successful scans.
+	MinLatency     time.Duration
+	MaxLatency     time.Duration
+
+	Interactions       int     // Number of recent interactions reported by the renter.
+	InteractionSuccess float64 // Percentage of recent interactions that succeeded.
+}
+
+// HostWeightSettings control how the hostdb weighs hosts when selecting them
+// at random. A host's weight is inversely proportional to its price raised to
+// PriceExponent, and is multiplied by an adjustment between 0 and 1 for each
+// of the other factors, raised to the factor's exponent. Higher exponents
+// make a factor more important, and an exponent of zero makes the hostdb
+// ignore the factor.
+type HostWeightSettings struct {
+	PriceExponent       float64
+	CollateralExponent  float64 // Penalizes hosts that put up less collateral than their price.
+	StorageExponent     float64 // Penalizes hosts that offer little storage.
+	UptimeExponent      float64 // Penalizes hosts that often fail scans.
+	AgeExponent         float64 // Penalizes hosts that were first announced recently.
+	LatencyExponent     float64 // Penalizes hosts that are slow to respond to scans.
+	DurationExponent    float64 // Penalizes hosts whose MaxDuration is shorter than Duration.
+	InteractionExponent float64 // Penalizes hosts whose interactions with the renter often fail.
+
+	// Duration is the contract duration that the renter wants. Zero means
+	// that hosts are not penalized for their MaxDuration.
+	Duration types.BlockHeight
+}
+
+// A HostScore breaks down the weight that the hostdb assigns to a host. The
+// weight is the price weight multiplied by each of the adjustments, which
+// range from 0 to 1 and have already been raised to their exponents. Only
+// active hosts can be selected, regardless of their weight.
+type HostScore struct {
+	IPAddress NetAddress
+	PublicKey types.SiaPublicKey
+	Active    bool
+
+	Weight      types.Currency
+	PriceWeight types.Currency
+
+	Collateral   float64
+	Storage      float64
+	Uptime       float64
+	Age          float64
+	Latency      float64
+	Duration     float64
+	Interactions float64
+}
+
+// HostDiversitySettings limit how many hosts in a single random selection can
+// be run by the same operator, so that one operator cannot end up holding
+// every copy of a file. Hosts are already unique by public key.
+type HostDiversitySettings struct {
+	// At most one host is selected from each subnet of this many leading
+	// bits. Zero turns off the limit for the address family.
+	IPv4PrefixLength int
+	IPv6PrefixLength int
+
+	// UniqueOperators allows at most one host to be selected for each payout
+	// address (UnlockHash).
+	UniqueOperators bool
+}
+
+// A HostExclusion records a host that was left out of a random selection
+// because of a diversity constraint.
+type HostExclusion struct {
+	IPAddress NetAddress
+	PublicKey types.SiaPublicKey
+	Reason    string     // ExclusionSubnet or ExclusionOperator.
+	Conflict  NetAddress // The selected host that shares the subnet or operator.
+}
+
+// HostScanSettings control how often the hostdb scans hosts, and how many
+// hosts it scans at once. Each round of scanning covers every active host and
+// a random selection of the inactive hosts.
+type HostScanSettings struct {
+	// The time between rounds is chosen at random between the minimum and
+	// the maximum interval.
+	MinScanInterval time.Duration
+	MaxScanInterval time.Duration
+
+	Threads              int // Number of hosts scanned concurrently.
+	InactiveHostCheckups int // Number of inactive hosts scanned in each round.
+}
+
+// HostScanStatus describes the progress of the hostdb's scanning.
+type HostScanStatus struct {
+	Pending    int       // Scans that are queued or in progress.
+	RoundStart time.Time // When the current round began. Zero before the first round.
+	RoundScans int       // Scans completed since the current round began.
+	NextRound  time.Time // When the next round is due to begin.
+}
+
+// ed25519Key converts a SiaPublicKey to an ed25519 public key.
+func ed25519Key(spk types.SiaPublicKey) (pk crypto.PublicKey, err error) {
+	if spk.Algorithm != types.SignatureEd25519 || len(spk.Key) != crypto.PublicKeySize {
+		return pk, ErrBadHostSignature
+	}
+	copy(pk[:], spk.Key)
+	return pk, nil
+}
+
+// CreateAnnouncement returns a host announcement for 'addr' made at 'height'
+// and signed by the host's key, ready to be put in the arbitrary data of a
+// transaction.
+func CreateAnnouncement(addr NetAddress, height types.BlockHeight, pk types.SiaPublicKey, sk crypto.SecretKey) ([]byte, error) {
+	ha := HostAnnouncement{
+		IPAddress: addr,
+		PublicKey: pk,
+		Height:    height,
+	}
+	sig, err := crypto.SignHash(crypto.HashObject(ha), sk)
+	if err != nil {
+		return nil, err
+	}
+	return append(PrefixHostAnnouncement[:], encoding.MarshalAll(ha, sig)...), nil
+}
+
+// DecodeAnnouncement decodes a host announcement from the arbitrary data of a
+// transaction and checks that it was signed by the announced key.
+func DecodeAnnouncement(data []byte) (ha HostAnnouncement, err error) {
+	if len(data) < types.SpecifierLen || !bytes.Equal(data[:types.SpecifierLen], PrefixHostAnnouncement[:]) {
+		return ha, ErrBadAnnouncement
+	}
+	var sig crypto.Signature
+	dec := encoding.NewDecoder(bytes.NewReader(data[types.SpecifierLen:]))
+	if dec.Decode(&ha) != nil || dec.Decode(&sig) != nil {
+		return ha, ErrBadAnnouncement
+	}
+	pk, err := ed25519Key(ha.PublicKey)
+	if err != nil {
+		return ha, err
+	}
+	if crypto.VerifyHash(crypto.HashObject(ha), pk, sig) != nil {
+		return ha, ErrBadHostSignature
+	}
+	return ha, nil
+}
+
+// SettingsChallengeHash returns the hash that a host signs to vouch for its
+// settings. The challenge is chosen randomly by the caller, so that a
+// signature captured earlier cannot be replayed by whoever takes over the
+// host's old address.
+func SettingsChallengeHash(settings HostSettings, challenge crypto.Hash) crypto.Hash {
+	return crypto.HashAll(settings, challenge)
+}
+
+// VerifySettings checks that a set of host settings was signed, along with
+// 'challenge', by the host with the public key 'hostKey'.
+func VerifySettings(settings HostSettings, challenge crypto.Hash, sig crypto.Signature, hostKey types.SiaPublicKey) error {
+	if settings.PublicKey.Algorithm != hostKey.Algorithm || !bytes.Equal(settings.PublicKey.Key, hostKey.Key) {
+		return ErrBadHostSignature
+	}
+	pk, err := ed25519Key(hostKey)
+	if err != nil {
+		return err
+	}
+	if crypto.VerifyHash(SettingsChallengeHash(settings, challenge), pk, sig) != nil {
+		return ErrBadHostSignature
+	}
+	return nil
 }
 
 // A HostDB is a database of hosts that the renter can use for figuring out who
@@ -42,9 +281,30 @@ type HostDB interface {
 	// from.
 	ActiveHosts() []HostSettings
 
+	// DiversitySettings returns the constraints on the hosts that can be
+	// selected together by RandomHosts.
+	DiversitySettings() HostDiversitySettings
+
+	// Exclusions returns the hosts that the most recent call to RandomHosts
+	// left out because of a diversity constraint.
+	Exclusions() []HostExclusion
+
 	// AllHosts returns the full list of hosts known to the hostdb.
 	AllHosts() []HostSettings
 
+	// Host returns the entry, the recent scans, and the recent interactions
+	// of the host announced at 'addr'. If no such host is known, false is
+	// returned.
+	Host(addr NetAddress) (HostDBEntry, []HostScan, []HostInteraction, bool)
+
+	// HostEntries returns an entry for every host known to the hostdb,
+	// including the inactive ones.
+	HostEntries() []HostDBEntry
+
+	// HostScores returns the breakdown of the weight of every host known to
+	// the hostdb, sorted by weight with the heaviest host first.
+	HostScores() []HostScore
+
 	// HostDBNotify will push a struct down the returned channel every time the
 	// hostdb receives an update from the consensus set.
 	HostDBNotify() <-chan struct{}
@@ -55,9 +315,49 @@ type HostDB interface {
 	// RandomHosts will pull up to 'num' random hosts from the hostdb. There
 	// will be no repeats, but the length of the slice returned may be less
 	// than 'num', and may even be 0. The hosts returned first have the higher
-	// priority.
+	// priority. The hosts returned satisfy the diversity settings.
 	RandomHosts(num int) []HostSettings
 
-	// Remove deletes the host with the input address from the database.
-	RemoveHost(NetAddress) error
+	// RemoveHost deletes the host with the input public key from the
+	// database.
+	RemoveHost(types.SiaPublicKey) error
+
+	// Rescan scans the host announced at 'addr' as soon as possible.
+	Rescan(addr NetAddress) error
+
+	// RescanAll scans every known host, including the inactive ones, as soon
+	// as possible.
+	RescanAll()
+
+	// ReportInteraction records the outcome of an interaction of the given
+	// kind between the renter and the host announced at 'addr'. Failures
+	// lower the weight and reliability of the host, and successes raise
+	// them.
+	ReportInteraction(addr NetAddress, kind string, success bool)
+
+	// ScanSettings returns the settings that control scanning.
+	ScanSettings() HostScanSettings
+
+	// ScanStatus returns the progress of the hostdb's scanning.
+	ScanStatus() HostScanStatus
+
+	// SelectHosts is RandomHosts, except that the hosts are weighed by
+	// 'selector' instead of by the hostdb.
+	SelectHosts(num int, selector HostSelector) []HostSettings
+
+	// SetDiversitySettings sets the constraints on the hosts that can be
+	// selected together by RandomHosts.
+	SetDiversitySettings(HostDiversitySettings) error
+
+	// SetScanSettings sets the settings that control scanning. The next
+	// round of scanning is rescheduled if it falls outside the new
+	// intervals.
+	SetScanSettings(HostScanSettings) error
+
+	// SetWeightSettings sets the settings used to weigh hosts and reweighs
+	// every host.
+	SetWeightSettings(HostWeightSettings) error
+
+	// WeightSettings returns the settings used to weigh hosts.
+	WeightSettings() HostWeightSettings
 }
@@ -0,0 +1,130 @@
+package hostdb
+
+// diversity.go keeps RandomHosts from selecting several hosts that are likely
+// to be run by the same operator. Hosts are grouped by the subnet of their IP
+// address and, optionally, by their payout address.
+
+import (
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// defaultDiversitySettings are the diversity settings used by a new
+	// hostdb.
+	defaultDiversitySettings modules.HostDiversitySettings
+
+	errBadDiversitySettings = errors.New("prefix lengths must be between 0 and 32 for IPv4 and between 0 and 128 for IPv6")
+)
+
+func init() {
+	// Hosts in the testing build all run on the same machine, so the subnet
+	// limit is off.
+	if build.Release != "testing" {
+		defaultDiversitySettings = modules.HostDiversitySettings{
+			IPv4PrefixLength: 24,
+			IPv6PrefixLength: 48,
+		}
+	}
+}
+
+// subnet returns the subnet of a host according to the diversity settings,
+// or "" if the subnet is unknown or the limit is off. The IP address seen
+// when the host was last scanned is used if there is one, so that hosts
+// announced under a hostname can be placed. subnet is called with the lock
+// held.
+func (hdb *HostDB) subnet(entry *hostEntry) string {
+	ip := entry.ip
+	if ip == nil {
+		ip = net.ParseIP(entry.IPAddress.Host())
+	}
+	if ip == nil {
+		return ""
+	}
+
+	ones, bits := hdb.diversitySettings.IPv6PrefixLength, 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, ones, bits = ip4, hdb.diversitySettings.IPv4PrefixLength, 32
+	}
+	if ones == 0 {
+		return ""
+	}
+	return ip.Mask(net.CIDRMask(ones, bits)).String() + "/" + strconv.Itoa(ones)
+}
+
+// A diversityFilter tracks the hosts selected so far by RandomHosts, and
+// rejects hosts that share a subnet or an operator with them.
+type diversityFilter struct {
+	hdb        *HostDB
+	subnets    map[string]*hostEntry
+	operators  map[types.UnlockHash]*hostEntry
+	exclusions []modules.HostExclusion
+}
+
+// newDiversityFilter returns a filter with no hosts selected.
+func (hdb *HostDB) newDiversityFilter() *diversityFilter {
+	return &diversityFilter{
+		hdb:       hdb,
+		subnets:   make(map[string]*hostEntry),
+		operators: make(map[types.UnlockHash]*hostEntry),
+	}
+}
+
+// admit reports whether 'entry' can be selected alongside the hosts already
+// selected, recording it as selected if so or as excluded if not.
+func (f *diversityFilter) admit(entry *hostEntry) bool {
+	exclude := func(reason string, conflict *hostEntry) bool {
+		f.exclusions = append(f.exclusions, modules.HostExclusion{
+			IPAddress: entry.IPAddress,
+			PublicKey: entry.PublicKey,
+			Reason:    reason,
+			Conflict:  conflict.IPAddress,
+		})
+		return false
+	}
+
+	subnet := f.hdb.subnet(entry)
+	if conflict, exists := f.subnets[subnet]; exists && subnet != "" {
+		return exclude(modules.ExclusionSubnet, conflict)
+	}
+	if conflict, exists := f.operators[entry.UnlockHash]; exists && f.hdb.diversitySettings.UniqueOperators {
+		return exclude(modules.ExclusionOperator, conflict)
+	}
+	f.subnets[subnet] = entry
+	f.operators[entry.UnlockHash] = entry
+	return true
+}
+
+// DiversitySettings returns the constraints on the hosts that can be
+// selected together by RandomHosts.
+func (hdb *HostDB) DiversitySettings() modules.HostDiversitySettings {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+	return hdb.diversitySettings
+}
+
+// Exclusions returns the hosts that the most recent call to RandomHosts left
+// out because of a diversity constraint.
+func (hdb *HostDB) Exclusions() []modules.HostExclusion {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+	return append([]modules.HostExclusion(nil), hdb.exclusions...)
+}
+
+// SetDiversitySettings sets the constraints on the hosts that can be selected
+// together by RandomHosts.
+func (hdb *HostDB) SetDiversitySettings(ds modules.HostDiversitySettings) error {
+	if ds.IPv4PrefixLength < 0 || ds.IPv4PrefixLength > 32 || ds.IPv6PrefixLength < 0 || ds.IPv6PrefixLength > 128 {
+		return errBadDiversitySettings
+	}
+
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+	hdb.diversitySettings = ds
+	return hdb.save()
+}
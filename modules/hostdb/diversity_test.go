@@ -0,0 +1,164 @@
+package hostdb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSubnet probes the subnet function.
+func TestSubnet(t *testing.T) {
+	hdbt := newHDBTester("TestSubnet", t)
+	hdb := hdbt.hostdb
+	err := hdb.SetDiversitySettings(modules.HostDiversitySettings{IPv4PrefixLength: 33})
+	if err != errBadDiversitySettings {
+		t.Fatal("expected errBadDiversitySettings, got", err)
+	}
+	err = hdb.SetDiversitySettings(modules.HostDiversitySettings{IPv4PrefixLength: 24, IPv6PrefixLength: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr   modules.NetAddress
+		ip     net.IP
+		subnet string
+	}{
+		{"1.2.3.4:9982", nil, "1.2.3.0/24"},
+		{"[2001:db8:1:2::1]:9982", nil, "2001:db8:1::/48"},
+		{"example.com:9982", nil, ""},
+		{"example.com:9982", net.ParseIP("1.2.3.4"), "1.2.3.0/24"},
+	}
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+	for _, test := range tests {
+		entry := &hostEntry{HostSettings: modules.HostSettings{IPAddress: test.addr}, ip: test.ip}
+		if subnet := hdb.subnet(entry); subnet != test.subnet {
+			t.Errorf("subnet of %v (%v): expected %q, got %q", test.addr, test.ip, test.subnet, subnet)
+		}
+	}
+
+	// A prefix length of zero turns off the limit.
+	hdb.diversitySettings.IPv4PrefixLength = 0
+	if subnet := hdb.subnet(&hostEntry{HostSettings: modules.HostSettings{IPAddress: "1.2.3.4:9982"}}); subnet != "" {
+		t.Error("subnet returned for IPv4 host with the limit off:", subnet)
+	}
+}
+
+// TestRandomHostsDiversity checks that RandomHosts does not select two hosts
+// from the same subnet or operator, and that it records the hosts it leaves
+// out.
+func TestRandomHostsDiversity(t *testing.T) {
+	hdbt := newHDBTester("TestRandomHostsDiversity", t)
+	hdb := hdbt.hostdb
+	err := hdb.SetDiversitySettings(modules.HostDiversitySettings{IPv4PrefixLength: 24, UniqueOperators: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hosts 0 and 1 share a subnet, hosts 0 and 2 share an operator, and
+	// hosts 3 and 4 share a subnet once the hostname of host 4 is resolved.
+	hosts := []struct {
+		addr     modules.NetAddress
+		ip       net.IP
+		operator byte
+	}{
+		{"1.2.3.4:9982", nil, 1},
+		{"1.2.3.5:9982", nil, 2},
+		{"5.6.7.8:9982", nil, 1},
+		{"9.9.9.9:9982", nil, 3},
+		{"example.com:9982", net.ParseIP("9.9.9.10"), 4},
+	}
+	id := hdb.mu.Lock()
+	for i, h := range hosts {
+		entry := &hostEntry{
+			HostSettings: modules.HostSettings{
+				IPAddress:  h.addr,
+				PublicKey:  types.SiaPublicKey{Key: []byte{byte(i)}},
+				UnlockHash: types.UnlockHash{h.operator},
+			},
+			weight: types.NewCurrency64(1),
+			ip:     h.ip,
+		}
+		hdb.allHosts[hostKey(entry.PublicKey)] = entry
+		hdb.insertNode(entry)
+	}
+	hdb.mu.Unlock(id)
+
+	for i := 0; i < 20; i++ {
+		selected := hdb.RandomHosts(len(hosts))
+		exclusions := hdb.Exclusions()
+		if len(selected) < 2 || len(selected) > 3 || len(selected)+len(exclusions) != len(hosts) {
+			t.Fatalf("selected %v hosts with %v exclusions", len(selected), len(exclusions))
+		}
+		subnets := make(map[string]bool)
+		operators := make(map[types.UnlockHash]bool)
+		id = hdb.mu.Lock()
+		for _, host := range selected {
+			subnet := hdb.subnet(hdb.allHosts[hostKey(host.PublicKey)])
+			if subnets[subnet] || operators[host.UnlockHash] {
+				t.Fatal("selected two hosts with the same subnet or operator")
+			}
+			subnets[subnet], operators[host.UnlockHash] = true, true
+		}
+		hdb.mu.Unlock(id)
+		for _, ex := range exclusions {
+			if ex.Reason != modules.ExclusionSubnet && ex.Reason != modules.ExclusionOperator {
+				t.Error("exclusion has an unknown reason:", ex.Reason)
+			}
+		}
+	}
+	if len(hdb.ActiveHosts()) != len(hosts) {
+		t.Error("excluded hosts were not returned to the set of active hosts")
+	}
+
+	// Without the constraints, every host can be selected.
+	err = hdb.SetDiversitySettings(modules.HostDiversitySettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.RandomHosts(len(hosts))) != len(hosts) || len(hdb.Exclusions()) != 0 {
+		t.Error("hosts were excluded with the constraints off")
+	}
+}
+
+// TestRandomHostsOperators checks that RandomHosts selects at most one of the
+// hosts that share a payout address, even when they have different keys and
+// subnets.
+func TestRandomHostsOperators(t *testing.T) {
+	hdbt := newHDBTester("TestRandomHostsOperators", t)
+	hdb := hdbt.hostdb
+	err := hdb.SetDiversitySettings(modules.HostDiversitySettings{UniqueOperators: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hosts 0 and 1 are run by the same operator.
+	id := hdb.mu.Lock()
+	for i, addr := range []modules.NetAddress{"1.2.3.4:9982", "5.6.7.8:9982", "9.9.9.9:9982"} {
+		entry := &hostEntry{
+			HostSettings: modules.HostSettings{
+				IPAddress:  addr,
+				PublicKey:  types.SiaPublicKey{Key: []byte{byte(i)}},
+				UnlockHash: types.UnlockHash{byte(i / 2)},
+			},
+			weight: types.NewCurrency64(1),
+		}
+		hdb.allHosts[hostKey(entry.PublicKey)] = entry
+		hdb.insertNode(entry)
+	}
+	hdb.mu.Unlock(id)
+
+	for i := 0; i < 20; i++ {
+		selected := hdb.RandomHosts(3)
+		exclusions := hdb.Exclusions()
+		if len(selected) != 2 || len(exclusions) != 1 || exclusions[0].Reason != modules.ExclusionOperator {
+			t.Fatalf("selected %v hosts with exclusions %v", len(selected), exclusions)
+		}
+		if selected[0].UnlockHash == selected[1].UnlockHash {
+			t.Fatal("selected two hosts run by the same operator")
+		}
+	}
+}
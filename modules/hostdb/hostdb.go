@@ -8,6 +8,7 @@ package hostdb
 
 import (
 	"errors"
+	"os"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
@@ -39,31 +40,63 @@ type HostDB struct {
 
 	// The hostTree is the root node of the tree that organizes hosts by
 	// weight. The tree is necessary for selecting weighted hosts at
-	// random. 'activeHosts' provides a lookup from hostname to the the
+	// random. 'activeHosts' provides a lookup from host key to the the
 	// corresponding node, as the hostTree is unsorted. A host is active if
 	// it is currently responding to queries about price and other
 	// settings.
 	hostTree        *hostNode
-	activeHosts     map[modules.NetAddress]*hostNode
+	activeHosts     map[string]*hostNode
 	consensusHeight int
 
-	// allHosts is a simple list of all known hosts by their network address,
-	// including hosts that are currently offline.
-	allHosts map[modules.NetAddress]*hostEntry
+	// selectorTrees holds the trees built by SelectHosts, so that the active
+	// hosts are only weighed again by a selector after the hostdb changes.
+	selectorTrees map[modules.HostSelector]*hostNode
+
+	// allHosts is a simple list of all known hosts by their key, including
+	// hosts that are currently offline. Hosts are identified by their public
+	// key rather than their network address, so that a host can move to a new
+	// address and so that nobody else can take over a host's address.
+	allHosts map[string]*hostEntry
+
+	// weightSettings control how much each factor contributes to the weight
+	// of a host.
+	weightSettings modules.HostWeightSettings
+
+	// diversitySettings limit the hosts that can be selected together by
+	// RandomHosts. 'exclusions' lists the hosts that were left out of the
+	// most recent selection.
+	diversitySettings modules.HostDiversitySettings
+	exclusions        []modules.HostExclusion
 
 	// the scanPool is a set of hosts that need to be scanned. There are a
 	// handful of goroutines constantly waiting on the channel for hosts to
 	// scan.
 	scanPool chan *hostEntry
 
+	// scanSettings control how often hosts are scanned and how many are
+	// scanned at once. 'probeThreads' is the number of goroutines probing
+	// hosts, which briefly exceeds scanSettings.Threads after the number of
+	// threads is lowered. 'scanWake' interrupts the wait between rounds of
+	// scanning when the next round is rescheduled.
+	scanSettings modules.HostScanSettings
+	scanStatus   modules.HostScanStatus
+	probeThreads int
+	scanWake     chan struct{}
+
 	subscribers []chan struct{}
 
+	// 'dirty' is set when scans or reported interactions change the hostdb,
+	// and cleared when threadedSaveDirty saves the changes to 'persistDir'.
+	persistDir string
+	dirty      bool
+
 	mu *sync.RWMutex
 }
 
 // New returns a host database that will still crawling the hosts it finds on
-// the blockchain.
-func New(cs *consensus.State, g modules.Gateway) (hdb *HostDB, err error) {
+// the blockchain. Hosts found in previous sessions are loaded from
+// 'persistDir', along with the results of the scans made of them.
+func New(cs *consensus.State, g modules.Gateway, persistDir string) (hdb *HostDB, err error) {
 	// Check for nil dependencies.
 	if cs == nil {
 		err = ErrNilConsensusSet
@@ -79,20 +112,39 @@ func New(cs *consensus.State, g modules.Gateway) (hdb *HostDB, err error) {
 		consensusSet: cs,
 		gateway:      g,
 
-		activeHosts: make(map[modules.NetAddress]*hostNode),
+		activeHosts: make(map[string]*hostNode),
+
+		allHosts: make(map[string]*hostEntry),
 
-		allHosts: make(map[modules.NetAddress]*hostEntry),
+		weightSettings:    defaultWeightSettings,
+		diversitySettings: defaultDiversitySettings,
 
-		scanPool: make(chan *hostEntry, scanPoolSize),
+		scanPool:     make(chan *hostEntry, scanPoolSize),
+		scanSettings: defaultScanSettings,
+		scanWake:     make(chan struct{}, 1),
+
+		persistDir: persistDir,
 
 		mu: sync.New(modules.SafeMutexDelay, 1),
 	}
 
-	// Begin listening to consensus and looking for hosts.
-	for i := 0; i < scanningThreads; i++ {
-		go hdb.threadedProbeHosts()
+	// Load the hosts found in previous sessions.
+	err = os.MkdirAll(persistDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = hdb.load()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
+	err = nil
+
+	// Begin listening to consensus and looking for hosts.
+	id := hdb.mu.Lock()
+	hdb.startProbeThreads()
+	hdb.mu.Unlock(id)
 	go hdb.threadedScan()
+	go hdb.threadedSaveDirty()
 	cs.ConsensusSetSubscribe(hdb)
 	return
 }
@@ -1,68 +1,107 @@
 package hostdb
 
 import (
-	"math/big"
+	"net"
+	"time"
 
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-var (
-	// Because most weights would otherwise be fractional, we set the base
-	// weight to 10^80 to give ourselves lots of precision when determing the
-	// weight of a host
-	baseWeight = types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(120), nil))
-)
-
 // A hostEntry represents a host on the network.
 type hostEntry struct {
 	modules.HostSettings
 	weight      types.Currency
 	reliability types.Currency
+
+	// firstSeen is the height of the block in which the host was first
+	// announced. Announcing a new address does not change it.
+	firstSeen types.BlockHeight
+
+	// announceHeight is the height at which the host made the announcement
+	// that the hostdb knows it by.
+	announceHeight types.BlockHeight
+
+	// ip is the IP address that the host was reached at during its last
+	// successful scan. It is nil if the host has not been reached.
+	ip net.IP
+
+	// history holds the results of the most recent scans of the host, oldest
+	// first.
+	history []modules.HostScan
+
+	// interactions holds the outcomes of the most recent interactions
+	// reported by the renter, oldest first.
+	interactions []modules.HostInteraction
 }
 
-// hostWeight returns the weight of a host according to the settings of the
-// host database. Currently, only the price is considered.
-func (hdb *HostDB) hostWeight(entry hostEntry) (weight types.Currency) {
-	// Prevent a divide by zero error by making sure the price is at least one.
-	price := entry.Price
-	if price.Cmp(types.NewCurrency64(0)) <= 0 {
-		price = types.NewCurrency64(1)
+// addScan appends the result of a scan to the history of a host, discarding
+// the oldest result once the history is full.
+func (entry *hostEntry) addScan(scan modules.HostScan) {
+	entry.history = append(entry.history, scan)
+	if len(entry.history) > maxScanHistory {
+		entry.history = entry.history[len(entry.history)-maxScanHistory:]
 	}
+}
 
-	// Divide the base weight by the cube of the price.
-	return baseWeight.Div(price).Div(price).Div(price)
+// hostKey returns the key that a host is stored under in the hostdb.
+func hostKey(pk types.SiaPublicKey) string {
+	return string(encoding.Marshal(pk))
 }
 
 // insert adds a host entry to the state. The host will be inserted into the
 // set of all hosts, and if it is online and responding to requests it will be
-// put into the list of active hosts.
+// put into the list of active hosts. If the host is already known, its address
+// is updated and the host is scanned again at the new address.
 func (hdb *HostDB) insertHost(host modules.HostSettings) {
+	key := hostKey(host.PublicKey)
+	entry, exists := hdb.allHosts[key]
+	if exists {
+		if entry.IPAddress != host.IPAddress {
+			entry.IPAddress = host.IPAddress
+			hdb.scanHostEntry(entry)
+		}
+		return
+	}
+
 	// Add the host to allHosts.
-	entry := &hostEntry{
+	entry = &hostEntry{
 		HostSettings: host,
 		reliability:  DefaultReliability,
+		firstSeen:    types.BlockHeight(hdb.consensusHeight),
 	}
-	_, exists := hdb.allHosts[entry.IPAddress]
-	if !exists {
-		hdb.allHosts[entry.IPAddress] = entry
-		hdb.scanHostEntry(entry)
+	hdb.allHosts[key] = entry
+	hdb.scanHostEntry(entry)
+}
+
+// announceHost adds or moves the host named by an announcement found in the
+// blockchain. Anyone can copy an old announcement into a new block, so an
+// announcement only moves a known host if it was made at a greater height
+// than the announcement that the host is known by.
+func (hdb *HostDB) announceHost(ha modules.HostAnnouncement) {
+	key := hostKey(ha.PublicKey)
+	if entry, exists := hdb.allHosts[key]; exists && ha.Height <= entry.announceHeight {
+		return
 	}
+	hdb.insertHost(modules.HostSettings{IPAddress: ha.IPAddress, PublicKey: ha.PublicKey})
+	hdb.allHosts[key].announceHeight = ha.Height
 }
 
-// Remove deletes an entry from the hostdb.
-func (hdb *HostDB) removeHost(addr modules.NetAddress) error {
-	delete(hdb.allHosts, addr)
+// Remove deletes an entry from the hostdb. The change is saved to disk.
+func (hdb *HostDB) removeHost(pk types.SiaPublicKey) error {
+	key := hostKey(pk)
+	delete(hdb.allHosts, key)
 
 	// See if the node is in the set of active hosts.
-	node, exists := hdb.activeHosts[addr]
+	node, exists := hdb.activeHosts[key]
 	if exists {
-		delete(hdb.activeHosts, addr)
+		delete(hdb.activeHosts, key)
 		node.removeNode()
 		hdb.notifySubscribers()
 	}
 
-	return nil
+	return hdb.save()
 }
 
 // ActiveHosts returns the hosts that can be randomly selected out of the
@@ -89,6 +128,75 @@ func (hdb *HostDB) AllHosts() (allHosts []modules.HostSettings) {
 	return
 }
 
+// entryInfo returns the public view of a host entry, with statistics
+// computed from its scan history. entryInfo is called with the lock held.
+func (hdb *HostDB) entryInfo(entry *hostEntry) modules.HostDBEntry {
+	info := modules.HostDBEntry{
+		HostSettings: entry.HostSettings,
+		FirstSeen:    entry.firstSeen,
+		Scans:        len(entry.history),
+	}
+	_, info.Active = hdb.activeHosts[hostKey(entry.PublicKey)]
+
+	var successes int
+	var totalLatency time.Duration
+	for _, scan := range entry.history {
+		info.LastScan = scan.Timestamp
+		if !scan.Success {
+			continue
+		}
+		info.LastSuccess = scan.Timestamp
+		if successes == 0 || scan.Latency < info.MinLatency {
+			info.MinLatency = scan.Latency
+		}
+		if scan.Latency > info.MaxLatency {
+			info.MaxLatency = scan.Latency
+		}
+		totalLatency += scan.Latency
+		successes++
+	}
+	if info.Scans > 0 {
+		info.Uptime = 100 * float64(successes) / float64(info.Scans)
+	}
+	if successes > 0 {
+		info.AverageLatency = totalLatency / time.Duration(successes)
+	}
+
+	info.Interactions = len(entry.interactions)
+	if info.Interactions > 0 {
+		info.InteractionSuccess = 100 * float64(entry.interactionSuccesses()) / float64(info.Interactions)
+	}
+	return info
+}
+
+// Host returns the entry, the recent scans, and the recent interactions of
+// the host announced at 'addr'. If no such host is known, false is returned.
+func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, []modules.HostScan, []modules.HostInteraction, bool) {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+
+	for _, entry := range hdb.allHosts {
+		if entry.IPAddress == addr {
+			scans := append([]modules.HostScan(nil), entry.history...)
+			interactions := append([]modules.HostInteraction(nil), entry.interactions...)
+			return hdb.entryInfo(entry), scans, interactions, true
+		}
+	}
+	return modules.HostDBEntry{}, nil, nil, false
+}
+
+// HostEntries returns an entry for every host known to the hostdb, including
+// the inactive ones.
+func (hdb *HostDB) HostEntries() (entries []modules.HostDBEntry) {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+
+	for _, entry := range hdb.allHosts {
+		entries = append(entries, hdb.entryInfo(entry))
+	}
+	return
+}
+
 // InsertHost inserts a host into the database.
 func (hdb *HostDB) InsertHost(host modules.HostSettings) error {
 	id := hdb.mu.Lock()
@@ -98,8 +206,8 @@ func (hdb *HostDB) InsertHost(host modules.HostSettings) error {
 }
 
 // RemoveHost removes a host from the database.
-func (hdb *HostDB) RemoveHost(addr modules.NetAddress) error {
+func (hdb *HostDB) RemoveHost(pk types.SiaPublicKey) error {
 	id := hdb.mu.Lock()
 	defer hdb.mu.Unlock(id)
-	return hdb.removeHost(addr)
+	return hdb.removeHost(pk)
 }
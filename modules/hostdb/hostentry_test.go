@@ -2,6 +2,7 @@ package hostdb
 
 import (
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -11,6 +12,12 @@ import (
 func TestHostWeight(t *testing.T) {
 	hdbt := newHDBTester("TestHostWeight", t)
 
+	// Only consider the price, so that the weights can be compared exactly.
+	err := hdbt.hostdb.SetWeightSettings(modules.HostWeightSettings{PriceExponent: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// Create two identical entries, except that one has a price that is 2x the
 	// other. The weight returned by hostWeight should be 1/8 for the more
 	// expensive host.
@@ -63,7 +70,9 @@ func TestInsertHost(t *testing.T) {
 		t.Error("not expecting an active host")
 	}
 
-	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address()})
+	// Insert the real host, which signs its settings with its key.
+	hostKey := hdbt.host.Settings().PublicKey
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address(), PublicKey: hostKey})
 	if len(hdbt.hostdb.allHosts) != 2 {
 		t.Error("host was not inserted")
 	}
@@ -71,4 +80,61 @@ func TestInsertHost(t *testing.T) {
 	if len(hdbt.hostdb.activeHosts) != 1 {
 		t.Error("expecting an active host")
 	}
+
+	// Announcing a new address under the same key moves the host instead of
+	// adding another host.
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: "foo.com:1234", PublicKey: hostKey})
+	if len(hdbt.hostdb.allHosts) != 2 {
+		t.Error("re-announced host was added as a new host")
+	}
+	for _, host := range hdbt.hostdb.AllHosts() {
+		if string(host.PublicKey.Key) == string(hostKey.Key) && host.IPAddress != "foo.com:1234" {
+			t.Error("address of re-announced host was not updated")
+		}
+	}
+}
+
+// TestHostEntries checks the statistics computed from the scan history of a
+// host.
+func TestHostEntries(t *testing.T) {
+	hdbt := newHDBTester("TestHostEntries", t)
+
+	now := time.Now()
+	entry := &hostEntry{
+		HostSettings: modules.HostSettings{IPAddress: "foo.com:1234", PublicKey: fakeKey(1)},
+		firstSeen:    3,
+		history: []modules.HostScan{
+			{Timestamp: now.Add(-3 * time.Hour), Success: true, Latency: 10 * time.Millisecond},
+			{Timestamp: now.Add(-2 * time.Hour), Success: true, Latency: 30 * time.Millisecond},
+			{Timestamp: now.Add(-1 * time.Hour), Success: true, Latency: 20 * time.Millisecond},
+			{Timestamp: now, Success: false},
+		},
+	}
+	id := hdbt.hostdb.mu.Lock()
+	hdbt.hostdb.allHosts[hostKey(entry.PublicKey)] = entry
+	hdbt.hostdb.mu.Unlock(id)
+
+	host, scans, _, exists := hdbt.hostdb.Host("foo.com:1234")
+	if !exists {
+		t.Fatal("host was not found by its address")
+	}
+	if len(scans) != 4 || host.Scans != 4 || host.FirstSeen != 3 || host.Active {
+		t.Errorf("wrong host entry: %+v", host)
+	}
+	if host.Uptime != 75 {
+		t.Error("expected 75% uptime, got", host.Uptime)
+	}
+	if host.AverageLatency != 20*time.Millisecond || host.MinLatency != 10*time.Millisecond || host.MaxLatency != 30*time.Millisecond {
+		t.Error("wrong latencies:", host.AverageLatency, host.MinLatency, host.MaxLatency)
+	}
+	if !host.LastScan.Equal(now) || !host.LastSuccess.Equal(now.Add(-time.Hour)) {
+		t.Error("wrong scan times:", host.LastScan, host.LastSuccess)
+	}
+
+	if _, _, _, exists := hdbt.hostdb.Host("bar.com:1234"); exists {
+		t.Error("unknown host was found")
+	}
+	if len(hdbt.hostdb.HostEntries()) != 1 {
+		t.Error("wrong number of host entries")
+	}
 }
@@ -0,0 +1,103 @@
+package hostdb
+
+// interaction.go records the outcomes of the renter's interactions with hosts.
+// Scans only show that a host is online; a host that answers scans but fails
+// to form contracts or to return the data it is storing should be selected
+// less often than a host that does its job.
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// maxInteractionHistory is the number of interactions kept for each
+	// host.
+	maxInteractionHistory = 50
+)
+
+var (
+	// A failed interaction costs more reliability than a failed scan, because
+	// the host was online but did not do its job. A successful interaction
+	// earns back less than it costs to fail one.
+	InteractionPenalty = types.NewCurrency64(2)
+	InteractionBonus   = types.NewCurrency64(1)
+)
+
+// addInteraction appends the outcome of an interaction to the history of a
+// host, discarding the oldest outcome once the history is full.
+func (entry *hostEntry) addInteraction(interaction modules.HostInteraction) {
+	entry.interactions = append(entry.interactions, interaction)
+	if len(entry.interactions) > maxInteractionHistory {
+		entry.interactions = entry.interactions[len(entry.interactions)-maxInteractionHistory:]
+	}
+}
+
+// interactionSuccesses returns the number of recent interactions with a host
+// that succeeded.
+func (entry *hostEntry) interactionSuccesses() (successes int) {
+	for _, interaction := range entry.interactions {
+		if interaction.Success {
+			successes++
+		}
+	}
+	return
+}
+
+// reportInteraction records the outcome of an interaction with a host and
+// adjusts the reliability and weight of the host. A host whose reliability
+// falls to zero is removed from the database. reportInteraction is called with
+// the lock held.
+func (hdb *HostDB) reportInteraction(entry *hostEntry, interaction modules.HostInteraction) {
+	entry.addInteraction(interaction)
+
+	key := hostKey(entry.PublicKey)
+	if !interaction.Success {
+		if entry.reliability.Cmp(InteractionPenalty) <= 0 {
+			hdb.decrementReliability(entry.PublicKey, entry.reliability)
+			return
+		}
+		entry.reliability = entry.reliability.Sub(InteractionPenalty)
+	} else {
+		entry.reliability = entry.reliability.Add(InteractionBonus)
+		if entry.reliability.Cmp(MaxReliability) > 0 {
+			entry.reliability = MaxReliability
+		}
+	}
+
+	// Reweigh the host. An active host must be taken out of the tree before
+	// its weight changes, because removeNode subtracts the current weight of
+	// the host from its parents.
+	node, active := hdb.activeHosts[key]
+	if active {
+		delete(hdb.activeHosts, key)
+		node.removeNode()
+	}
+	entry.weight = hdb.hostWeight(*entry)
+	if active {
+		hdb.insertNode(entry)
+		hdb.notifySubscribers()
+	}
+}
+
+// ReportInteraction records the outcome of an interaction of the given kind
+// between the renter and the host announced at 'addr'. Reports about unknown
+// hosts are ignored. The outcome is saved with the next periodic save.
+func (hdb *HostDB) ReportInteraction(addr modules.NetAddress, kind string, success bool) {
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+
+	for _, entry := range hdb.allHosts {
+		if entry.IPAddress == addr {
+			hdb.reportInteraction(entry, modules.HostInteraction{
+				Timestamp: time.Now(),
+				Kind:      kind,
+				Success:   success,
+			})
+			hdb.dirty = true
+			return
+		}
+	}
+}
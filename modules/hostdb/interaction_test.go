@@ -0,0 +1,95 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestAddInteraction checks that the interaction history of a host is limited
+// to the most recent interactions.
+func TestAddInteraction(t *testing.T) {
+	var entry hostEntry
+	for i := 0; i < maxInteractionHistory+5; i++ {
+		entry.addInteraction(modules.HostInteraction{Success: i%2 == 0})
+	}
+	if len(entry.interactions) != maxInteractionHistory {
+		t.Fatal("interaction history has the wrong length:", len(entry.interactions))
+	}
+	if entry.interactionSuccesses() != maxInteractionHistory/2 {
+		t.Error("wrong number of successful interactions:", entry.interactionSuccesses())
+	}
+}
+
+// TestReportInteraction checks that failed interactions lower the weight and
+// reliability of a host, and that successful interactions raise them.
+func TestReportInteraction(t *testing.T) {
+	hdbt := newHDBTester("TestReportInteraction", t)
+
+	entry := &hostEntry{
+		HostSettings: modules.HostSettings{IPAddress: fakeAddr(1), PublicKey: fakeKey(1), Price: types.NewCurrency64(1)},
+		reliability:  DefaultReliability,
+	}
+	id := hdbt.hostdb.mu.Lock()
+	entry.weight = hdbt.hostdb.hostWeight(*entry)
+	hdbt.hostdb.allHosts[hostKey(entry.PublicKey)] = entry
+	hdbt.hostdb.insertNode(entry)
+	initialWeight := entry.weight
+	hdbt.hostdb.mu.Unlock(id)
+
+	// A failed download should lower the reliability and the weight of the
+	// host, and the tree should be updated to match.
+	hdbt.hostdb.ReportInteraction(fakeAddr(1), modules.InteractionDownload, false)
+	id = hdbt.hostdb.mu.RLock()
+	if entry.reliability.Cmp(DefaultReliability.Sub(InteractionPenalty)) != 0 {
+		t.Error("failed interaction did not lower the reliability:", entry.reliability)
+	}
+	if entry.weight.Cmp(initialWeight) >= 0 {
+		t.Error("failed interaction did not lower the weight")
+	}
+	if hdbt.hostdb.hostTree.weight.Cmp(entry.weight) != 0 {
+		t.Error("tree weight was not updated")
+	}
+	if !hdbt.hostdb.dirty {
+		t.Error("interaction was not marked to be saved")
+	}
+	failedWeight := entry.weight
+	hdbt.hostdb.mu.RUnlock(id)
+	if err := hdbt.hostdb.saveDirty(); err != nil {
+		t.Fatal(err)
+	}
+	if hdbt.hostdb.dirty {
+		t.Error("hostdb is still dirty after saving")
+	}
+
+	// A successful negotiation should raise them again.
+	hdbt.hostdb.ReportInteraction(fakeAddr(1), modules.InteractionNegotiate, true)
+	id = hdbt.hostdb.mu.RLock()
+	if entry.reliability.Cmp(DefaultReliability.Sub(InteractionPenalty).Add(InteractionBonus)) != 0 {
+		t.Error("successful interaction did not raise the reliability:", entry.reliability)
+	}
+	if entry.weight.Cmp(failedWeight) <= 0 {
+		t.Error("successful interaction did not raise the weight")
+	}
+	hdbt.hostdb.mu.RUnlock(id)
+
+	_, _, interactions, _ := hdbt.hostdb.Host(fakeAddr(1))
+	if len(interactions) != 2 || interactions[0].Kind != modules.InteractionDownload || !interactions[1].Success {
+		t.Error("interactions were not recorded correctly:", interactions)
+	}
+
+	// Repeated failures should remove the host from the database.
+	for i := 0; i < 20; i++ {
+		hdbt.hostdb.ReportInteraction(fakeAddr(1), modules.InteractionDownload, false)
+	}
+	if _, _, _, exists := hdbt.hostdb.Host(fakeAddr(1)); exists {
+		t.Error("unreliable host was not removed")
+	}
+	if len(hdbt.hostdb.ActiveHosts()) != 0 {
+		t.Error("unreliable host is still active")
+	}
+
+	// Reports about unknown hosts are ignored.
+	hdbt.hostdb.ReportInteraction(fakeAddr(2), modules.InteractionDownload, false)
+}
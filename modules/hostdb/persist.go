@@ -0,0 +1,132 @@
+package hostdb
+
+import (
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	persistFilename = "hostdb.json"
+
+	// saveFrequency is how often the results of scans and reported
+	// interactions are saved to disk.
+	saveFrequency = 2 * time.Minute
+)
+
+var persistMetadata = persist.Metadata{
+	Header:  "HostDB Persistence",
+	Version: "0.1",
+}
+
+// A savedHost is the persisted form of a hostEntry.
+type savedHost struct {
+	Settings       modules.HostSettings
+	Reliability    types.Currency
+	FirstSeen      types.BlockHeight
+	AnnounceHeight types.BlockHeight
+	IP             net.IP
+	History        []modules.HostScan
+	Interactions   []modules.HostInteraction
+}
+
+// savedHostDB is the data saved by the hostdb. The weight and diversity
+// settings are pointers because their zero values are valid settings, and
+// must be told apart from files that were saved without them.
+type savedHostDB struct {
+	Hosts             []savedHost
+	WeightSettings    *modules.HostWeightSettings
+	DiversitySettings *modules.HostDiversitySettings
+	ScanSettings      modules.HostScanSettings
+}
+
+// save stores the hosts known to the hostdb, their scan histories, and the
+// weight, diversity, and scan settings to disk. save is called with the lock
+// held.
+func (hdb *HostDB) save() error {
+	data := savedHostDB{
+		Hosts:             make([]savedHost, 0, len(hdb.allHosts)),
+		WeightSettings:    &hdb.weightSettings,
+		DiversitySettings: &hdb.diversitySettings,
+		ScanSettings:      hdb.scanSettings,
+	}
+	for _, entry := range hdb.allHosts {
+		data.Hosts = append(data.Hosts, savedHost{
+			Settings:       entry.HostSettings,
+			Reliability:    entry.reliability,
+			FirstSeen:      entry.firstSeen,
+			AnnounceHeight: entry.announceHeight,
+			IP:             entry.ip,
+			History:        entry.history,
+			Interactions:   entry.interactions,
+		})
+	}
+	return persist.SaveFile(persistMetadata, data, filepath.Join(hdb.persistDir, persistFilename))
+}
+
+// saveDirty saves the hostdb if scans or reported interactions have changed it
+// since it was last saved.
+func (hdb *HostDB) saveDirty() error {
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+	if !hdb.dirty {
+		return nil
+	}
+	hdb.dirty = false
+	return hdb.save()
+}
+
+// threadedSaveDirty periodically saves the changes made by scans and reported
+// interactions, so that the whole hostdb is not written to disk every time a
+// host is probed.
+func (hdb *HostDB) threadedSaveDirty() {
+	for range time.Tick(saveFrequency) {
+		hdb.saveDirty()
+	}
+}
+
+// load restores the hosts saved by a previous session. Hosts whose most recent
+// scan succeeded are put back in the set of active hosts, so that they can be
+// selected before the next round of scanning completes. load is called with
+// the lock held.
+func (hdb *HostDB) load() error {
+	var data savedHostDB
+	err := persist.LoadFile(persistMetadata, &data, filepath.Join(hdb.persistDir, persistFilename))
+	if err != nil {
+		return err
+	}
+	// Files saved before the weight, diversity, or scan settings were
+	// persisted have none, and keep the defaults.
+	if data.WeightSettings != nil {
+		hdb.weightSettings = *data.WeightSettings
+	}
+	if data.DiversitySettings != nil {
+		hdb.diversitySettings = *data.DiversitySettings
+	}
+	if data.ScanSettings.Threads != 0 {
+		hdb.scanSettings = data.ScanSettings
+	}
+	for _, host := range data.Hosts {
+		entry := &hostEntry{
+			HostSettings:   host.Settings,
+			reliability:    host.Reliability,
+			firstSeen:      host.FirstSeen,
+			announceHeight: host.AnnounceHeight,
+			ip:             host.IP,
+			history:        host.History,
+			interactions:   host.Interactions,
+		}
+		entry.weight = hdb.hostWeight(*entry)
+		hdb.allHosts[hostKey(entry.PublicKey)] = entry
+
+		n := len(entry.history)
+		if n > 0 && entry.history[n-1].Success && len(hdb.activeHosts) < MaxActiveHosts {
+			hdb.insertNode(entry)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package hostdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+)
+
+// TestAddScan checks that the scan history of a host is limited to the most
+// recent scans.
+func TestAddScan(t *testing.T) {
+	var entry hostEntry
+	for i := 0; i < maxScanHistory+5; i++ {
+		entry.addScan(modules.HostScan{Success: i%2 == 0})
+	}
+	if len(entry.history) != maxScanHistory {
+		t.Fatal("scan history has the wrong length:", len(entry.history))
+	}
+	if !entry.history[maxScanHistory-1].Success {
+		t.Error("most recent scan is not at the end of the history")
+	}
+}
+
+// TestSaveLoad scans a host, then checks that the host and its scan history
+// are restored by a new hostdb.
+func TestSaveLoad(t *testing.T) {
+	hdbt := newHDBTester("TestSaveLoad", t)
+
+	// Insert an unreachable host and the real host, and wait for the real
+	// host to be scanned.
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: "localhost:0"})
+	pk := hdbt.host.Settings().PublicKey
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address(), PublicKey: pk})
+	<-hdbt.hostdbUpdateChan
+
+	id := hdbt.hostdb.mu.RLock()
+	entry := hdbt.hostdb.allHosts[hostKey(pk)]
+	if len(entry.history) != 1 || !entry.history[0].Success || entry.history[0].Latency == 0 {
+		t.Error("scan was not recorded correctly:", entry.history)
+	}
+	persistDir := hdbt.hostdb.persistDir
+	hdbt.hostdb.mu.RUnlock(id)
+
+	// Scans are saved periodically rather than right away.
+	if err := hdbt.hostdb.saveDirty(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the hosts into a new hostdb. The real host should be active
+	// immediately, before it has been scanned again.
+	hdb, err := New(hdbt.cs, hdbt.gateway, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+	if len(hdb.allHosts) != 2 {
+		t.Fatal("expected 2 hosts to be loaded, got", len(hdb.allHosts))
+	}
+	if _, exists := hdb.activeHosts[hostKey(pk)]; !exists || len(hdb.activeHosts) != 1 {
+		t.Error("scanned host was not restored to the set of active hosts")
+	}
+	loaded := hdb.allHosts[hostKey(pk)]
+	if len(loaded.history) == 0 || loaded.history[0].Settings.PublicKey.Algorithm != pk.Algorithm {
+		t.Error("scan history was not loaded")
+	}
+}
+
+// TestLoadWithoutSettings checks that a hostdb saved before the weight and
+// diversity settings were persisted loads with the default settings, and that
+// settings which are all zero are not mistaken for missing ones.
+func TestLoadWithoutSettings(t *testing.T) {
+	hdbt := newHDBTester("TestLoadWithoutSettings", t)
+
+	// Save a file in the old format, which only has hosts.
+	persistDir := build.TempDir("hostdb", "TestLoadWithoutSettings", "old")
+	if err := os.MkdirAll(persistDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := struct{ Hosts []savedHost }{[]savedHost{{
+		Settings:    modules.HostSettings{IPAddress: "localhost:0"},
+		Reliability: DefaultReliability,
+	}}}
+	err := persist.SaveFile(persistMetadata, old, filepath.Join(persistDir, persistFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb, err := New(hdbt.cs, hdbt.gateway, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.AllHosts()) != 1 {
+		t.Error("hosts were not loaded from the old file")
+	}
+	if hdb.WeightSettings() != defaultWeightSettings || hdb.DiversitySettings() != defaultDiversitySettings {
+		t.Error("old file did not load with the default settings")
+	}
+
+	// Settings of zero are kept.
+	if err := hdb.SetWeightSettings(modules.HostWeightSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.SetDiversitySettings(modules.HostDiversitySettings{}); err != nil {
+		t.Fatal(err)
+	}
+	hdb, err = New(hdbt.cs, hdbt.gateway, persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdb.WeightSettings() != (modules.HostWeightSettings{}) || hdb.DiversitySettings() != (modules.HostDiversitySettings{}) {
+		t.Error("settings of zero were not loaded")
+	}
+}
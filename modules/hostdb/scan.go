@@ -6,11 +6,13 @@ package hostdb
 
 import (
 	"crypto/rand"
+	"errors"
 	"math/big"
 	"net"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -28,22 +30,44 @@ const (
 
 	hostRequestTimeout = 5 * time.Second
 
-	// scanningThreads is the number of threads that will be probing hosts for
-	// their settings and checking for reliability.
+	// scanningThreads is the default number of threads that will be probing
+	// hosts for their settings and checking for reliability.
 	scanningThreads = 25
+
+	// maxScanThreads is the largest number of threads that can be set to
+	// probe hosts.
+	maxScanThreads = 250
+
+	// maxScanHistory is the number of scan results kept for each host.
+	maxScanHistory = 24
 )
 
 var (
 	MaxReliability     = types.NewCurrency64(50) // Given the scanning defaults, about 1 week of survival.
 	DefaultReliability = types.NewCurrency64(20) // Given the scanning defaults, about 3 days of survival.
 	UnreachablePenalty = types.NewCurrency64(1)
+
+	// defaultScanSettings are the scan settings used by a new hostdb.
+	defaultScanSettings = modules.HostScanSettings{
+		MinScanInterval:      MinScanSleep,
+		MaxScanInterval:      MaxScanSleep,
+		Threads:              scanningThreads,
+		InactiveHostCheckups: InactiveHostCheckupQuantity,
+	}
+
+	errBadScanInterval = errors.New("scan intervals must be positive, and the minimum cannot exceed the maximum")
+	errBadScanThreads  = errors.New("the number of scan threads must be between 1 and 250")
+	errBadCheckups     = errors.New("the number of inactive host checkups cannot be negative")
+	errUnknownHost     = errors.New("no host is known at that address")
 )
 
 // addHostToScanPool creates a gofunc that adds a host to the scan pool. If the
 // scan pool is currently full, the blocking gofunc will not cause a deadlock.
 // The gofunc is created inside of this function to eliminate the burden of
-// needing to remember to call 'go addHostToScanPool'.
+// needing to remember to call 'go addHostToScanPool'. scanHostEntry is called
+// with the lock held.
 func (hdb *HostDB) scanHostEntry(entry *hostEntry) {
+	hdb.scanStatus.Pending++
 	go func() {
 		hdb.scanPool <- entry
 	}()
@@ -51,9 +75,10 @@ func (hdb *HostDB) scanHostEntry(entry *hostEntry) {
 
 // decrementReliability reduces the reliability of a node, moving it out of the
 // set of active hosts or deleting it entirely if necessary.
-func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.Currency) {
+func (hdb *HostDB) decrementReliability(pk types.SiaPublicKey, penalty types.Currency) {
 	// Look up the entry and decrement the reliability.
-	entry, exists := hdb.allHosts[addr]
+	key := hostKey(pk)
+	entry, exists := hdb.allHosts[key]
 	if !exists {
 		return
 	}
@@ -61,9 +86,9 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 
 	// If the entry is in the active database, remove it from the active
 	// database.
-	node, exists := hdb.activeHosts[addr]
+	node, exists := hdb.activeHosts[key]
 	if exists {
-		delete(hdb.activeHosts, entry.IPAddress)
+		delete(hdb.activeHosts, key)
 		node.removeNode()
 		hdb.notifySubscribers()
 	}
@@ -71,135 +96,300 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 	// If the reliability has fallen to 0, remove the host from the
 	// database entirely.
 	if entry.reliability.IsZero() {
-		delete(hdb.allHosts, addr)
+		delete(hdb.allHosts, key)
 	}
 }
 
 // threadedProbeHost tries to fetch the settings of a host. If successful, the
 // host is put in the set of active hosts. If unsuccessful, the host id deleted
-// from the set of active hosts.
+// from the set of active hosts. Settings that are not signed by the host's
+// announced public key are treated the same as an unreachable host. Every
+// attempt is added to the host's scan history, along with its latency.
+//
+// If the number of threads has been lowered, surplus threads exit before
+// taking another host from the scan pool.
 func (hdb *HostDB) threadedProbeHosts() {
-	for hostEntry := range hdb.scanPool {
+	for {
+		id := hdb.mu.Lock()
+		if hdb.probeThreads > hdb.scanSettings.Threads {
+			hdb.probeThreads--
+			hdb.mu.Unlock(id)
+			return
+		}
+		hdb.mu.Unlock(id)
+		hostEntry := <-hdb.scanPool
+
 		// Request settings from the queued host entry.
+		id = hdb.mu.RLock()
+		addr, pk := hostEntry.IPAddress, hostEntry.PublicKey
+		hdb.mu.RUnlock(id)
 		var settings modules.HostSettings
+		var ip net.IP
+		var latency time.Duration
+		start := time.Now()
 		err := func() error {
-			conn, err := net.DialTimeout("tcp", string(hostEntry.IPAddress), hostRequestTimeout)
+			conn, err := net.DialTimeout("tcp", string(addr), hostRequestTimeout)
 			if err != nil {
 				return err
 			}
 			defer conn.Close()
+			if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+				ip = tcpAddr.IP
+			}
+			conn.SetDeadline(time.Now().Add(hostRequestTimeout))
+
+			// The latency is the round trip of the RPC, from sending the
+			// request until the signed settings have arrived.
+			rpcStart := time.Now()
 			err = encoding.WriteObject(conn, [8]byte{'S', 'e', 't', 't', 'i', 'n', 'g', 's'})
 			if err != nil {
 				return err
 			}
-			return encoding.ReadObject(conn, &settings, maxSettingsLen)
+			var challenge crypto.Hash
+			_, err = rand.Read(challenge[:])
+			if err != nil {
+				return err
+			}
+			err = encoding.WriteObject(conn, challenge)
+			if err != nil {
+				return err
+			}
+			err = encoding.ReadObject(conn, &settings, maxSettingsLen)
+			if err != nil {
+				return err
+			}
+			var sig crypto.Signature
+			err = encoding.ReadObject(conn, &sig, crypto.SignatureSize)
+			if err != nil {
+				return err
+			}
+			latency = time.Since(rpcStart)
+			return modules.VerifySettings(settings, challenge, sig, pk)
 		}()
+		scan := modules.HostScan{Timestamp: start, Success: err == nil}
+		if err == nil {
+			scan.Latency = latency
+			scan.Settings = settings
+		}
 
 		// Now that network communication is done, lock the hostdb to modify the
-		// host entry.
-		id := hdb.mu.Lock()
+		// host entry. The scan is saved to disk with the next periodic save.
+		id = hdb.mu.Lock()
 		{
+			hdb.scanStatus.Pending--
+			hdb.scanStatus.RoundScans++
+			hostEntry.addScan(scan)
+			hdb.selectorTrees = nil
 			if err != nil {
-				hdb.decrementReliability(hostEntry.IPAddress, UnreachablePenalty)
+				hdb.decrementReliability(pk, UnreachablePenalty)
+				hdb.dirty = true
 				hdb.mu.Unlock(id)
 				continue
 			}
 
 			// Update the host settings, reliability, and weight. The old IPAddress
 			// must be preserved.
-			settings.IPAddress = hostEntry.HostSettings.IPAddress
+			settings.IPAddress = hostEntry.IPAddress
 			hostEntry.HostSettings = settings
+			hostEntry.ip = ip
 			hostEntry.reliability = MaxReliability
 			hostEntry.weight = hdb.hostWeight(*hostEntry)
 
 			// If the host is not already in the database and 'MaxActiveHosts' has not
 			// been reached, add the host to the database.
-			_, exists1 := hdb.activeHosts[hostEntry.IPAddress]
-			_, exists2 := hdb.allHosts[hostEntry.IPAddress]
+			key := hostKey(pk)
+			_, exists1 := hdb.activeHosts[key]
+			_, exists2 := hdb.allHosts[key]
 			if !exists1 && exists2 && len(hdb.activeHosts) < MaxActiveHosts {
 				hdb.insertNode(hostEntry)
 				hdb.notifySubscribers()
 			}
+			hdb.dirty = true
 		}
 		hdb.mu.Unlock(id)
 	}
 }
 
-// threadedScan is an ongoing function which will query the full set of hosts
-// every few hours to see who is online and available for uploading.
-func (hdb *HostDB) threadedScan() {
-	for {
-		// Determine who to scan. At most 'MaxActiveHosts' will be scanned,
-		// starting with the active hosts followed by a random selection of the
-		// inactive hosts.
-		id := hdb.mu.Lock()
-		{
-			// Scan all active hosts.
-			for _, host := range hdb.activeHosts {
-				hdb.scanHostEntry(host.hostEntry)
-			}
+// randomScanInterval returns a random time between the minimum and maximum
+// scan intervals. The randomness prevents the scanning from always happening
+// at the same time of day or week. randomScanInterval is called with the lock
+// held.
+func (hdb *HostDB) randomScanInterval() time.Duration {
+	min, max := hdb.scanSettings.MinScanInterval, hdb.scanSettings.MaxScanInterval
+	if max == min {
+		return min
+	}
+	randSleep, err := rand.Int(rand.Reader, big.NewInt(int64(max-min)))
+	if err != nil {
+		if build.DEBUG {
+			panic(err)
+		}
+		// If there's an error, sleep for the default amount of time.
+		return DefaultScanSleep
+	}
+	return time.Duration(randSleep.Int64()) + min
+}
 
-			// Assemble all of the inactive hosts into a single array.
-			var random []*hostEntry
-			for _, entry := range hdb.allHosts {
-				entry2, exists := hdb.activeHosts[entry.IPAddress]
-				if !exists {
-					random = append(random, entry)
-				} else {
-					if build.DEBUG {
-						if entry2.hostEntry != entry {
-							panic("allHosts + activeHosts mismatch!")
-						}
-					}
-				}
-			}
+// startProbeThreads starts enough probing threads to reach the number set in
+// the scan settings. startProbeThreads is called with the lock held.
+func (hdb *HostDB) startProbeThreads() {
+	for hdb.probeThreads < hdb.scanSettings.Threads {
+		hdb.probeThreads++
+		go hdb.threadedProbeHosts()
+	}
+}
+
+// scanRound queues every active host and a random selection of the inactive
+// hosts to be scanned, and schedules the next round. scanRound is called with
+// the lock held.
+func (hdb *HostDB) scanRound() {
+	// Scan all active hosts.
+	for _, host := range hdb.activeHosts {
+		hdb.scanHostEntry(host.hostEntry)
+	}
 
-			// Randomize the slice by swapping each element with an element
-			// that hasn't been visited yet.
-			for i := 0; i < len(random); i++ {
-				N, err := rand.Int(rand.Reader, big.NewInt(int64(len(random)-i-1)))
-				if err != nil {
-					if build.DEBUG {
-						panic(err)
-					}
-				} else {
-					break
+	// Assemble all of the inactive hosts into a single array.
+	var random []*hostEntry
+	for _, entry := range hdb.allHosts {
+		entry2, exists := hdb.activeHosts[hostKey(entry.PublicKey)]
+		if !exists {
+			random = append(random, entry)
+		} else {
+			if build.DEBUG {
+				if entry2.hostEntry != entry {
+					panic("allHosts + activeHosts mismatch!")
 				}
+			}
+		}
+	}
 
-				n := int(N.Int64()) + i
-				tmp := random[i]
-				random[i] = random[n]
-				random[n] = tmp
+	// Randomize the slice by swapping each element with an element that
+	// hasn't been visited yet.
+	for i := 0; i < len(random); i++ {
+		N, err := rand.Int(rand.Reader, big.NewInt(int64(len(random)-i)))
+		if err != nil {
+			if build.DEBUG {
+				panic(err)
 			}
+			break
+		}
+
+		n := int(N.Int64()) + i
+		tmp := random[i]
+		random[i] = random[n]
+		random[n] = tmp
+	}
+
+	// Select the first InactiveHostCheckups hosts from the shuffled list and
+	// scan them.
+	n := hdb.scanSettings.InactiveHostCheckups
+	if len(random) < n {
+		n = len(random)
+	}
+	for i := 0; i < n; i++ {
+		hdb.scanHostEntry(random[i])
+	}
 
-			// Select the first InactiveHostCheckupQuantity hosts from the
-			// shuffled list and scan them.
-			n := InactiveHostCheckupQuantity
-			if len(random) < InactiveHostCheckupQuantity {
-				n = len(random)
+	now := time.Now()
+	hdb.scanStatus.RoundStart = now
+	hdb.scanStatus.RoundScans = 0
+	hdb.scanStatus.NextRound = now.Add(hdb.randomScanInterval())
+}
+
+// threadedScan is an ongoing function which will query the full set of hosts
+// every few hours to see who is online and available for uploading. Between
+// rounds, it waits until the next round is due, waking early if the next round
+// is rescheduled.
+func (hdb *HostDB) threadedScan() {
+	for {
+		id := hdb.mu.Lock()
+		hdb.scanRound()
+		hdb.mu.Unlock(id)
+
+		for {
+			id = hdb.mu.RLock()
+			wait := hdb.scanStatus.NextRound.Sub(time.Now())
+			hdb.mu.RUnlock(id)
+			if wait <= 0 {
+				break
 			}
-			for i := 0; i < n; i++ {
-				hdb.scanHostEntry(random[i])
+			select {
+			case <-time.After(wait):
+			case <-hdb.scanWake:
 			}
 		}
-		hdb.mu.Unlock(id)
+	}
+}
 
-		// Sleep for a random amount of time before doing another round of
-		// scanning. The minimums and maximums keep the scan time reasonable,
-		// while the randomness prevents the scanning from always happening at
-		// the same time of day or week.
-		maxBig := big.NewInt(int64(MaxScanSleep))
-		minBig := big.NewInt(int64(MinScanSleep))
-		randSleep, err := rand.Int(rand.Reader, maxBig.Sub(maxBig, minBig))
-		if err != nil {
-			if build.DEBUG {
-				panic(err)
-			} else {
-				// If there's an error, sleep for the default amount of time.
-				defaultBig := big.NewInt(int64(DefaultScanSleep))
-				randSleep = defaultBig.Sub(defaultBig, minBig)
+// Rescan scans the host announced at 'addr' as soon as possible.
+func (hdb *HostDB) Rescan(addr modules.NetAddress) error {
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+
+	for _, entry := range hdb.allHosts {
+		if entry.IPAddress == addr {
+			hdb.scanHostEntry(entry)
+			return nil
+		}
+	}
+	return errUnknownHost
+}
+
+// RescanAll scans every known host, including the inactive ones, as soon as
+// possible.
+func (hdb *HostDB) RescanAll() {
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+
+	for _, entry := range hdb.allHosts {
+		hdb.scanHostEntry(entry)
+	}
+}
+
+// ScanSettings returns the settings that control scanning.
+func (hdb *HostDB) ScanSettings() modules.HostScanSettings {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+	return hdb.scanSettings
+}
+
+// ScanStatus returns the progress of the hostdb's scanning.
+func (hdb *HostDB) ScanStatus() modules.HostScanStatus {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+	return hdb.scanStatus
+}
+
+// SetScanSettings sets the settings that control scanning. Threads are
+// started or stopped to match the new number of threads, and the next round of
+// scanning is rescheduled if it falls outside the new intervals.
+func (hdb *HostDB) SetScanSettings(ss modules.HostScanSettings) error {
+	if ss.MinScanInterval <= 0 || ss.MinScanInterval > ss.MaxScanInterval {
+		return errBadScanInterval
+	}
+	if ss.Threads < 1 || ss.Threads > maxScanThreads {
+		return errBadScanThreads
+	}
+	if ss.InactiveHostCheckups < 0 {
+		return errBadCheckups
+	}
+
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+	hdb.scanSettings = ss
+	hdb.startProbeThreads()
+
+	// Reschedule the next round if it is due too early or too late.
+	status := &hdb.scanStatus
+	if !status.RoundStart.IsZero() {
+		wait := status.NextRound.Sub(status.RoundStart)
+		if wait < ss.MinScanInterval || wait > ss.MaxScanInterval {
+			status.NextRound = status.RoundStart.Add(hdb.randomScanInterval())
+			select {
+			case hdb.scanWake <- struct{}{}:
+			default:
 			}
 		}
-		time.Sleep(time.Duration(randSleep.Int64()) + MinScanSleep) // this means the MaxScanSleep is actual Max+Min.
 	}
+	return hdb.save()
 }
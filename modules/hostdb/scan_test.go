@@ -0,0 +1,89 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestSetScanSettings checks that invalid scan settings are rejected, and that
+// valid settings reschedule the next round of scanning.
+func TestSetScanSettings(t *testing.T) {
+	hdbt := newHDBTester("TestSetScanSettings", t)
+
+	bad := []struct {
+		ss  modules.HostScanSettings
+		err error
+	}{
+		{modules.HostScanSettings{MinScanInterval: 0, MaxScanInterval: time.Hour, Threads: 1}, errBadScanInterval},
+		{modules.HostScanSettings{MinScanInterval: 2 * time.Hour, MaxScanInterval: time.Hour, Threads: 1}, errBadScanInterval},
+		{modules.HostScanSettings{MinScanInterval: time.Hour, MaxScanInterval: time.Hour, Threads: 0}, errBadScanThreads},
+		{modules.HostScanSettings{MinScanInterval: time.Hour, MaxScanInterval: time.Hour, Threads: maxScanThreads + 1}, errBadScanThreads},
+		{modules.HostScanSettings{MinScanInterval: time.Hour, MaxScanInterval: time.Hour, Threads: 1, InactiveHostCheckups: -1}, errBadCheckups},
+	}
+	for _, b := range bad {
+		if err := hdbt.hostdb.SetScanSettings(b.ss); err != b.err {
+			t.Errorf("expected %v, got %v", b.err, err)
+		}
+	}
+
+	// The next round is hours away by default, so it should be rescheduled to
+	// fall within the new intervals.
+	ss := modules.HostScanSettings{MinScanInterval: time.Minute, MaxScanInterval: 2 * time.Minute, Threads: 2}
+	err := hdbt.hostdb.SetScanSettings(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdbt.hostdb.ScanSettings() != ss {
+		t.Error("scan settings were not set")
+	}
+	status := hdbt.hostdb.ScanStatus()
+	if wait := status.NextRound.Sub(status.RoundStart); wait < time.Minute || wait > 2*time.Minute {
+		t.Error("next round was not rescheduled:", wait)
+	}
+}
+
+// TestRescan checks that a host can be rescanned on demand, and that the scan
+// shows up in the scan status.
+func TestRescan(t *testing.T) {
+	hdbt := newHDBTester("TestRescan", t)
+
+	pk := hdbt.host.Settings().PublicKey
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address(), PublicKey: pk})
+	<-hdbt.hostdbUpdateChan
+
+	if err := hdbt.hostdb.Rescan("foo.com:1234"); err != errUnknownHost {
+		t.Error("expected errUnknownHost, got", err)
+	}
+	roundScans := hdbt.hostdb.ScanStatus().RoundScans
+	err := hdbt.hostdb.Rescan(hdbt.host.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForScans(hdbt, roundScans+1)
+	_, scans, _, _ := hdbt.hostdb.Host(hdbt.host.Address())
+	if len(scans) != 2 || !scans[1].Success {
+		t.Error("host was not rescanned:", scans)
+	}
+
+	hdbt.hostdb.RescanAll()
+	waitForScans(hdbt, roundScans+2)
+	_, scans, _, _ = hdbt.hostdb.Host(hdbt.host.Address())
+	if len(scans) != 3 {
+		t.Error("RescanAll did not rescan the host:", scans)
+	}
+}
+
+// waitForScans waits until no scans are pending and at least 'n' scans have
+// completed in the current round.
+func waitForScans(hdbt *hdbTester, n int) {
+	for i := 0; i < 100; i++ {
+		status := hdbt.hostdb.ScanStatus()
+		if status.Pending == 0 && status.RoundScans >= n {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
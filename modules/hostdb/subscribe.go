@@ -5,8 +5,10 @@ import (
 )
 
 // notifySubscribers tells each subscriber that the hostdb has received an
-// update.
+// update. The trees built for selectors are discarded, because the update may
+// have changed their weights.
 func (hdb *HostDB) notifySubscribers() {
+	hdb.selectorTrees = nil
 	for _, subscriber := range hdb.subscribers {
 		select {
 		case subscriber <- struct{}{}:
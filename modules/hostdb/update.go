@@ -2,7 +2,9 @@ package hostdb
 
 // update.go is responsible for finding new hosts and adding them to the
 // database. Currently, the blockchain is the only source for finding hosts,
-// and any host announcement in the blockchain is accepted with equal weight.
+// and any signed host announcement in the blockchain is accepted with equal
+// weight. A host that announces itself again under the same public key is
+// moved to the newly announced address.
 // The current implementation is trivially vulnerable to a sybil attack,
 // whereby a host can gain favoritism by announcing itself many times using
 // different addresses. We have chosen to ignore this vulnerability for the
@@ -11,36 +13,26 @@ package hostdb
 // coins burned.
 
 import (
-	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
 // findHostAnnouncements returns a list of the host announcements found within
-// a given block. No check is made to see that the ip address found in the
+// a given block. Announcements that are not signed by the announced key are
+// ignored. No check is made to see that the ip address found in the
 // announcement is actually a valid ip address.
-func findHostAnnouncements(b types.Block) (announcements []modules.HostSettings) {
+func findHostAnnouncements(b types.Block) (announcements []modules.HostAnnouncement) {
 	for _, t := range b.Transactions {
-		// the HostAnnouncement must be prefaced by the standard host
-		// announcement string
-		var prefix types.Specifier
 		for _, arb := range t.ArbitraryData {
-			copy(prefix[:], arb)
-			if prefix != modules.PrefixHostAnnouncement {
-				continue
-			}
-
-			// decode the HostAnnouncement
-			var ha modules.HostAnnouncement
-			err := encoding.Unmarshal(arb[types.SpecifierLen:], &ha)
+			// decode the HostAnnouncement, which must be prefaced by the
+			// standard host announcement string
+			ha, err := modules.DecodeAnnouncement(arb)
 			if err != nil {
 				continue
 			}
 
 			// Add the announcement to the slice being returned.
-			announcements = append(announcements, modules.HostSettings{
-				IPAddress: ha.IPAddress,
-			})
+			announcements = append(announcements, ha)
 		}
 	}
 
@@ -53,15 +45,16 @@ func (hdb *HostDB) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
 	id := hdb.mu.Lock()
 	defer hdb.mu.Unlock(id)
 
-	// Add hosts announced in blocks that were applied.
+	// Add hosts announced in blocks that were applied. The consensus height
+	// is the height of the block being applied, so that hosts can be weighed
+	// by the age of their first announcement.
+	hdb.consensusHeight -= len(cc.RevertedBlocks)
 	for _, block := range cc.AppliedBlocks {
-		for _, host := range findHostAnnouncements(block) {
-			hdb.insertHost(host)
+		for _, ha := range findHostAnnouncements(block) {
+			hdb.announceHost(ha)
 		}
+		hdb.consensusHeight++
 	}
-
-	hdb.consensusHeight -= len(cc.RevertedBlocks)
-	hdb.consensusHeight += len(cc.AppliedBlocks)
 	hdb.notifySubscribers()
 	return
 }
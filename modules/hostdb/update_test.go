@@ -3,15 +3,29 @@ package hostdb
 import (
 	"testing"
 
-	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// signedAnnouncement returns a host announcement for 'addr' signed by a new
+// key.
+func signedAnnouncement(addr modules.NetAddress, t *testing.T) []byte {
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	announcement, err := modules.CreateAnnouncement(addr, 0, types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return announcement
+}
+
 // TestFindHostAnnouncements probes the findHostAnnouncements function
 func TestFindHostAnnouncements(t *testing.T) {
 	// Create a block with a host announcement.
-	announcement := append(modules.PrefixHostAnnouncement[:], encoding.Marshal(modules.HostAnnouncement{})...)
+	announcement := signedAnnouncement("foo.com:1234", t)
 	b := types.Block{
 		Transactions: []types.Transaction{
 			types.Transaction{
@@ -21,7 +35,10 @@ func TestFindHostAnnouncements(t *testing.T) {
 	}
 	announcements := findHostAnnouncements(b)
 	if len(announcements) != 1 {
-		t.Error("host announcement not found in block")
+		t.Fatal("host announcement not found in block")
+	}
+	if announcements[0].IPAddress != "foo.com:1234" || len(announcements[0].PublicKey.Key) != crypto.PublicKeySize {
+		t.Error("host announcement was decoded incorrectly")
 	}
 
 	// Try with an altered prefix
@@ -38,6 +55,14 @@ func TestFindHostAnnouncements(t *testing.T) {
 	if len(announcements) != 0 {
 		t.Error("host announcement found when there was an invalid encoding of a host announcement")
 	}
+	b.Transactions[0].ArbitraryData[0][17]--
+
+	// Try with a bad signature.
+	b.Transactions[0].ArbitraryData[0][len(announcement)-1]++
+	announcements = findHostAnnouncements(b)
+	if len(announcements) != 0 {
+		t.Error("host announcement found when the signature was invalid")
+	}
 }
 
 // TestReceiveConsensusSetUpdate probes teh ReveiveConsensusSetUpdate method of
@@ -46,14 +71,12 @@ func TestReceiveConsensusSetUpdate(t *testing.T) {
 	hdbt := newHDBTester("TestFindHostAnnouncements", t)
 
 	// Put a host announcement into the blockchain.
-	announcement := encoding.Marshal(modules.HostAnnouncement{
-		IPAddress: hdbt.gateway.Address(),
-	})
+	announcement := signedAnnouncement(hdbt.gateway.Address(), t)
 	id, err := hdbt.wallet.RegisterTransaction(types.Transaction{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, _, err = hdbt.wallet.AddArbitraryData(id, append(modules.PrefixHostAnnouncement[:], announcement...))
+	_, _, err = hdbt.wallet.AddArbitraryData(id, announcement)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -85,3 +108,47 @@ func TestReceiveConsensusSetUpdate(t *testing.T) {
 		t.Fatal("hostdb should have a host after getting a host announcement transcation")
 	}
 }
+
+// TestAnnouncementReplay checks that an announcement only moves a known host
+// if it was made at a greater height than the one the host is known by.
+func TestAnnouncementReplay(t *testing.T) {
+	hdbt := newHDBTester("TestAnnouncementReplay", t)
+	hdb := hdbt.hostdb
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	announce := func(addr modules.NetAddress, height types.BlockHeight) {
+		data, err := modules.CreateAnnouncement(addr, height, spk, sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ha, err := modules.DecodeAnnouncement(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := hdb.mu.Lock()
+		hdb.announceHost(ha)
+		hdb.mu.Unlock(id)
+	}
+	address := func() modules.NetAddress {
+		id := hdb.mu.RLock()
+		defer hdb.mu.RUnlock(id)
+		return hdb.allHosts[hostKey(spk)].IPAddress
+	}
+
+	announce("foo.com:1234", 5)
+	announce("bar.com:1234", 8)
+	if address() != "bar.com:1234" {
+		t.Fatal("newer announcement did not move the host")
+	}
+
+	// Replaying the older announcement, or an announcement made at the same
+	// height, does not move the host back.
+	announce("foo.com:1234", 5)
+	announce("foo.com:1234", 8)
+	if address() != "bar.com:1234" {
+		t.Error("replayed announcement moved the host")
+	}
+}
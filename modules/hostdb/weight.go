@@ -0,0 +1,232 @@
+package hostdb
+
+// weight.go assigns weights to hosts. The weight of a host sets how likely it
+// is to be selected by RandomHosts. It is made up of a price weight, which
+// favors cheap hosts, multiplied by an adjustment for each of several other
+// factors, so that hosts which are cheap but unreliable, new, or slow are not
+// selected more often than hosts which are slightly more expensive but
+// dependable.
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// minAdjustment is the smallest adjustment that a single factor can
+	// apply before its exponent, so that a host with a poor showing in one
+	// factor can still be selected if it does well in the others.
+	minAdjustment = 0.1
+
+	// Hosts meeting these targets are not penalized for the corresponding
+	// factor. Hosts below them are penalized in proportion to how far short
+	// they fall.
+	targetStorage = 10e9                   // 10 GB
+	targetAge     = 4032                   // 4 weeks
+	targetLatency = 250 * time.Millisecond // Average time taken to fetch the settings of a host.
+
+	// maxWeightExponent is the largest exponent that can be given to a
+	// factor.
+	maxWeightExponent = 10
+)
+
+var (
+	// defaultWeightSettings are the weight settings used by a new hostdb.
+	// Price and uptime matter the most.
+	defaultWeightSettings = modules.HostWeightSettings{
+		PriceExponent:       3,
+		CollateralExponent:  1,
+		StorageExponent:     1,
+		UptimeExponent:      3,
+		AgeExponent:         1,
+		LatencyExponent:     1,
+		DurationExponent:    1,
+		InteractionExponent: 2,
+	}
+
+	// priceBaseWeight is the weight of a host before it is divided by the
+	// host's price raised to the price exponent. HostBaseWeight alone is not
+	// enough: a price of 10^14 hastings raised to the tenth power is 10^140,
+	// which would leave every host with a weight of zero. Each power of the
+	// price is given another 10^24 hastings, so that prices of up to one
+	// siacoin keep all of the precision of HostBaseWeight at any exponent.
+	priceBaseWeight = modules.HostBaseWeight.Mul(types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(24*maxWeightExponent), nil)))
+
+	errBadWeightSettings = errors.New("weight exponents must be between 0 and 10")
+)
+
+// adjustment returns the adjustment for a factor where the host has 'value'
+// and is expected to have at least 'target', raised to 'exponent'.
+func adjustment(value, target, exponent float64) float64 {
+	a := value / target
+	if a > 1 || math.IsNaN(a) {
+		a = 1
+	} else if a < minAdjustment {
+		a = minAdjustment
+	}
+	return math.Pow(a, exponent)
+}
+
+// priceWeight returns the base weight divided by the price of a host raised
+// to 'exponent'. Integer exponents are computed exactly.
+func priceWeight(price types.Currency, exponent float64) types.Currency {
+	// Prevent a divide by zero error by making sure the price is at least one.
+	if price.Cmp(types.NewCurrency64(0)) <= 0 {
+		price = types.NewCurrency64(1)
+	}
+
+	if exponent == math.Trunc(exponent) {
+		weight := priceBaseWeight
+		for i := 0; i < int(exponent); i++ {
+			weight = weight.Div(price)
+		}
+		return weight
+	}
+	p, _ := new(big.Float).SetInt(price.Big()).Float64()
+	return priceBaseWeight.MulFloat(math.Pow(p, -exponent))
+}
+
+// hostScore returns the weight of a host along with the factors that make it
+// up, according to the weight settings of the host database. hostScore is
+// called with the lock held.
+func (hdb *HostDB) hostScore(entry hostEntry) modules.HostScore {
+	ws := hdb.weightSettings
+	score := modules.HostScore{
+		IPAddress:   entry.IPAddress,
+		PublicKey:   entry.PublicKey,
+		PriceWeight: priceWeight(entry.Price, ws.PriceExponent),
+	}
+
+	// Hosts are expected to put up at least as much collateral as they
+	// charge.
+	collateral := float64(1)
+	if !entry.Price.IsZero() {
+		collateral, _ = new(big.Rat).SetFrac(entry.Collateral.Big(), entry.Price.Big()).Float64()
+	}
+	score.Collateral = adjustment(collateral, 1, ws.CollateralExponent)
+	score.Storage = adjustment(float64(entry.TotalStorage), targetStorage, ws.StorageExponent)
+
+	// Uptime is the fraction of recent scans that succeeded, and latency is
+	// the average time taken by the successful scans. Hosts that have not
+	// been scanned are not penalized.
+	var successes int
+	var latency time.Duration
+	for _, scan := range entry.history {
+		if scan.Success {
+			successes++
+			latency += scan.Latency
+		}
+	}
+	score.Uptime, score.Latency = 1, 1
+	if len(entry.history) > 0 {
+		score.Uptime = adjustment(float64(successes), float64(len(entry.history)), ws.UptimeExponent)
+	}
+	if successes > 0 && latency > 0 {
+		score.Latency = adjustment(float64(targetLatency), float64(latency/time.Duration(successes)), ws.LatencyExponent)
+	}
+
+	var age float64
+	if height := types.BlockHeight(hdb.consensusHeight); height > entry.firstSeen {
+		age = float64(height - entry.firstSeen)
+	}
+	score.Age = adjustment(age, targetAge, ws.AgeExponent)
+
+	score.Duration = 1
+	if ws.Duration != 0 {
+		score.Duration = adjustment(float64(entry.MaxDuration), float64(ws.Duration), ws.DurationExponent)
+	}
+
+	// Interactions is the fraction of recent interactions with the renter
+	// that succeeded. Hosts that the renter has not used are not penalized.
+	score.Interactions = 1
+	if len(entry.interactions) > 0 {
+		score.Interactions = adjustment(float64(entry.interactionSuccesses()), float64(len(entry.interactions)), ws.InteractionExponent)
+	}
+
+	score.Weight = score.PriceWeight.MulFloat(score.Collateral * score.Storage * score.Uptime * score.Age * score.Latency * score.Duration * score.Interactions)
+	return score
+}
+
+// hostWeight returns the weight of a host according to the settings of the
+// host database.
+func (hdb *HostDB) hostWeight(entry hostEntry) types.Currency {
+	return hdb.hostScore(entry).Weight
+}
+
+// candidate returns the view of a host that is given to a HostSelector.
+// candidate is called with the lock held.
+func (hdb *HostDB) candidate(entry *hostEntry) modules.HostCandidate {
+	return modules.HostCandidate{
+		Settings: entry.HostSettings,
+		Score:    hdb.hostScore(*entry),
+		History:  append([]modules.HostScan(nil), entry.history...),
+	}
+}
+
+// reweighHosts recomputes the weight of every host and rebuilds the tree of
+// active hosts. reweighHosts is called with the lock held.
+func (hdb *HostDB) reweighHosts() {
+	for _, entry := range hdb.allHosts {
+		entry.weight = hdb.hostWeight(*entry)
+	}
+	active := hdb.activeHosts
+	hdb.hostTree = nil
+	hdb.activeHosts = make(map[string]*hostNode)
+	for _, node := range active {
+		hdb.insertNode(node.hostEntry)
+	}
+	hdb.notifySubscribers()
+}
+
+// HostScores returns the breakdown of the weight of every host known to the
+// hostdb, sorted by weight with the heaviest host first.
+func (hdb *HostDB) HostScores() []modules.HostScore {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+
+	scores := make([]modules.HostScore, 0, len(hdb.allHosts))
+	for key, entry := range hdb.allHosts {
+		score := hdb.hostScore(*entry)
+		_, score.Active = hdb.activeHosts[key]
+		scores = append(scores, score)
+	}
+	sort.Sort(byWeight(scores))
+	return scores
+}
+
+// SetWeightSettings sets the settings used to weigh hosts, and reweighs every
+// host.
+func (hdb *HostDB) SetWeightSettings(ws modules.HostWeightSettings) error {
+	for _, exponent := range []float64{ws.PriceExponent, ws.CollateralExponent, ws.StorageExponent,
+		ws.UptimeExponent, ws.AgeExponent, ws.LatencyExponent, ws.DurationExponent, ws.InteractionExponent} {
+		if !(exponent >= 0 && exponent <= maxWeightExponent) {
+			return errBadWeightSettings
+		}
+	}
+
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+	hdb.weightSettings = ws
+	hdb.reweighHosts()
+	return hdb.save()
+}
+
+// WeightSettings returns the settings used to weigh hosts.
+func (hdb *HostDB) WeightSettings() modules.HostWeightSettings {
+	id := hdb.mu.RLock()
+	defer hdb.mu.RUnlock(id)
+	return hdb.weightSettings
+}
+
+// byWeight sorts host scores by weight, heaviest first.
+type byWeight []modules.HostScore
+
+func (s byWeight) Len() int           { return len(s) }
+func (s byWeight) Less(i, j int) bool { return s[i].Weight.Cmp(s[j].Weight) > 0 }
+func (s byWeight) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,162 @@
+package hostdb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestHostScore checks that each factor of a host's score penalizes the host
+// when it falls short.
+func TestHostScore(t *testing.T) {
+	hdbt := newHDBTester("TestHostScore", t)
+	hdb := hdbt.hostdb
+	ws := defaultWeightSettings
+	ws.Duration = 100
+	err := hdb.SetWeightSettings(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A host that meets every target has no penalties.
+	good := hostEntry{
+		HostSettings: modules.HostSettings{
+			TotalStorage: targetStorage,
+			MaxDuration:  100,
+			Price:        types.NewCurrency64(5),
+			Collateral:   types.NewCurrency64(5),
+		},
+		history: []modules.HostScan{{Success: true, Latency: time.Millisecond}},
+	}
+	id := hdb.mu.Lock()
+	hdb.consensusHeight = targetAge
+	score := hdb.hostScore(good)
+	hdb.mu.Unlock(id)
+	if score.Collateral != 1 || score.Storage != 1 || score.Uptime != 1 || score.Age != 1 || score.Latency != 1 || score.Duration != 1 {
+		t.Fatalf("host that meets every target was penalized: %+v", score)
+	}
+	if score.Weight.Cmp(score.PriceWeight) != 0 || score.PriceWeight.Cmp(priceBaseWeight.Div(types.NewCurrency64(125))) != 0 {
+		t.Error("wrong weight for host that meets every target:", score.Weight)
+	}
+
+	// A flaky host, which fails half of its scans, is penalized by the cube
+	// of its uptime. It should be outweighed by a host that charges 50% more.
+	flaky := good
+	flaky.history = []modules.HostScan{{Success: false}, {Success: true, Latency: time.Millisecond}}
+	pricey := good
+	pricey.Price = types.NewCurrency64(7)
+	pricey.Collateral = pricey.Price
+	id = hdb.mu.Lock()
+	flakyScore, priceyScore := hdb.hostScore(flaky), hdb.hostScore(pricey)
+	hdb.mu.Unlock(id)
+	if flakyScore.Uptime != 0.125 {
+		t.Error("wrong uptime adjustment for flaky host:", flakyScore.Uptime)
+	}
+	if flakyScore.Weight.Cmp(priceyScore.Weight) >= 0 {
+		t.Error("cheap but flaky host outweighs a reliable host")
+	}
+
+	// Hosts are penalized for small collateral, little storage, slow scans,
+	// a recent announcement, and a short MaxDuration.
+	poor := good
+	poor.Collateral = types.NewCurrency64(1)
+	poor.TotalStorage = targetStorage / 2
+	poor.history = []modules.HostScan{{Success: true, Latency: 2 * targetLatency}}
+	poor.firstSeen = targetAge / 2
+	poor.MaxDuration = 50
+	id = hdb.mu.Lock()
+	score = hdb.hostScore(poor)
+	hdb.mu.Unlock(id)
+	if score.Collateral != 0.2 || score.Storage != 0.5 || score.Latency != 0.5 || score.Age != 0.5 || score.Duration != 0.5 {
+		t.Errorf("wrong adjustments for host with poor settings: %+v", score)
+	}
+
+	// Penalties are ignored when their exponent is zero.
+	err = hdb.SetWeightSettings(modules.HostWeightSettings{PriceExponent: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = hdb.mu.Lock()
+	score = hdb.hostScore(poor)
+	hdb.mu.Unlock(id)
+	if score.Weight.Cmp(score.PriceWeight) != 0 {
+		t.Error("ignored factors affected the weight of a host")
+	}
+}
+
+// TestSetWeightSettings checks that bad weight settings are rejected, and
+// that changing the settings reweighs the active hosts.
+func TestSetWeightSettings(t *testing.T) {
+	hdbt := newHDBTester("TestSetWeightSettings", t)
+	for _, exp := range []float64{-1, maxWeightExponent + 1} {
+		err := hdbt.hostdb.SetWeightSettings(modules.HostWeightSettings{UptimeExponent: exp})
+		if err != errBadWeightSettings {
+			t.Error("expected errBadWeightSettings, got", err)
+		}
+	}
+
+	// Add the real host and wait for it to become active.
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address(), PublicKey: hdbt.host.Settings().PublicKey})
+	<-hdbt.hostdbUpdateChan
+	scores := hdbt.hostdb.HostScores()
+	if len(scores) != 1 || !scores[0].Active {
+		t.Fatalf("expected one active host, got %+v", scores)
+	}
+
+	// Weighing by price alone changes the weight of the host.
+	ws := modules.HostWeightSettings{PriceExponent: 1}
+	err := hdbt.hostdb.SetWeightSettings(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdbt.hostdb.WeightSettings() != ws {
+		t.Error("weight settings were not changed")
+	}
+	id := hdbt.hostdb.mu.RLock()
+	tree := hdbt.hostdb.hostTree
+	if tree.weight.Cmp(scores[0].Weight) == 0 || tree.weight.Cmp(priceWeight(hdbt.host.Settings().Price, 1)) != 0 {
+		t.Error("active host was not reweighed")
+	}
+	hdbt.hostdb.mu.RUnlock(id)
+}
+
+// TestLargePriceExponent checks that hosts with realistic prices can still be
+// selected when the price is raised to the largest exponent.
+func TestLargePriceExponent(t *testing.T) {
+	hdbt := newHDBTester("TestLargePriceExponent", t)
+	hdb := hdbt.hostdb
+	ws := defaultWeightSettings
+	ws.PriceExponent = maxWeightExponent
+	err := hdb.SetWeightSettings(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := hdb.mu.Lock()
+	for i, price := range []uint64{100e12, 1e15} {
+		entry := &hostEntry{
+			HostSettings: modules.HostSettings{
+				IPAddress: modules.NetAddress(fmt.Sprintf("%v.%v.%v.%v:9982", i+1, i+1, i+1, i+1)),
+				PublicKey: types.SiaPublicKey{Key: []byte{byte(i)}},
+				Price:     types.NewCurrency64(price),
+			},
+		}
+		entry.weight = hdb.hostWeight(*entry)
+		if entry.weight.IsZero() {
+			t.Error("host with a price of", price, "has no weight")
+		}
+		hdb.allHosts[hostKey(entry.PublicKey)] = entry
+		hdb.insertNode(entry)
+	}
+	if priceWeight(types.NewCurrency64(1e15), maxWeightExponent-0.5).IsZero() {
+		t.Error("fractional price exponent zeroed the price weight")
+	}
+	hdb.mu.Unlock(id)
+
+	if len(hdb.RandomHosts(2)) != 2 {
+		t.Error("hosts were not selected with a price exponent of", maxWeightExponent)
+	}
+}
@@ -13,6 +13,12 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// maxSelectorTrees is the number of selectors that SelectHosts keeps a
+	// tree for. Once it is reached, every tree is discarded.
+	maxSelectorTrees = 16
+)
+
 var (
 	ErrOverweight = errors.New("requested a too-heavy weight")
 )
@@ -122,7 +128,8 @@ func (hn *hostNode) recursiveInsert(entry *hostEntry) (nodesAdded int, newNode *
 // with 0 weight will never be selected, they are accetped into the tree.
 func (hdb *HostDB) insertNode(entry *hostEntry) {
 	// If there's already a host of the same id, remove that host.
-	priorEntry, exists := hdb.activeHosts[entry.IPAddress]
+	key := hostKey(entry.PublicKey)
+	priorEntry, exists := hdb.activeHosts[key]
 	if exists {
 		priorEntry.removeNode()
 	}
@@ -130,10 +137,10 @@ func (hdb *HostDB) insertNode(entry *hostEntry) {
 	// Insert the updated entry into the host tree.
 	if hdb.hostTree == nil {
 		hdb.hostTree = createNode(nil, entry)
-		hdb.activeHosts[entry.IPAddress] = hdb.hostTree
+		hdb.activeHosts[key] = hdb.hostTree
 	} else {
 		_, hostNode := hdb.hostTree.recursiveInsert(entry)
-		hdb.activeHosts[entry.IPAddress] = hostNode
+		hdb.activeHosts[key] = hostNode
 	}
 }
 
@@ -149,39 +156,105 @@ func (hn *hostNode) removeNode() {
 	}
 }
 
-// RandomHosts will pull up to 'num' random hosts from the hostdb. There will
-// be no repeats, but the length of the slice returned may be less than 'num',
-// and may even be 0. The hosts that get returned first have the higher
-// priority.
-func (hdb *HostDB) RandomHosts(count int) (hosts []modules.HostSettings) {
-	id := hdb.mu.Lock()
-	defer hdb.mu.Unlock(id)
+// restoreNode undoes removeNode, putting the entry of a node back into the
+// tree at the same place.
+func (hn *hostNode) restoreNode() {
+	hn.weight = hn.weight.Add(hn.hostEntry.weight)
+	hn.taken = true
+	current := hn.parent
+	for current != nil {
+		current.weight = current.weight.Add(hn.hostEntry.weight)
+		current = current.parent
+	}
+}
 
-	var removedEntries []*hostEntry
+// drawHosts draws up to 'count' hosts from 'tree' at random, in proportion to
+// their weight, skipping the hosts rejected by 'filter'. Every drawn node is
+// removed from the tree, so that it is not drawn again, and is returned in
+// 'drawn' so that the caller can restore it.
+func drawHosts(tree *hostNode, count int, filter *diversityFilter) (hosts []modules.HostSettings, drawn []*hostNode) {
 	for len(hosts) < count {
-		if hdb.hostTree == nil || hdb.hostTree.weight.IsZero() {
+		if tree == nil || tree.weight.IsZero() {
 			break
 		}
-		randWeight, err := rand.Int(rand.Reader, hdb.hostTree.weight.Big())
+		randWeight, err := rand.Int(rand.Reader, tree.weight.Big())
 		if err != nil {
 			break
 		}
-		node, err := hdb.hostTree.nodeAtWeight(types.NewCurrency(randWeight))
+		node, err := tree.nodeAtWeight(types.NewCurrency(randWeight))
 		if err != nil {
 			break
 		}
-		hosts = append(hosts, node.hostEntry.HostSettings)
 		node.removeNode()
-		delete(hdb.activeHosts, node.hostEntry.IPAddress)
-
-		// remove the entry from the hostdb so it won't be selected as a
-		// repeat.
-		removedEntries = append(removedEntries, node.hostEntry)
+		drawn = append(drawn, node)
+		if filter.admit(node.hostEntry) {
+			hosts = append(hosts, node.hostEntry.HostSettings)
+		}
 	}
+	return hosts, drawn
+}
+
+// RandomHosts will pull up to 'num' random hosts from the hostdb. There will
+// be no repeats, but the length of the slice returned may be less than 'num',
+// and may even be 0. The hosts that get returned first have the higher
+// priority. Hosts that share a subnet or operator with a host that has
+// already been selected are skipped, and recorded as exclusions.
+func (hdb *HostDB) RandomHosts(count int) (hosts []modules.HostSettings) {
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+
+	filter := hdb.newDiversityFilter()
+	hosts, drawn := drawHosts(hdb.hostTree, count, filter)
+	hdb.exclusions = filter.exclusions
 
 	// Add back all of the entries that got removed.
-	for _, entry := range removedEntries {
-		hdb.insertNode(entry)
+	for _, node := range drawn {
+		node.restoreNode()
+	}
+	return hosts
+}
+
+// selectorTree returns a tree of the active hosts weighed by 'selector'. The
+// tree is kept until the hostdb changes, so that the hosts are not weighed
+// again on every selection. selectorTree is called with the lock held.
+func (hdb *HostDB) selectorTree(selector modules.HostSelector) *hostNode {
+	if tree, exists := hdb.selectorTrees[selector]; exists {
+		return tree
+	}
+
+	var tree *hostNode
+	for _, node := range hdb.activeHosts {
+		entry := *node.hostEntry
+		entry.weight = selector.Weight(hdb.candidate(node.hostEntry))
+		if tree == nil {
+			tree = createNode(nil, &entry)
+		} else {
+			tree.recursiveInsert(&entry)
+		}
+	}
+	if hdb.selectorTrees == nil || len(hdb.selectorTrees) >= maxSelectorTrees {
+		hdb.selectorTrees = make(map[modules.HostSelector]*hostNode)
+	}
+	hdb.selectorTrees[selector] = tree
+	return tree
+}
+
+// SelectHosts is RandomHosts, except that the hosts are weighed by 'selector'
+// instead of by the hostdb. A separate tree of the active hosts is kept for
+// each selector.
+func (hdb *HostDB) SelectHosts(count int, selector modules.HostSelector) []modules.HostSettings {
+	id := hdb.mu.Lock()
+	defer hdb.mu.Unlock(id)
+
+	tree := hdb.selectorTree(selector)
+	filter := hdb.newDiversityFilter()
+	hosts, drawn := drawHosts(tree, count, filter)
+	hdb.exclusions = filter.exclusions
+
+	// Add back the entries that got removed, so that the tree can be used
+	// again.
+	for _, node := range drawn {
+		node.restoreNode()
 	}
 	return hosts
 }
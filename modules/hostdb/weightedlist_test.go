@@ -17,6 +17,12 @@ func fakeAddr(n uint8) modules.NetAddress {
 	return modules.NetAddress("127.0.0." + strconv.Itoa(int(n)) + ":0")
 }
 
+// fakeKey returns a types.SiaPublicKey to be used in a HostEntry. Hosts are
+// stored in the hostdb by their public key.
+func fakeKey(n uint8) types.SiaPublicKey {
+	return types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: []byte{n}}
+}
+
 // uniformTreeVerification checks that everything makes sense in the tree given
 // the number of entries that the tree is supposed to have and also given that
 // every entropy has the same weight.
@@ -74,7 +80,7 @@ func (hdbt *hdbTester) uniformTreeVerification(numEntries int) error {
 			break
 		}
 		node.removeNode()
-		delete(hdbt.hostdb.activeHosts, node.hostEntry.IPAddress)
+		delete(hdbt.hostdb.activeHosts, hostKey(node.hostEntry.PublicKey))
 
 		// remove the entry from the hostdb so it won't be selected as a
 		// repeat.
@@ -96,7 +102,7 @@ func TestWeightedList(t *testing.T) {
 	firstInsertions := 64
 	for i := 0; i < firstInsertions; i++ {
 		entry := hostEntry{
-			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i))},
+			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i)), PublicKey: fakeKey(uint8(i))},
 			weight:       types.NewCurrency64(10),
 		}
 		hdbt.hostdb.insertNode(&entry)
@@ -126,7 +132,7 @@ func TestWeightedList(t *testing.T) {
 		}
 
 		// Remove the entry and add it to the list of removed entries
-		err := hdbt.hostdb.RemoveHost(fakeAddr(randInt))
+		err := hdbt.hostdb.RemoveHost(fakeKey(randInt))
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -141,7 +147,7 @@ func TestWeightedList(t *testing.T) {
 	secondInsertions := 64
 	for i := firstInsertions; i < firstInsertions+secondInsertions; i++ {
 		entry := hostEntry{
-			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i))},
+			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i)), PublicKey: fakeKey(uint8(i))},
 			weight:       types.NewCurrency64(10),
 		}
 		hdbt.hostdb.insertNode(&entry)
@@ -166,7 +172,7 @@ func TestVariedWeights(t *testing.T) {
 	selections := 0
 	for i := 0; i < hostCount; i++ {
 		entry := hostEntry{
-			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i))},
+			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i)), PublicKey: fakeKey(uint8(i))},
 			weight:       types.NewCurrency64(uint64(i)),
 		}
 		hdbt.hostdb.insertNode(&entry)
@@ -181,7 +187,7 @@ func TestVariedWeights(t *testing.T) {
 		if len(randEntry) == 0 {
 			t.Fatal("no hosts!")
 		}
-		node, exists := hdbt.hostdb.activeHosts[randEntry[0].IPAddress]
+		node, exists := hdbt.hostdb.activeHosts[hostKey(randEntry[0].PublicKey)]
 		if !exists {
 			t.Fatal("can't find randomly selected node in tree")
 		}
@@ -211,7 +217,7 @@ func TestRepeatInsert(t *testing.T) {
 	hdbt := newHDBTester("TestRepeatInsert", t)
 
 	entry1 := hostEntry{
-		HostSettings: modules.HostSettings{IPAddress: fakeAddr(0)},
+		HostSettings: modules.HostSettings{IPAddress: fakeAddr(0), PublicKey: fakeKey(0)},
 		weight:       types.NewCurrency64(1),
 	}
 	entry2 := entry1
@@ -230,15 +236,15 @@ func TestRandomHosts(t *testing.T) {
 
 	// Insert 3 hosts to be selected.
 	entry1 := hostEntry{
-		HostSettings: modules.HostSettings{IPAddress: fakeAddr(1)},
+		HostSettings: modules.HostSettings{IPAddress: fakeAddr(1), PublicKey: fakeKey(1)},
 		weight:       types.NewCurrency64(1),
 	}
 	entry2 := hostEntry{
-		HostSettings: modules.HostSettings{IPAddress: fakeAddr(2)},
+		HostSettings: modules.HostSettings{IPAddress: fakeAddr(2), PublicKey: fakeKey(2)},
 		weight:       types.NewCurrency64(2),
 	}
 	entry3 := hostEntry{
-		HostSettings: modules.HostSettings{IPAddress: fakeAddr(3)},
+		HostSettings: modules.HostSettings{IPAddress: fakeAddr(3), PublicKey: fakeKey(3)},
 		weight:       types.NewCurrency64(3),
 	}
 	hdbt.hostdb.insertNode(&entry1)
@@ -310,3 +316,120 @@ func TestRandomHosts(t *testing.T) {
 		t.Error("doubled up")
 	}
 }
+
+// TestSelectHosts checks that SelectHosts weighs hosts with the built-in
+// selectors, and that it leaves the hostdb's own tree alone.
+func TestSelectHosts(t *testing.T) {
+	hdbt := newHDBTester("TestSelectHosts", t)
+	_, err := modules.NewHostSelector(modules.HostPolicy{Name: "fastest"})
+	if err != modules.ErrUnknownSelector {
+		t.Fatal("expected ErrUnknownSelector, got", err)
+	}
+	_, err = modules.NewHostSelector(modules.HostPolicy{Name: modules.SelectorCurated})
+	if err != modules.ErrNoCuratedHosts {
+		t.Fatal("expected ErrNoCuratedHosts, got", err)
+	}
+
+	// Host 1 is cheap but has failed every scan, host 2 is expensive and
+	// reliable, and host 3 is in between.
+	entries := []*hostEntry{
+		{HostSettings: modules.HostSettings{Price: types.NewCurrency64(1)}, history: []modules.HostScan{{Success: false}}},
+		{HostSettings: modules.HostSettings{Price: types.NewCurrency64(100)}, history: []modules.HostScan{{Success: true}}},
+		{HostSettings: modules.HostSettings{Price: types.NewCurrency64(10)}, history: []modules.HostScan{{Success: true}}},
+	}
+	id := hdbt.hostdb.mu.Lock()
+	for i, entry := range entries {
+		entry.IPAddress, entry.PublicKey = fakeAddr(uint8(i+1)), fakeKey(uint8(i+1))
+		entry.weight = types.NewCurrency64(1)
+		hdbt.hostdb.insertNode(entry)
+	}
+	hdbt.hostdb.mu.Unlock(id)
+
+	selectAll := func(policy modules.HostPolicy) []modules.HostSettings {
+		selector, err := modules.NewHostSelector(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hdbt.hostdb.SelectHosts(len(entries), selector)
+	}
+
+	// The reliable policy never selects the host that fails every scan.
+	for _, host := range selectAll(modules.HostPolicy{Name: modules.SelectorReliable}) {
+		if host.IPAddress == fakeAddr(1) {
+			t.Error("reliable policy selected an unreliable host")
+		}
+	}
+
+	// The curated policy only selects listed hosts.
+	hosts := selectAll(modules.HostPolicy{Name: modules.SelectorCurated, Hosts: []modules.NetAddress{fakeAddr(2)}})
+	if len(hosts) != 1 || hosts[0].IPAddress != fakeAddr(2) {
+		t.Error("curated policy selected the wrong hosts:", hosts)
+	}
+
+	// The cheapest policy almost always selects the cheapest host first.
+	for i := 0; i < 10; i++ {
+		if hosts := selectAll(modules.HostPolicy{Name: modules.SelectorCheapest}); len(hosts) != 3 || hosts[0].IPAddress != fakeAddr(1) {
+			t.Fatal("cheapest policy did not select the cheapest host first")
+		}
+	}
+
+	// The hostdb's own tree is unchanged.
+	if len(hdbt.hostdb.activeHosts) != 3 || hdbt.hostdb.hostTree.weight.Cmp(types.NewCurrency64(3)) != 0 {
+		t.Error("selecting hosts changed the hostdb's tree")
+	}
+}
+
+// TestSelectorTrees checks that SelectHosts reuses the tree it builds for a
+// selector until the hostdb changes.
+func TestSelectorTrees(t *testing.T) {
+	hdbt := newHDBTester("TestSelectorTrees", t)
+	hdb := hdbt.hostdb
+	selector, err := modules.NewHostSelector(modules.HostPolicy{Name: modules.SelectorCheapest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := hdb.mu.Lock()
+	for i := 1; i <= 2; i++ {
+		hdb.insertNode(&hostEntry{
+			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i)), PublicKey: fakeKey(uint8(i)), Price: types.NewCurrency64(1)},
+			weight:       types.NewCurrency64(1),
+		})
+	}
+	hdb.notifySubscribers()
+	hdb.mu.Unlock(id)
+
+	if len(hdb.SelectHosts(3, selector)) != 2 {
+		t.Fatal("wrong number of hosts selected")
+	}
+	id = hdb.mu.Lock()
+	tree := hdb.selectorTrees[selector]
+	hdb.mu.Unlock(id)
+	if tree == nil || tree.weight.Cmp(modules.HostBaseWeight.Mul(types.NewCurrency64(2))) != 0 {
+		t.Fatal("tree was not kept with every host in it")
+	}
+
+	// Selecting again uses the same tree, and the hosts drawn from it are
+	// put back.
+	if len(hdb.SelectHosts(3, selector)) != 2 {
+		t.Fatal("wrong number of hosts selected")
+	}
+	id = hdb.mu.Lock()
+	if hdb.selectorTrees[selector] != tree {
+		t.Error("tree was rebuilt without a change to the hostdb")
+	}
+	if tree.weight.Cmp(modules.HostBaseWeight.Mul(types.NewCurrency64(2))) != 0 {
+		t.Error("drawn hosts were not put back into the tree")
+	}
+
+	// A new host is selected once the hostdb changes.
+	hdb.insertNode(&hostEntry{
+		HostSettings: modules.HostSettings{IPAddress: fakeAddr(3), PublicKey: fakeKey(3), Price: types.NewCurrency64(1)},
+		weight:       types.NewCurrency64(1),
+	})
+	hdb.notifySubscribers()
+	hdb.mu.Unlock(id)
+	if len(hdb.SelectHosts(3, selector)) != 3 {
+		t.Error("tree was not rebuilt after the hostdb changed")
+	}
+}
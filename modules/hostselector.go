@@ -0,0 +1,130 @@
+package modules
+
+import (
+	"errors"
+	"math"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// Names of the built-in host selection policies.
+	SelectorDefault  = "default"
+	SelectorCheapest = "cheapest"
+	SelectorReliable = "reliable"
+	SelectorCurated  = "curated"
+)
+
+var (
+	ErrUnknownSelector = errors.New("unknown host selection policy")
+	ErrNoCuratedHosts  = errors.New("the curated policy requires a list of hosts")
+)
+
+// A HostCandidate is an active host that a HostSelector can weigh.
+type HostCandidate struct {
+	Settings HostSettings
+	Score    HostScore  // The weight assigned by the hostdb, and its factors.
+	History  []HostScan // The host's most recent scans, oldest first.
+}
+
+// A HostSelector decides how likely each host is to be selected. Hosts are
+// selected at random in proportion to their weight, and hosts with a weight
+// of zero are never selected. The hostdb reuses the weights given by a
+// selector until its hosts change, so a HostSelector must be comparable and
+// its weights must not change on their own.
+type HostSelector interface {
+	Weight(HostCandidate) types.Currency
+}
+
+// A HostPolicy names the HostSelector used to choose the hosts for an upload.
+// Unlike a HostSelector, it can be saved along with the file.
+type HostPolicy struct {
+	Name  string       // One of the Selector constants. Empty means SelectorDefault.
+	Hosts []NetAddress // The hosts allowed by SelectorCurated.
+}
+
+// NewHostSelector returns the built-in HostSelector named by 'policy'.
+func NewHostSelector(policy HostPolicy) (HostSelector, error) {
+	switch policy.Name {
+	case "", SelectorDefault:
+		return defaultSelector{}, nil
+	case SelectorCheapest:
+		return cheapestSelector{}, nil
+	case SelectorReliable:
+		return reliableSelector{}, nil
+	case SelectorCurated:
+		if len(policy.Hosts) == 0 {
+			return nil, ErrNoCuratedHosts
+		}
+		cs := &curatedSelector{hosts: make(map[NetAddress]struct{})}
+		for _, addr := range policy.Hosts {
+			cs.hosts[addr] = struct{}{}
+		}
+		return cs, nil
+	}
+	return nil, ErrUnknownSelector
+}
+
+// selectorPriceWeight returns the base weight divided by the price of a host
+// raised to 'exponent'.
+func selectorPriceWeight(price types.Currency, exponent int) types.Currency {
+	if price.IsZero() {
+		price = types.NewCurrency64(1)
+	}
+	weight := HostBaseWeight
+	for i := 0; i < exponent; i++ {
+		weight = weight.Div(price)
+	}
+	return weight
+}
+
+// defaultSelector weighs hosts by the weight assigned to them by the hostdb.
+type defaultSelector struct{}
+
+func (defaultSelector) Weight(hc HostCandidate) types.Currency {
+	return hc.Score.Weight
+}
+
+// cheapestSelector ignores every factor but price, and favors cheap hosts
+// more strongly than the hostdb does by default: a host that charges half as
+// much is 64 times as likely to be selected.
+type cheapestSelector struct{}
+
+func (cheapestSelector) Weight(hc HostCandidate) types.Currency {
+	return selectorPriceWeight(hc.Settings.Price, 6)
+}
+
+// reliableSelector favors hosts that rarely fail scans. The weight is
+// proportional to the fraction of recent scans that succeeded raised to the
+// tenth power, and only inversely proportional to price, so that a host that
+// failed one scan in ten is about a third as likely to be selected as a host
+// that failed none.
+type reliableSelector struct{}
+
+func (reliableSelector) Weight(hc HostCandidate) types.Currency {
+	uptime := float64(1)
+	if len(hc.History) > 0 {
+		var successes int
+		for _, scan := range hc.History {
+			if scan.Success {
+				successes++
+			}
+		}
+		uptime = float64(successes) / float64(len(hc.History))
+	}
+	return selectorPriceWeight(hc.Settings.Price, 1).MulFloat(math.Pow(uptime, 10))
+}
+
+// curatedSelector only selects hosts from a list of addresses. Hosts on the
+// list are weighed by the hostdb's weights. It is used through a pointer,
+// because a map cannot be compared.
+type curatedSelector struct {
+	hosts map[NetAddress]struct{}
+}
+
+func (cs curatedSelector) Weight(hc HostCandidate) types.Currency {
+	if _, ok := cs.hosts[hc.Settings.IPAddress]; !ok {
+		return types.Currency{}
+	}
+	return hc.Score.Weight
+}
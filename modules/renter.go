@@ -17,6 +17,10 @@ type FileUploadParams struct {
 	Duration types.BlockHeight
 	Nickname string
 	Pieces   int
+
+	// HostPolicy chooses the hosts that the file is uploaded to, both now
+	// and when the file is repaired.
+	HostPolicy HostPolicy
 }
 
 // FileInfo is an interface providing information about a file.
@@ -1,6 +1,7 @@
 package renter
 
 import (
+	"bytes"
 	"crypto/rand"
 	"errors"
 	"io"
@@ -12,10 +13,14 @@ import (
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 var (
 	downloadAttempts = 5
+
+	errDownloadBudgetExhausted = errors.New("file contract does not have enough coins left to pay for the download")
+	errNoDownloadBudget        = errors.New("file contract cannot pay for downloads")
 )
 
 // A Download is a file download that has been queued by the renter. It
@@ -34,6 +39,7 @@ type Download struct {
 
 	pieces []filePiece
 	file   *os.File
+	renter *Renter
 }
 
 // StartTime returns when the download was initiated.
@@ -74,9 +80,30 @@ func (d *Download) Write(b []byte) (int, error) {
 	return n, err
 }
 
-// downloadPiece attempts to retrieve a file piece from a host.
-func (d *Download) downloadPiece(piece filePiece) error {
-	conn, err := net.DialTimeout("tcp", string(piece.HostIP), 10e9)
+// hostAddress returns the current address of the host storing a piece. Hosts
+// can announce new addresses under the same public key, so the hostdb is
+// checked before falling back to the address the piece was uploaded to.
+func (r *Renter) hostAddress(piece filePiece) modules.NetAddress {
+	if len(piece.UnlockConditions.PublicKeys) != 2 {
+		return piece.HostIP
+	}
+	hostKey := piece.UnlockConditions.PublicKeys[1]
+	for _, host := range r.hostDB.AllHosts() {
+		if host.PublicKey.Algorithm == hostKey.Algorithm && bytes.Equal(host.PublicKey.Key, hostKey.Key) {
+			return host.IPAddress
+		}
+	}
+	return piece.HostIP
+}
+
+// downloadPiece attempts to retrieve a file piece from a host. The outcome is
+// reported to the hostdb unless the download failed because of the renter.
+func (d *Download) downloadPiece(piece filePiece) (err error) {
+	addr := d.renter.hostAddress(piece)
+	defer func() {
+		d.renter.reportInteraction(addr, modules.InteractionDownload, err)
+	}()
+	conn, err := net.DialTimeout("tcp", string(addr), 10e9)
 	if err != nil {
 		return err
 	}
@@ -91,12 +118,49 @@ func (d *Download) downloadPiece(piece filePiece) error {
 		return err
 	}
 
+	// Prove to the host that we control the contract by signing its
+	// challenge.
+	var challenge crypto.Hash
+	if err := encoding.ReadObject(conn, &challenge, crypto.HashSize); err != nil {
+		return err
+	}
+	sig, err := crypto.SignHash(modules.RetrieveChallengeHash(piece.ContractID, challenge), piece.RevisionKey)
+	if err != nil {
+		return localError{err}
+	}
+	if err := encoding.WriteObject(conn, sig); err != nil {
+		return err
+	}
+	var response string
+	if err := encoding.ReadObject(conn, &response, 128); err != nil {
+		return err
+	}
+	if response != modules.AcceptTermsResponse {
+		return errors.New(response)
+	}
+	var price types.Currency
+	if err := encoding.ReadObject(conn, &price, 256); err != nil {
+		return err
+	}
+
+	// Payments made during earlier downloads have revised the contract.
+	if fc, exists := d.renter.contract(piece.ContractID); exists {
+		piece.Contract = fc
+	}
+
 	// Simultaneously download, decrypt, and calculate the Merkle root of the file.
 	tee := io.TeeReader(
-		// Use a LimitedReader to ensure we don't read indefinitely.
-		io.LimitReader(conn, int64(piece.Contract.FileSize)),
+		// Use a downloadReader to pay for the data and to ensure we don't read
+		// indefinitely.
+		&downloadReader{
+			conn:   conn,
+			price:  price,
+			piece:  &piece,
+			renter: d.renter,
+			unread: piece.Contract.FileSize,
+		},
 		// Write the decrypted bytes to the file.
-		piece.EncryptionKey.NewWriter(d),
+		localWriter{piece.EncryptionKey.NewWriter(d)},
 	)
 	merkleRoot, err := crypto.ReaderMerkleRoot(tee)
 	if err != nil {
@@ -110,6 +174,130 @@ func (d *Download) downloadPiece(piece filePiece) error {
 	return nil
 }
 
+// paymentRevision returns a revision of a file contract that moves 'payment'
+// from the renter's download budget to the host. The budget is held in the
+// second valid and missed proof outputs of the contract. In the missed proof
+// outputs the payment moves to the first output, so that the renter cannot get
+// the payment back by making the host miss its storage proof.
+func paymentRevision(fcid types.FileContractID, fc types.FileContract, uc types.UnlockConditions, payment types.Currency) (types.FileContractRevision, error) {
+	rev := types.FileContractRevision{
+		ParentID:              fcid,
+		UnlockConditions:      uc,
+		NewRevisionNumber:     fc.RevisionNumber + 1,
+		NewFileSize:           fc.FileSize,
+		NewFileMerkleRoot:     fc.FileMerkleRoot,
+		NewWindowStart:        fc.WindowStart,
+		NewWindowEnd:          fc.WindowEnd,
+		NewValidProofOutputs:  fc.ValidProofOutputs,
+		NewMissedProofOutputs: fc.MissedProofOutputs,
+		NewUnlockHash:         fc.UnlockHash,
+	}
+	if payment.IsZero() {
+		return rev, nil
+	}
+	if len(fc.ValidProofOutputs) != 2 || len(fc.MissedProofOutputs) != 2 {
+		return types.FileContractRevision{}, errNoDownloadBudget
+	}
+	if fc.ValidProofOutputs[1].Value.Cmp(payment) < 0 || fc.MissedProofOutputs[1].Value.Cmp(payment) < 0 {
+		return types.FileContractRevision{}, errDownloadBudgetExhausted
+	}
+	rev.NewValidProofOutputs = []types.SiacoinOutput{
+		{Value: fc.ValidProofOutputs[0].Value.Add(payment), UnlockHash: fc.ValidProofOutputs[0].UnlockHash},
+		{Value: fc.ValidProofOutputs[1].Value.Sub(payment), UnlockHash: fc.ValidProofOutputs[1].UnlockHash},
+	}
+	rev.NewMissedProofOutputs = []types.SiacoinOutput{
+		{Value: fc.MissedProofOutputs[0].Value.Add(payment), UnlockHash: fc.MissedProofOutputs[0].UnlockHash},
+		{Value: fc.MissedProofOutputs[1].Value.Sub(payment), UnlockHash: fc.MissedProofOutputs[1].UnlockHash},
+	}
+	return rev, nil
+}
+
+// signRevision returns the renter's signature of a file contract revision.
+func signRevision(rev types.FileContractRevision, key crypto.SecretKey) (types.TransactionSignature, error) {
+	txn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev},
+		TransactionSignatures: []types.TransactionSignature{{
+			ParentID:       crypto.Hash(rev.ParentID),
+			CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+			PublicKeyIndex: 0,
+		}},
+	}
+	sig, err := crypto.SignHash(txn.SigHash(0), key)
+	if err != nil {
+		return types.TransactionSignature{}, err
+	}
+	txn.TransactionSignatures[0].Signature = sig[:]
+	return txn.TransactionSignatures[0], nil
+}
+
+// A downloadReader reads a file piece from a host, paying the host for each
+// chunk of the piece before the chunk is sent.
+type downloadReader struct {
+	conn   net.Conn
+	price  types.Currency
+	piece  *filePiece
+	renter *Renter
+
+	chunkRemaining uint64 // Bytes of the current chunk that have not been read.
+	unread         uint64 // Bytes of the piece that have not been read.
+}
+
+// pay sends the host a payment for the next 'chunkSize' bytes of the piece.
+// The renter's record of the contract is updated as soon as the payment is
+// sent. If the host rejects the payment, the next payment will include
+// whatever the host did not receive. Running out of download budget is not
+// the host's fault, so it is returned as a localError.
+func (dr *downloadReader) pay(chunkSize uint64) error {
+	rev, err := paymentRevision(dr.piece.ContractID, dr.piece.Contract, dr.piece.UnlockConditions, dr.price.Mul(types.NewCurrency64(chunkSize)))
+	if err != nil {
+		return localError{err}
+	}
+	sig, err := signRevision(rev, dr.piece.RevisionKey)
+	if err != nil {
+		return localError{err}
+	}
+	err = encoding.WriteObject(dr.conn, rev)
+	if err != nil {
+		return err
+	}
+	err = encoding.WriteObject(dr.conn, sig)
+	if err != nil {
+		return err
+	}
+
+	dr.piece.Contract.RevisionNumber = rev.NewRevisionNumber
+	dr.piece.Contract.ValidProofOutputs = rev.NewValidProofOutputs
+	dr.piece.Contract.MissedProofOutputs = rev.NewMissedProofOutputs
+	dr.renter.updateContract(dr.piece.ContractID, dr.piece.Contract)
+	return nil
+}
+
+// Read implements the io.Reader interface.
+func (dr *downloadReader) Read(b []byte) (int, error) {
+	if dr.unread == 0 {
+		return 0, io.EOF
+	}
+	if dr.chunkRemaining == 0 {
+		dr.chunkRemaining = modules.DownloadChunkSize
+		if dr.unread < dr.chunkRemaining {
+			dr.chunkRemaining = dr.unread
+		}
+		if !dr.price.IsZero() {
+			err := dr.pay(dr.chunkRemaining)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if uint64(len(b)) > dr.chunkRemaining {
+		b = b[:dr.chunkRemaining]
+	}
+	n, err := dr.conn.Read(b)
+	dr.chunkRemaining -= uint64(n)
+	dr.unread -= uint64(n)
+	return n, err
+}
+
 // newDownload initializes a new Download object.
 func newDownload(file *file, destination string) (*Download, error) {
 	// Create the download destination file.
@@ -140,6 +328,7 @@ func newDownload(file *file, destination string) (*Download, error) {
 
 		pieces: activePieces,
 		file:   handle,
+		renter: file.renter,
 	}, nil
 }
 
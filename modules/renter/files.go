@@ -59,6 +59,9 @@ type filePiece struct {
 	PieceIndex    int // Indicates the erasure coding index of this piece.
 	EncryptionKey crypto.TwofishKey
 	Checksum      crypto.Hash
+
+	UnlockConditions types.UnlockConditions // The conditions for revising the contract.
+	RevisionKey      crypto.SecretKey       // The renter's key for signing revisions.
 }
 
 // Available indicates whether the file is ready to be downloaded.
@@ -205,3 +208,32 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 	r.save()
 	return nil
 }
+
+// contract returns the renter's latest record of a file contract.
+func (r *Renter) contract(id types.FileContractID) (types.FileContract, bool) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	for _, f := range r.files {
+		for i := range f.Pieces {
+			if f.Pieces[i].ContractID == id {
+				return f.Pieces[i].Contract, true
+			}
+		}
+	}
+	return types.FileContract{}, false
+}
+
+// updateContract replaces the renter's record of a file contract after the
+// contract has been revised.
+func (r *Renter) updateContract(id types.FileContractID, fc types.FileContract) {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	for _, f := range r.files {
+		for i := range f.Pieces {
+			if f.Pieces[i].ContractID == id {
+				f.Pieces[i].Contract = fc
+			}
+		}
+	}
+	r.save()
+}
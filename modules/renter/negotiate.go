@@ -16,19 +16,23 @@ import (
 
 const (
 	defaultWindowSize = 288 // 48 Hours
+
+	// downloadsPerContract is the number of times that each file piece can
+	// be downloaded using the download budget of its contract.
+	downloadsPerContract = 3
 )
 
 // createContractTransaction takes contract terms and a merkle root and uses
 // them to build a transaction containing a file contract that satisfies the
-// terms, including providing an input balance. The transaction does not get
-// signed.
-func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRoot crypto.Hash) (txn types.Transaction, id string, err error) {
+// terms, including providing an input balance. The contract can be revised
+// by whoever can satisfy 'unlockHash'. The transaction does not get signed.
+func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRoot crypto.Hash, unlockHash types.UnlockHash) (txn types.Transaction, id string, err error) {
 	// Get the payout as set by the missed proofs, and the client fund as determined by the terms.
 	sizeCurrency := types.NewCurrency64(terms.FileSize)
 	durationCurrency := types.NewCurrency64(uint64(terms.Duration))
 	clientCost := terms.Price.Mul(sizeCurrency).Mul(durationCurrency)
 	hostCollateral := terms.Collateral.Mul(sizeCurrency).Mul(durationCurrency)
-	payout := clientCost.Add(hostCollateral)
+	payout := clientCost.Add(hostCollateral).Add(terms.DownloadBudget)
 
 	// Fill out the contract.
 	contract := types.FileContract{
@@ -39,6 +43,7 @@ func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRo
 		Payout:             payout,
 		ValidProofOutputs:  terms.ValidProofOutputs,
 		MissedProofOutputs: terms.MissedProofOutputs,
+		UnlockHash:         unlockHash,
 	}
 
 	// Create the transaction.
@@ -46,7 +51,7 @@ func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRo
 	if err != nil {
 		return
 	}
-	_, err = r.wallet.FundTransaction(id, clientCost)
+	_, err = r.wallet.FundTransaction(id, clientCost.Add(terms.DownloadBudget))
 	if err != nil {
 		return
 	}
@@ -58,6 +63,50 @@ func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRo
 	return
 }
 
+// A localError is an error caused by the renter rather than by the host it is
+// interacting with, such as a wallet or disk error. localErrors do not count
+// against the host.
+type localError struct {
+	error
+}
+
+// A localReader marks the errors of a reader of local data as localErrors.
+type localReader struct {
+	io.Reader
+}
+
+// Read implements the io.Reader interface.
+func (lr localReader) Read(b []byte) (int, error) {
+	n, err := lr.Reader.Read(b)
+	if err != nil && err != io.EOF {
+		err = localError{err}
+	}
+	return n, err
+}
+
+// A localWriter marks the errors of a writer of local data as localErrors.
+type localWriter struct {
+	io.Writer
+}
+
+// Write implements the io.Writer interface.
+func (lw localWriter) Write(b []byte) (int, error) {
+	n, err := lw.Writer.Write(b)
+	if err != nil {
+		err = localError{err}
+	}
+	return n, err
+}
+
+// reportInteraction reports the outcome of an interaction with a host to the
+// hostdb. Interactions that failed because of the renter are not reported.
+func (r *Renter) reportInteraction(addr modules.NetAddress, kind string, err error) {
+	if _, local := err.(localError); local {
+		return
+	}
+	r.hostDB.ReportInteraction(addr, kind, err == nil)
+}
+
 // An uploadWriter writes bytes while updating the piece's 'Transferred'
 // field.
 type uploadWriter struct {
@@ -75,8 +124,9 @@ func (uw *uploadWriter) Write(b []byte) (int, error) {
 
 // negotiateContract creates a file contract for a host according to the
 // requests of the host. There is an assumption that only hosts with acceptable
-// terms will be put into the hostdb.
-func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUploadParams, piece *filePiece) error {
+// terms will be put into the hostdb. Once the host has been contacted, the
+// outcome of the negotiation is reported to the hostdb.
+func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUploadParams, piece *filePiece) (err error) {
 	lockID := r.mu.RLock()
 	height := r.blockHeight
 	r.mu.RUnlock(lockID)
@@ -86,6 +136,18 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 		return err
 	}
 
+	// Generate the key that the renter uses to sign revisions of the
+	// contract.
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		return err
+	}
+	renterKey := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       pk[:],
+	}
+	unlockConditions := modules.ContractUnlockConditions(renterKey, host.PublicKey)
+
 	file, err := os.Open(up.Filename)
 	if err != nil {
 		return err
@@ -104,8 +166,9 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 	durationCurrency := types.NewCurrency64(uint64(up.Duration))
 	clientCost := host.Price.Mul(sizeCurrency).Mul(durationCurrency)
 	hostCollateral := host.Collateral.Mul(sizeCurrency).Mul(durationCurrency)
-	payout := clientCost.Add(hostCollateral)
-	validOutputValue := payout.Sub(types.FileContract{Payout: payout}.Tax())
+	downloadBudget := host.DownloadPrice.Mul(sizeCurrency).Mul(types.NewCurrency64(downloadsPerContract))
+	payout := clientCost.Add(hostCollateral).Add(downloadBudget)
+	validOutputValue := payout.Sub(types.FileContract{Payout: payout}.Tax()).Sub(downloadBudget)
 
 	// Create the contract terms.
 	terms := modules.ContractTerms{
@@ -123,6 +186,20 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 		MissedProofOutputs: []types.SiacoinOutput{
 			{Value: validOutputValue, UnlockHash: types.ZeroUnlockHash},
 		},
+
+		RenterKey:      renterKey,
+		DownloadBudget: downloadBudget,
+	}
+
+	// The download budget is returned to the renter unless it is spent.
+	if !downloadBudget.IsZero() {
+		refundAddress, _, err := r.wallet.CoinAddress(false) // false indicates that the address should not be visible to the user
+		if err != nil {
+			return err
+		}
+		refund := types.SiacoinOutput{Value: downloadBudget, UnlockHash: refundAddress}
+		terms.ValidProofOutputs = append(terms.ValidProofOutputs, refund)
+		terms.MissedProofOutputs = append(terms.MissedProofOutputs, refund)
 	}
 
 	// TODO: This is a hackish sleep, we need to be certain that all dependent
@@ -131,7 +208,11 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 	// transactions are automatically provided.
 	time.Sleep(types.RenterZeroConfDelay)
 
-	// Perform the negotiations with the host through a network call.
+	// Perform the negotiations with the host through a network call. Errors
+	// from this point on reflect on the host, unless they are localErrors.
+	defer func() {
+		r.reportInteraction(host.IPAddress, modules.InteractionNegotiate, err)
+	}()
 	conn, err := net.DialTimeout("tcp", string(host.IPAddress), 10e9)
 	if err != nil {
 		return err
@@ -157,7 +238,7 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 	// Encrypt and transmit the file data while calculating its Merkle root.
 	tee := io.TeeReader(
 		// wrap file reader in encryption layer
-		key.NewReader(file),
+		localReader{key.NewReader(file)},
 		// each byte we read from tee will also be written to conn;
 		// the uploadWriter updates the piece's 'Transferred' field
 		&uploadWriter{piece, conn},
@@ -171,9 +252,9 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 	// transaction is created sooner, which will impact the user's wallet
 	// balance faster vs. waiting for the whole thing to upload before
 	// affecting the user's balance.
-	unsignedTxn, txnRef, err := r.createContractTransaction(terms, merkleRoot)
+	unsignedTxn, txnRef, err := r.createContractTransaction(terms, merkleRoot, unlockConditions.UnlockHash())
 	if err != nil {
-		return err
+		return localError{err}
 	}
 
 	// Send the unsigned transaction to the host.
@@ -193,12 +274,12 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 	for i := len(unsignedTxn.SiacoinInputs); i < len(collateralTxn.SiacoinInputs); i++ {
 		_, _, err = r.wallet.AddSiacoinInput(txnRef, collateralTxn.SiacoinInputs[i])
 		if err != nil {
-			return err
+			return localError{err}
 		}
 	}
 	signedTxn, err := r.wallet.SignTransaction(txnRef, true)
 	if err != nil {
-		return err
+		return localError{err}
 	}
 
 	// Send the signed transaction back to the host.
@@ -228,6 +309,8 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 	piece.ContractID = signedTxn.FileContractID(0)
 	piece.HostIP = host.IPAddress
 	piece.EncryptionKey = key
+	piece.UnlockConditions = unlockConditions
+	piece.RevisionKey = sk
 	r.save()
 	r.mu.Unlock(lockID)
 
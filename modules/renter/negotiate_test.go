@@ -0,0 +1,51 @@
+package renter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// A reportingHostDB records the interactions reported to it.
+type reportingHostDB struct {
+	modules.HostDB
+	reports []bool
+}
+
+// ReportInteraction implements modules.HostDB.
+func (hdb *reportingHostDB) ReportInteraction(addr modules.NetAddress, kind string, success bool) {
+	hdb.reports = append(hdb.reports, success)
+}
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("disk failure") }
+
+// TestReportInteraction checks that failures caused by the renter do not count
+// against hosts.
+func TestReportInteraction(t *testing.T) {
+	hdb := new(reportingHostDB)
+	r := &Renter{hostDB: hdb}
+
+	r.reportInteraction("foo:1", modules.InteractionDownload, nil)
+	r.reportInteraction("foo:1", modules.InteractionDownload, errors.New("bad data"))
+	r.reportInteraction("foo:1", modules.InteractionDownload, localError{errDownloadBudgetExhausted})
+	if len(hdb.reports) != 2 || !hdb.reports[0] || hdb.reports[1] {
+		t.Fatal("wrong interactions reported:", hdb.reports)
+	}
+
+	// Errors reading local data are localErrors, but the end of the data is
+	// not an error.
+	_, err := io.Copy(new(bytes.Buffer), localReader{bytes.NewReader([]byte("foo"))})
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+	_, err = localReader{errReader{}}.Read(make([]byte, 1))
+	if _, local := err.(localError); !local {
+		t.Error("read error was not marked as a localError:", err)
+	}
+}
@@ -1,12 +1,21 @@
 package renter
 
+import (
+	"github.com/NebulousLabs/Sia/modules"
+)
+
 // scanAllFiles checks all files for pieces that are not yet active and then
-// uploads them to the network.
+// uploads them to the network, choosing hosts with the host policy that the
+// file was uploaded with.
 func (r *Renter) scanAllFiles() {
 	for _, file := range r.files {
+		selector, err := modules.NewHostSelector(file.UploadParams.HostPolicy)
+		if err != nil {
+			continue
+		}
 		for i := range file.Pieces {
 			if !file.Pieces[i].Active && !file.Pieces[i].Repairing {
-				hosts := r.hostDB.RandomHosts(1)
+				hosts := r.hostDB.SelectHosts(1, selector)
 				if len(hosts) == 1 {
 					go r.threadedUploadPiece(hosts[0], file.UploadParams, &file.Pieces[i])
 				}
@@ -24,8 +24,9 @@ var (
 
 // checkWalletBalance looks at an upload and determines if there is enough
 // money in the wallet to support such an upload. An error is returned if it is
-// determined that there is not enough money.
-func (r *Renter) checkWalletBalance(up modules.FileUploadParams) error {
+// determined that there is not enough money. The price is estimated from the
+// hosts that 'selector' would choose.
+func (r *Renter) checkWalletBalance(up modules.FileUploadParams, selector modules.HostSelector) error {
 	// Get the size of the file.
 	fileInfo, err := os.Stat(up.Filename)
 	if err != nil {
@@ -35,7 +36,7 @@ func (r *Renter) checkWalletBalance(up modules.FileUploadParams) error {
 
 	var averagePrice types.Currency
 	sampleSize := redundancy * 3 / 2
-	hosts := r.hostDB.RandomHosts(sampleSize)
+	hosts := r.hostDB.SelectHosts(sampleSize, selector)
 	for _, host := range hosts {
 		averagePrice = averagePrice.Add(host.Price)
 	}
@@ -86,7 +87,8 @@ func (r *Renter) threadedUploadPiece(host modules.HostSettings, up modules.FileU
 }
 
 // Upload takes an upload parameters, which contain a file to upload, and then
-// creates a redundant copy of the file on the Sia network.
+// creates a redundant copy of the file on the Sia network. The hosts are
+// chosen by the upload's host policy.
 func (r *Renter) Upload(up modules.FileUploadParams) error {
 	// TODO: This type of restriction is something that should be handled by
 	// the frontend, not the backend.
@@ -94,7 +96,11 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		return errors.New("nickname and file name must have the same extension")
 	}
 
-	err := r.checkWalletBalance(up)
+	selector, err := modules.NewHostSelector(up.HostPolicy)
+	if err != nil {
+		return err
+	}
+	err = r.checkWalletBalance(up, selector)
 	if err != nil {
 		return err
 	}
@@ -154,7 +160,7 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	// hosts and file pieces, and spawn goroutines that attempt to match each
 	// piece to a host.
 	hostPool := make(chan modules.HostSettings, 3*redundancy)
-	for _, host := range r.hostDB.RandomHosts(3 * redundancy) {
+	for _, host := range r.hostDB.SelectHosts(3*redundancy, selector) {
 		hostPool <- host
 	}
 	piecePool := make(chan *filePiece, len(f.Pieces))
@@ -266,7 +266,10 @@ func (tp *TransactionPool) AcceptTransaction(t types.Transaction) (err error) {
 
 // RelayTransaction is an RPC that accepts a transaction from a peer. If the
 // accept is successful, the transaction will be relayed to the Gateway's
-// other peers.
+// other peers. Peers that relay transactions which are invalid at every height
+// are banned; transactions that conflict with the pool, spend unknown outputs,
+// or are only invalid at the local height may have been relayed in good faith
+// by a peer at a different height.
 func (tp *TransactionPool) RelayTransaction(conn modules.PeerConn) error {
 	var t types.Transaction
 	err := encoding.ReadObject(conn, &t, types.BlockSizeLimit)
@@ -278,5 +281,10 @@ func (tp *TransactionPool) RelayTransaction(conn modules.PeerConn) error {
 	if err == modules.ErrTransactionPoolDuplicate {
 		err = nil
 	}
+	if err != nil {
+		if t.StructurallyValid() != nil {
+			tp.gateway.Ban(modules.NetAddress(conn.RemoteAddr().String()), modules.MisbehaviorBanDuration, "relayed an invalid transaction: "+err.Error())
+		}
+	}
 	return err
 }
@@ -2,6 +2,7 @@ package transactionpool
 
 import (
 	"crypto/rand"
+	"net"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/encoding"
@@ -134,3 +135,48 @@ func TestLowFeeTransaction(t *testing.T) {
 		t.Fatal("expecting ErrLowMinerFees got:", err)
 	}
 }
+
+// relayTransaction sends 'txn' to the transaction pool through the
+// RelayTransaction RPC.
+func (tpt *tpoolTester) relayTransaction(txn types.Transaction) error {
+	conn, peerConn := net.Pipe()
+	defer conn.Close()
+	go func() {
+		encoding.WriteObject(peerConn, txn)
+		peerConn.Close()
+	}()
+	return tpt.tpool.RelayTransaction(conn)
+}
+
+// TestRelayTransactionBans checks that peers are only banned for relaying
+// transactions that are invalid at every height.
+func TestRelayTransactionBans(t *testing.T) {
+	tpt := newTpoolTester("TestRelayTransactionBans", t)
+
+	// A file contract whose window starts at the current height is invalid
+	// here, but was valid one block ago.
+	height := tpt.cs.Height()
+	fc := types.FileContract{
+		WindowStart: height,
+		WindowEnd:   height + 10,
+		Payout:      types.NewCurrency64(1e6),
+	}
+	outputs := []types.SiacoinOutput{{Value: fc.Payout.Sub(fc.Tax())}}
+	fc.ValidProofOutputs, fc.MissedProofOutputs = outputs, outputs
+	err := tpt.relayTransaction(types.Transaction{FileContracts: []types.FileContract{fc}})
+	if err != types.ErrFileContractWindowStartViolation {
+		t.Fatal("expected ErrFileContractWindowStartViolation, got", err)
+	}
+	if len(tpt.gateway.Bans()) != 0 {
+		t.Fatal("peer was banned for a transaction that is valid at another height")
+	}
+
+	// Spending the same output twice is invalid at every height.
+	txn := types.Transaction{SiacoinInputs: []types.SiacoinInput{{}, {}}}
+	if tpt.relayTransaction(txn) == nil {
+		t.Fatal("invalid transaction was accepted")
+	}
+	if len(tpt.gateway.Bans()) != 1 {
+		t.Error("peer was not banned for a structurally invalid transaction")
+	}
+}
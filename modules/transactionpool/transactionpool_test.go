@@ -115,7 +115,7 @@ func newTpoolTester(name string, t *testing.T) *tpoolTester {
 	testdir := build.TempDir("transactionpool", name)
 
 	// Create the gateway.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir), false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -179,7 +179,7 @@ func TestNewNilInputs(t *testing.T) {
 	testdir := build.TempDir("transactionpool", "TestNewNilInputs")
 
 	// Create a gateway and consensus set.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir), false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -95,12 +95,12 @@ func (tp *TransactionPool) validUnconfirmedFileContractRevisions(t types.Transac
 		}
 
 		// Check that the payouts in the revision add up to the payout of the
-		// contract.
+		// contract. After the hardfork, the siafund fee is excluded.
 		var payout types.Currency
 		for _, output := range fcr.NewMissedProofOutputs {
 			payout = payout.Add(output.Value)
 		}
-		if payout.Cmp(fc.Payout) != 0 {
+		if payout.Cmp(fc.RevisionPayout(tp.consensusSetHeight)) != 0 {
 			return errors.New("contract revision has incorrect payouts")
 		}
 	}
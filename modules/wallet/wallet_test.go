@@ -80,7 +80,7 @@ func createWalletTester(name string) (*walletTester, error) {
 	testdir := build.TempDir("wallet", name)
 
 	// Create the modules
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir), false)
 	if err != nil {
 		return nil, err
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/spf13/cobra"
 
@@ -12,7 +13,7 @@ var (
 	gatewayCmd = &cobra.Command{
 		Use:   "gateway",
 		Short: "Perform gateway actions",
-		Long:  "Add or remove a peer, view the current peer list, or synchronize to the network.",
+		Long:  "Add, remove, or ban a peer, view the current peer list, or synchronize to the network.",
 		Run:   wrap(gatewaystatuscmd),
 	}
 
@@ -23,6 +24,22 @@ var (
 		Run:   wrap(gatewayaddcmd),
 	}
 
+	gatewayBanCmd = &cobra.Command{
+		Use:   "ban [address]",
+		Short: "Ban an address",
+		Long: `Disconnect from any peers at an address, and refuse connections to and from it
+until the ban expires. Every port of the address's host is banned, except on
+loopback addresses.`,
+		Run: wrap(gatewaybancmd),
+	}
+
+	gatewayBansCmd = &cobra.Command{
+		Use:   "bans",
+		Short: "View the banned addresses",
+		Long:  "View the addresses that are banned, with the reason and expiry of each ban.",
+		Run:   wrap(gatewaybanscmd),
+	}
+
 	gatewayRemoveCmd = &cobra.Command{
 		Use:   "remove [address]",
 		Short: "Remove a peer",
@@ -36,6 +53,13 @@ var (
 		Long:  "View the current peer list.",
 		Run:   wrap(gatewaystatuscmd),
 	}
+
+	gatewayUnbanCmd = &cobra.Command{
+		Use:   "unban [address]",
+		Short: "Lift the ban on an address",
+		Long:  "Lift the ban on an address, allowing connections to and from it again.",
+		Run:   wrap(gatewayunbancmd),
+	}
 )
 
 func gatewayaddcmd(addr string) {
@@ -47,6 +71,33 @@ func gatewayaddcmd(addr string) {
 	fmt.Println("Added", addr, "to peer list.")
 }
 
+func gatewaybancmd(addr string) {
+	vals := url.Values{"address": {addr}, "duration": {banDuration}, "reason": {banReason}}
+	err := post("/gateway/peers/ban", vals.Encode())
+	if err != nil {
+		fmt.Println("Could not ban address:", err)
+		return
+	}
+	fmt.Println("Banned", addr+".")
+}
+
+func gatewaybanscmd() {
+	var gb api.GatewayBans
+	err := getAPI("/gateway/peers/bans", &gb)
+	if err != nil {
+		fmt.Println("Could not get ban list:", err)
+		return
+	}
+	if len(gb.Bans) == 0 {
+		fmt.Println("No banned addresses.")
+		return
+	}
+	fmt.Println(len(gb.Bans), "banned addresses:")
+	for _, ban := range gb.Bans {
+		fmt.Printf("	%v until %v: %v\n", ban.Address, ban.Expiry, ban.Reason)
+	}
+}
+
 func gatewayremovecmd(addr string) {
 	err := post("/gateway/peers/remove", "address="+addr)
 	if err != nil {
@@ -73,3 +124,12 @@ func gatewaystatuscmd() {
 		fmt.Println("\t", peer)
 	}
 }
+
+func gatewayunbancmd(addr string) {
+	err := post("/gateway/peers/unban", "address="+addr)
+	if err != nil {
+		fmt.Println("Could not unban address:", err)
+		return
+	}
+	fmt.Println("Unbanned", addr+".")
+}
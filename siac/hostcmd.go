@@ -3,10 +3,13 @@ package main
 import (
 	"fmt"
 	"math/big"
+	"net/url"
 
 	"github.com/spf13/cobra"
 
+	"github.com/NebulousLabs/Sia/api"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 var (
@@ -29,7 +32,10 @@ Available settings:
 	maxduration
 	windowsize
 	price (in SC per GB per month)
-	collateral`,
+	collateral
+	downloadprice (in SC per GB)
+	maxcontractcollateral (in hastings)
+	collateralbudget (in hastings)`,
 		Run: wrap(hostconfigcmd),
 	}
 
@@ -37,26 +43,152 @@ Available settings:
 		Use:   "announce",
 		Short: "Announce yourself as a host",
 		Long: `Announce yourself as a host on the network.
-The --force flag can be used to override connectivity checks.`,
+The --force flag can be used to override connectivity checks.
+The --address flag announces the given address, which may contain a DNS
+hostname, instead of the host's external IP.`,
 		Run: wrap(hostannouncecmd)}
 
+	hostContractsCmd = &cobra.Command{
+		Use:   "contracts",
+		Short: "View the host's contract ledger",
+		Long: `View every contract the host has formed, including expired contracts.
+The --outcome flag lists only the contracts with the given outcome.`,
+		Run: wrap(hostcontractscmd),
+	}
+
+	hostLimitsCmd = &cobra.Command{
+		Use:   "limits",
+		Short: "View the host's connection limits",
+		Long:  "View the limits on the connections that the host accepts.",
+		Run:   wrap(hostlimitscmd),
+	}
+
+	hostLimitsConfigCmd = &cobra.Command{
+		Use:   "config [setting] [value]",
+		Short: "Modify the host's connection limits",
+		Long: `Modify the limits on the connections that the host accepts.
+Available settings:
+	maxconnections
+	maxconnectionsperip
+	negotiationrate (per minute)
+	negotiationburst`,
+		Run: wrap(hostlimitsconfigcmd),
+	}
+
+	hostScrubCmd = &cobra.Command{
+		Use:   "scrub",
+		Short: "View the host's scrubber",
+		Long:  "View the settings of the host's scrubber and the corrupt files found by the last scrub.",
+		Run:   wrap(hostscrubcmd),
+	}
+
+	hostScrubConfigCmd = &cobra.Command{
+		Use:   "config [setting] [value]",
+		Short: "Modify the host's scrubber",
+		Long: `Modify the settings of the host's scrubber.
+Available settings:
+	enabled (true or false)
+	interval (in blocks)
+	readrate (in bytes per second)`,
+		Run: wrap(hostscrubconfigcmd),
+	}
+
+	hostMaintenanceCmd = &cobra.Command{
+		Use:   "maintenance",
+		Short: "View the host's drain report",
+		Long:  "View whether the host is in maintenance mode and when its last contract ends.",
+		Run:   wrap(hostmaintenancecmd),
+	}
+
+	hostMaintenanceStartCmd = &cobra.Command{
+		Use:   "start",
+		Short: "Put the host in maintenance mode",
+		Long: `Put the host in maintenance mode. The host will refuse new contracts,
+but keeps storing files and submitting storage proofs for existing contracts.`,
+		Run: wrap(hostmaintenancestartcmd),
+	}
+
+	hostMaintenanceStopCmd = &cobra.Command{
+		Use:   "stop",
+		Short: "Take the host out of maintenance mode",
+		Long:  "Take the host out of maintenance mode, so that it accepts new contracts again.",
+		Run:   wrap(hostmaintenancestopcmd),
+	}
+
+	hostPricingCmd = &cobra.Command{
+		Use:   "pricing",
+		Short: "View the host's pricing policy",
+		Long:  "View the policy that the host uses to adjust its prices automatically.",
+		Run:   wrap(hostpricingcmd),
+	}
+
+	hostPricingConfigCmd = &cobra.Command{
+		Use:   "config [setting] [value]",
+		Short: "Modify the host's pricing policy",
+		Long: `Modify the policy that the host uses to adjust its prices automatically.
+Available settings:
+	enabled (true or false)
+	minprice (in SC per GB per month)
+	maxprice (in SC per GB per month)
+	mincollateral
+	maxcollateral`,
+		Run: wrap(hostpricingconfigcmd),
+	}
+
 	hostStatusCmd = &cobra.Command{
 		Use:   "status",
 		Short: "View host settings",
 		Long:  "View host settings, including available storage, price, and more.",
 		Run:   wrap(hoststatuscmd),
 	}
+
+	hostStorageCmd = &cobra.Command{
+		Use:   "storage",
+		Short: "View storage folders",
+		Long:  "View the storage folders that the host keeps files in.",
+		Run:   wrap(hoststoragecmd),
+	}
+
+	hostStorageAddCmd = &cobra.Command{
+		Use:   "add [path] [size]",
+		Short: "Add a storage folder",
+		Long:  "Add a storage folder to the host. The size is given in bytes.",
+		Run:   wrap(hoststorageaddcmd),
+	}
+
+	hostStorageRemoveCmd = &cobra.Command{
+		Use:   "remove [path]",
+		Short: "Remove a storage folder",
+		Long:  "Remove a storage folder from the host. Files in the folder are moved to the other storage folders.",
+		Run:   wrap(hoststorageremovecmd),
+	}
+
+	hostStorageResizeCmd = &cobra.Command{
+		Use:   "resize [path] [size]",
+		Short: "Resize a storage folder",
+		Long:  "Change the number of bytes that the host may store in a storage folder.",
+		Run:   wrap(hoststorageresizecmd),
+	}
 )
 
 func hostconfigcmd(param, value string) {
 	// convert price to hastings/byte/block
 	if param == "price" {
-		p, ok := new(big.Rat).SetString(value)
+		var ok bool
+		value, ok = storagePriceHastings(value)
 		if !ok {
 			fmt.Println("could not parse price")
 			return
 		}
-		p.Mul(p, big.NewRat(1e24/1e9, 4320))
+	}
+	// convert download price to hastings/byte
+	if param == "downloadprice" {
+		p, ok := new(big.Rat).SetString(value)
+		if !ok {
+			fmt.Println("could not parse download price")
+			return
+		}
+		p.Mul(p, big.NewRat(1e24/1e9, 1))
 		value = new(big.Int).Div(p.Num(), p.Denom()).String()
 	}
 	err := post("/host/configure", param+"="+value)
@@ -67,11 +199,156 @@ func hostconfigcmd(param, value string) {
 	fmt.Println("Host settings updated.")
 }
 
+// storagePriceHastings converts a price in SC per GB per month to hastings per
+// byte per block.
+func storagePriceHastings(value string) (string, bool) {
+	p, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return "", false
+	}
+	p.Mul(p, big.NewRat(1e24/1e9, 4320))
+	return new(big.Int).Div(p.Num(), p.Denom()).String(), true
+}
+
+// storagePriceSC converts a price in hastings per byte per block to SC per GB
+// per month.
+func storagePriceSC(price types.Currency) string {
+	p := new(big.Rat).SetInt(price.Big())
+	p.Mul(p, big.NewRat(4320, 1e24/1e9))
+	return p.FloatString(3)
+}
+
+func hostcontractscmd() {
+	call := "/host/contracts"
+	if outcome != "" {
+		call += "?outcome=" + outcome
+	}
+	var hc api.HostContracts
+	err := getAPI(call, &hc)
+	if err != nil {
+		fmt.Println("Could not fetch contracts:", err)
+		return
+	}
+	if len(hc.Contracts) == 0 {
+		fmt.Println("No contracts.")
+		return
+	}
+	for _, c := range hc.Contracts {
+		fmt.Printf(`%x
+	Size:         %v
+	Formed:       block %v
+	Proof Window: blocks %v-%v
+	Payout:       %v (%v collateral)
+	Revenue:      %v
+	Outcome:      %v
+`, c.ID[:], filesizeUnits(int64(c.FileSize)), c.FormationHeight, c.WindowStart, c.WindowEnd, c.Payout, c.Collateral, c.Revenue, c.Outcome)
+	}
+}
+
+func hostlimitscmd() {
+	var limits modules.HostConnectionLimits
+	err := getAPI("/host/limits", &limits)
+	if err != nil {
+		fmt.Println("Could not fetch connection limits:", err)
+		return
+	}
+	fmt.Printf(`Connection limits:
+Max Connections:        %v
+Max Connections per IP: %v
+Negotiation Rate:       %v per minute
+Negotiation Burst:      %v
+`, limits.MaxConnections, limits.MaxConnectionsPerIP, limits.NegotiationRate, limits.NegotiationBurst)
+}
+
+func hostlimitsconfigcmd(param, value string) {
+	err := post("/host/limits/configure", param+"="+value)
+	if err != nil {
+		fmt.Println("Could not update connection limits:", err)
+		return
+	}
+	fmt.Println("Connection limits updated.")
+}
+
+func hostmaintenancecmd() {
+	var report modules.DrainReport
+	err := getAPI("/host/maintenance", &report)
+	if err != nil {
+		fmt.Println("Could not fetch drain report:", err)
+		return
+	}
+	maintenanceStr := "off"
+	if report.Maintenance {
+		maintenanceStr = "on"
+	}
+	fmt.Printf(`Maintenance mode: %v
+Contracts:        %v (%v stored)
+`, maintenanceStr, report.Obligations, filesizeUnits(int64(report.StorageInUse)))
+	if report.Obligations == 0 {
+		fmt.Println("The host has no contracts left and can be shut down.")
+		return
+	}
+	fmt.Printf(`Last Proof Window Ends: block %v
+Drained at:             block %v (%v blocks remaining)
+`, report.LastWindowEnd, report.DrainHeight, report.BlocksRemaining)
+}
+
+func hostmaintenancestartcmd() {
+	err := post("/host/maintenance/start", "")
+	if err != nil {
+		fmt.Println("Could not enter maintenance mode:", err)
+		return
+	}
+	fmt.Println("Host is in maintenance mode and will refuse new contracts.")
+}
+
+func hostmaintenancestopcmd() {
+	err := post("/host/maintenance/stop", "")
+	if err != nil {
+		fmt.Println("Could not leave maintenance mode:", err)
+		return
+	}
+	fmt.Println("Host is accepting new contracts.")
+}
+
+func hostpricingcmd() {
+	var policy modules.PricingPolicy
+	err := getAPI("/host/pricing", &policy)
+	if err != nil {
+		fmt.Println("Could not fetch pricing policy:", err)
+		return
+	}
+	fmt.Printf(`Pricing policy:
+Enabled:    %v
+Price:      %v to %v SC per GB per month
+Collateral: %v to %v
+`, policy.Enabled, storagePriceSC(policy.MinPrice), storagePriceSC(policy.MaxPrice), policy.MinCollateral, policy.MaxCollateral)
+}
+
+func hostpricingconfigcmd(param, value string) {
+	if param == "minprice" || param == "maxprice" {
+		var ok bool
+		value, ok = storagePriceHastings(value)
+		if !ok {
+			fmt.Println("could not parse price")
+			return
+		}
+	}
+	err := post("/host/pricing/configure", param+"="+value)
+	if err != nil {
+		fmt.Println("Could not update pricing policy:", err)
+		return
+	}
+	fmt.Println("Pricing policy updated.")
+}
+
 func hostannouncecmd() {
 	args := ""
 	if force {
 		args = "force=true"
 	}
+	if announceAddress != "" {
+		args = "address=" + announceAddress
+	}
 	err := post("/host/announce", args)
 	if err != nil {
 		fmt.Println("Could not announce host:", err)
@@ -87,16 +364,103 @@ func hoststatuscmd() {
 		fmt.Println("Could not fetch host settings:", err)
 		return
 	}
-	// convert price to SC/GB/mo
-	price := new(big.Rat).SetInt(info.Price.Big())
-	price.Mul(price, big.NewRat(4320, 1e24/1e9))
+	// convert download price to SC/GB
+	downloadPrice := new(big.Rat).SetInt(info.DownloadPrice.Big())
+	downloadPrice.Mul(downloadPrice, big.NewRat(1, 1e24/1e9))
 	fmt.Printf(`Host settings:
-Storage:      %v (%v used)
-Price:        %v SC per GB per month
-Collateral:   %v
-Max Filesize: %v
-Max Duration: %v
-Contracts:    %v
+Storage:        %v (%v used)
+Price:          %v SC per GB per month
+Download Price: %v SC per GB
+Collateral:     %v
+Max Filesize:   %v
+Max Duration:   %v
+Contracts:      %v
+
+Collateral Locked:    %v
+Collateral Available: %v
 `, filesizeUnits(info.TotalStorage), filesizeUnits(info.TotalStorage-info.StorageRemaining),
-		price.FloatString(3), info.Collateral, info.MaxFilesize, info.MaxDuration, info.NumContracts)
+		storagePriceSC(info.Price), downloadPrice.FloatString(3), info.Collateral, info.MaxFilesize, info.MaxDuration, info.NumContracts,
+		info.CollateralLocked, info.CollateralAvailable)
+}
+
+func hoststoragecmd() {
+	var sf api.HostStorageFolders
+	err := getAPI("/host/storage", &sf)
+	if err != nil {
+		fmt.Println("Could not fetch storage folders:", err)
+		return
+	}
+	if len(sf.Folders) == 0 {
+		fmt.Println("No storage folders; files are kept in the host directory.")
+		return
+	}
+	fmt.Println("Storage folders:")
+	for _, folder := range sf.Folders {
+		fmt.Printf("\t%v (%v of %v used)\n", folder.Path, filesizeUnits(int64(folder.Size-folder.SizeRemaining)), filesizeUnits(int64(folder.Size)))
+	}
+}
+
+func hoststorageaddcmd(path, size string) {
+	err := post("/host/storage/add", "path="+url.QueryEscape(path)+"&size="+size)
+	if err != nil {
+		fmt.Println("Could not add storage folder:", err)
+		return
+	}
+	fmt.Println("Added storage folder", path)
+}
+
+func hoststorageremovecmd(path string) {
+	err := post("/host/storage/remove", "path="+url.QueryEscape(path))
+	if err != nil {
+		fmt.Println("Could not remove storage folder:", err)
+		return
+	}
+	fmt.Println("Removed storage folder", path)
+}
+
+func hoststorageresizecmd(path, size string) {
+	err := post("/host/storage/resize", "path="+url.QueryEscape(path)+"&size="+size)
+	if err != nil {
+		fmt.Println("Could not resize storage folder:", err)
+		return
+	}
+	fmt.Println("Resized storage folder", path)
+}
+
+func hostscrubcmd() {
+	var scrub api.HostScrub
+	err := getAPI("/host/scrub", &scrub)
+	if err != nil {
+		fmt.Println("Could not fetch scrub status:", err)
+		return
+	}
+	fmt.Printf(`Scrubber:
+Enabled:       %v
+Interval:      %v blocks
+Read Rate:     %v bytes per second
+Scrubbing:     %v
+Last Scrub:    block %v
+Files Checked: %v
+`, scrub.Settings.Enabled, scrub.Settings.Interval, scrub.Settings.ReadRate, scrub.Status.Scrubbing, scrub.Status.LastScrub, scrub.Status.FilesChecked)
+	if len(scrub.Status.CorruptFiles) == 0 {
+		fmt.Println("No corrupt files found.")
+		return
+	}
+	fmt.Println("Corrupt files:")
+	for _, cf := range scrub.Status.CorruptFiles {
+		if cf.Error != "" {
+			fmt.Printf("\t%v (contract %v): %v\n", cf.Path, cf.ContractID, cf.Error)
+		} else {
+			fmt.Printf("\t%v (contract %v): Merkle root does not match\n", cf.Path, cf.ContractID)
+		}
+	}
+}
+
+func hostscrubconfigcmd(param, value string) {
+	err := post("/host/scrub/configure", param+"="+value)
+	if err != nil {
+		fmt.Println("Could not update scrub settings:", err)
+		return
+	}
+	fmt.Println("Scrub settings updated.")
 }
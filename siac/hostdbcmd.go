@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"math/big"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/modules"
 )
 
 var (
@@ -15,6 +18,103 @@ var (
 		Long:  "List active hosts on the network",
 		Run:   wrap(hostdbhostscmd),
 	}
+
+	hostdbAllCmd = &cobra.Command{
+		Use:   "all",
+		Short: "List all known hosts",
+		Long:  "List all hosts known to the hostdb, including inactive hosts, with their uptime and latency.",
+		Run:   wrap(hostdballcmd),
+	}
+
+	hostdbHostCmd = &cobra.Command{
+		Use:   "host [address]",
+		Short: "View a host and its recent scans",
+		Long:  "View a host known to the hostdb, with its uptime, latency, recent scans, and recent interactions with the renter.",
+		Run:   wrap(hostdbhostcmd),
+	}
+
+	hostdbDiversityCmd = &cobra.Command{
+		Use:   "diversity",
+		Short: "View the hostdb's diversity constraints",
+		Long:  "View the constraints on the hosts that can be selected together, and the hosts left out of the last selection.",
+		Run:   wrap(hostdbdiversitycmd),
+	}
+
+	hostdbDiversityConfigCmd = &cobra.Command{
+		Use:   "config [setting] [value]",
+		Short: "Modify the hostdb's diversity constraints",
+		Long: `Modify the constraints on the hosts that can be selected together.
+Available settings:
+	ipv4prefixlength (0 to 32; 0 turns off the limit)
+	ipv6prefixlength (0 to 128; 0 turns off the limit)
+	uniqueoperators (true or false)`,
+		Run: wrap(hostdbdiversityconfigcmd),
+	}
+
+	hostdbRescanCmd = &cobra.Command{
+		Use:   "rescan [address]",
+		Short: "Rescan a host",
+		Long:  "Scan the host announced at an address as soon as possible.",
+		Run:   wrap(hostdbrescancmd),
+	}
+
+	hostdbRescanAllCmd = &cobra.Command{
+		Use:   "all",
+		Short: "Rescan every host",
+		Long:  "Scan every known host, including the inactive hosts, as soon as possible.",
+		Run:   wrap(hostdbrescanallcmd),
+	}
+
+	hostdbScoresCmd = &cobra.Command{
+		Use:   "scores",
+		Short: "List the weight of each host",
+		Long:  "List the weight of each host in the hostdb, heaviest first, along with the factors that make up the weight.",
+		Run:   wrap(hostdbscorescmd),
+	}
+
+	hostdbStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "View the hostdb's scanning progress",
+		Long:  "View the number of known hosts, the progress of scanning, and the settings that control scanning.",
+		Run:   wrap(hostdbstatuscmd),
+	}
+
+	hostdbStatusConfigCmd = &cobra.Command{
+		Use:   "config [setting] [value]",
+		Short: "Modify the settings that control scanning",
+		Long: `Modify how often hosts are scanned and how many are scanned at once.
+Available settings:
+	mininterval (minutes between rounds of scanning, at least)
+	maxinterval (minutes between rounds of scanning, at most)
+	threads (hosts scanned at once, 1 to 250)
+	inactivecheckups (inactive hosts scanned in each round)`,
+		Run: wrap(hostdbstatusconfigcmd),
+	}
+
+	hostdbWeightsCmd = &cobra.Command{
+		Use:   "weights",
+		Short: "View the settings used to weigh hosts",
+		Long:  "View the exponent of each factor used to weigh hosts.",
+		Run:   wrap(hostdbweightscmd),
+	}
+
+	hostdbWeightsConfigCmd = &cobra.Command{
+		Use:   "config [setting] [value]",
+		Short: "Modify the settings used to weigh hosts",
+		Long: `Modify the settings used to weigh hosts, and reweigh every host.
+Each exponent is between 0 and 10. An exponent of 0 ignores the factor.
+Available settings:
+	priceexponent
+	collateralexponent
+	storageexponent
+	uptimeexponent
+	ageexponent
+	latencyexponent
+	durationexponent
+	interactionexponent
+	duration (in blocks; 0 ignores the maximum duration of hosts)`,
+		Run: wrap(hostdbweightsconfigcmd),
+	}
 )
 
 func hostdbhostscmd() {
@@ -33,3 +133,189 @@ func hostdbhostscmd() {
 		fmt.Printf("\t%v\n", host.IPAddress)
 	}
 }
+
+func hostdballcmd() {
+	var he api.HostDBEntries
+	err := getAPI("/hostdb/hosts/all", &he)
+	if err != nil {
+		fmt.Println("Could not fetch host list:", err)
+		return
+	}
+	if len(he.Hosts) == 0 {
+		fmt.Println("No known hosts")
+		return
+	}
+	fmt.Println("Active  Uptime  Latency    Scans  Address")
+	for _, host := range he.Hosts {
+		latency := float64(host.AverageLatency) / float64(time.Millisecond)
+		fmt.Printf("%-6v  %5.1f%%  %7.1fms  %-5v  %v\n", host.Active, host.Uptime, latency, host.Scans, host.IPAddress)
+	}
+}
+
+func hostdbhostcmd(addr string) {
+	var hd api.HostDetails
+	err := getAPI("/hostdb/host?addr="+addr, &hd)
+	if err != nil {
+		fmt.Println("Could not fetch host:", err)
+		return
+	}
+	h := hd.Host
+	fmt.Printf(`Host %v:
+Active:          %v
+First Seen:      block %v
+Uptime:          %.1f%% of %v scans
+Latency:         %v average, %v min, %v max
+Last Scan:       %v
+Last Success:    %v
+Interactions:    %.1f%% of %v succeeded
+`, h.IPAddress, h.Active, h.FirstSeen, h.Uptime, h.Scans, h.AverageLatency, h.MinLatency, h.MaxLatency, h.LastScan, h.LastSuccess,
+		h.InteractionSuccess, h.Interactions)
+	if len(hd.Scans) != 0 {
+		fmt.Println("Recent scans:")
+		for _, scan := range hd.Scans {
+			if scan.Success {
+				fmt.Printf("\t%v: reached in %v\n", scan.Timestamp, scan.Latency)
+			} else {
+				fmt.Printf("\t%v: unreachable\n", scan.Timestamp)
+			}
+		}
+	}
+	if len(hd.Interactions) != 0 {
+		fmt.Println("Recent interactions:")
+		for _, interaction := range hd.Interactions {
+			outcome := "succeeded"
+			if !interaction.Success {
+				outcome = "failed"
+			}
+			fmt.Printf("\t%v: %v %v\n", interaction.Timestamp, interaction.Kind, outcome)
+		}
+	}
+}
+
+func hostdbdiversitycmd() {
+	var hd api.HostDBDiversity
+	err := getAPI("/hostdb/diversity", &hd)
+	if err != nil {
+		fmt.Println("Could not fetch diversity settings:", err)
+		return
+	}
+	fmt.Printf(`Diversity constraints:
+IPv4 prefix length: %v
+IPv6 prefix length: %v
+Unique operators:   %v
+`, hd.Settings.IPv4PrefixLength, hd.Settings.IPv6PrefixLength, hd.Settings.UniqueOperators)
+	if len(hd.Exclusions) == 0 {
+		fmt.Println("No hosts were excluded from the last selection.")
+		return
+	}
+	fmt.Println("Excluded from the last selection:")
+	for _, ex := range hd.Exclusions {
+		fmt.Printf("\t%v: same %v as %v\n", ex.IPAddress, ex.Reason, ex.Conflict)
+	}
+}
+
+func hostdbdiversityconfigcmd(param, value string) {
+	err := post("/hostdb/diversity/configure", param+"="+value)
+	if err != nil {
+		fmt.Println("Could not update diversity settings:", err)
+		return
+	}
+	fmt.Println("Diversity settings updated.")
+}
+
+func hostdbrescancmd(addr string) {
+	err := post("/hostdb/rescan", "addr="+addr)
+	if err != nil {
+		fmt.Println("Could not rescan host:", err)
+		return
+	}
+	fmt.Println("Host will be rescanned.")
+}
+
+func hostdbrescanallcmd() {
+	err := post("/hostdb/rescan", "")
+	if err != nil {
+		fmt.Println("Could not rescan hosts:", err)
+		return
+	}
+	fmt.Println("All hosts will be rescanned.")
+}
+
+func hostdbscorescmd() {
+	var hs api.HostScores
+	err := getAPI("/hostdb/hosts/scores", &hs)
+	if err != nil {
+		fmt.Println("Could not fetch host scores:", err)
+		return
+	}
+	if len(hs.Scores) == 0 {
+		fmt.Println("No known hosts")
+		return
+	}
+	fmt.Println("Active  Collateral  Storage  Uptime  Age   Latency  Duration  Interactions  Weight          Address")
+	for _, s := range hs.Scores {
+		fmt.Printf("%-6v  %-10.3f  %-7.3f  %-6.3f  %-4.3f %-7.3f  %-8.3f  %-12.3f  %-14.4g  %v\n", s.Active, s.Collateral, s.Storage,
+			s.Uptime, s.Age, s.Latency, s.Duration, s.Interactions, new(big.Float).SetInt(s.Weight.Big()), s.IPAddress)
+	}
+}
+
+func hostdbstatuscmd() {
+	var hs api.HostDBStatus
+	err := getAPI("/hostdb/status", &hs)
+	if err != nil {
+		fmt.Println("Could not fetch hostdb status:", err)
+		return
+	}
+	fmt.Printf(`Hosts: %v known, %v active
+Scans pending: %v
+`, hs.KnownHosts, hs.ActiveHosts, hs.Scan.Pending)
+	if !hs.Scan.RoundStart.IsZero() {
+		fmt.Printf(`Current round: began %v, %v scans completed
+Next round:    %v
+`, hs.Scan.RoundStart, hs.Scan.RoundScans, hs.Scan.NextRound)
+	}
+	ss := hs.ScanSettings
+	fmt.Printf(`Scan settings:
+Interval:          %v to %v
+Threads:           %v
+Inactive checkups: %v
+`, ss.MinScanInterval, ss.MaxScanInterval, ss.Threads, ss.InactiveHostCheckups)
+}
+
+func hostdbstatusconfigcmd(param, value string) {
+	err := post("/hostdb/scan/configure", param+"="+value)
+	if err != nil {
+		fmt.Println("Could not update scan settings:", err)
+		return
+	}
+	fmt.Println("Scan settings updated.")
+}
+
+func hostdbweightscmd() {
+	var ws modules.HostWeightSettings
+	err := getAPI("/hostdb/weights", &ws)
+	if err != nil {
+		fmt.Println("Could not fetch weight settings:", err)
+		return
+	}
+	fmt.Printf(`Weight exponents:
+Price:        %v
+Collateral:   %v
+Storage:      %v
+Uptime:       %v
+Age:          %v
+Latency:      %v
+Duration:     %v (wanted duration: %v blocks)
+Interactions: %v
+`, ws.PriceExponent, ws.CollateralExponent, ws.StorageExponent, ws.UptimeExponent, ws.AgeExponent, ws.LatencyExponent, ws.DurationExponent, ws.Duration,
+		ws.InteractionExponent)
+}
+
+func hostdbweightsconfigcmd(param, value string) {
+	err := post("/hostdb/weights/configure", param+"="+value)
+	if err != nil {
+		fmt.Println("Could not update weight settings:", err)
+		return
+	}
+	fmt.Println("Weight settings updated.")
+}
@@ -16,8 +16,17 @@ import (
 )
 
 var (
-	port  string
-	force bool
+	port    string
+	force   bool
+	outcome string // Filters the contracts listed by 'siac host contracts'.
+
+	announceAddress string // Announced by 'siac host announce' instead of the host's IP.
+
+	uploadPolicy string // Host selection policy used by 'siac renter upload'.
+	uploadHosts  string // Hosts allowed by the curated policy of 'siac renter upload'.
+
+	banDuration string // Length of a ban made by 'siac gateway ban'.
+	banReason   string // Reason given for a ban made by 'siac gateway ban'.
 )
 
 // apiGet wraps a GET request with a status code check, such that if the GET does
@@ -161,10 +170,22 @@ func main() {
 	root.PersistentFlags().BoolVarP(&force, "force", "f", false, "force certain commands")
 
 	root.AddCommand(hostCmd)
-	hostCmd.AddCommand(hostConfigCmd, hostAnnounceCmd, hostStatusCmd)
+	hostCmd.AddCommand(hostConfigCmd, hostAnnounceCmd, hostContractsCmd, hostLimitsCmd, hostMaintenanceCmd, hostPricingCmd, hostScrubCmd, hostStatusCmd, hostStorageCmd)
+	hostAnnounceCmd.Flags().StringVarP(&announceAddress, "address", "a", "", "announce this address, such as hostname:port, instead of the host's IP")
+	hostContractsCmd.Flags().StringVarP(&outcome, "outcome", "o", "", "only list contracts with this outcome (pending, valid, missed, or reverted)")
+	hostLimitsCmd.AddCommand(hostLimitsConfigCmd)
+	hostMaintenanceCmd.AddCommand(hostMaintenanceStartCmd, hostMaintenanceStopCmd)
+	hostPricingCmd.AddCommand(hostPricingConfigCmd)
+	hostScrubCmd.AddCommand(hostScrubConfigCmd)
+	hostStorageCmd.AddCommand(hostStorageAddCmd, hostStorageRemoveCmd, hostStorageResizeCmd)
 
 	root.AddCommand(hostdbCmd)
 	hostCmd.AddCommand(hostdbCmd)
+	hostdbCmd.AddCommand(hostdbAllCmd, hostdbDiversityCmd, hostdbHostCmd, hostdbRescanCmd, hostdbScoresCmd, hostdbStatusCmd, hostdbWeightsCmd)
+	hostdbDiversityCmd.AddCommand(hostdbDiversityConfigCmd)
+	hostdbRescanCmd.AddCommand(hostdbRescanAllCmd)
+	hostdbStatusCmd.AddCommand(hostdbStatusConfigCmd)
+	hostdbWeightsCmd.AddCommand(hostdbWeightsConfigCmd)
 
 	root.AddCommand(minerCmd)
 	minerCmd.AddCommand(minerStartCmd, minerStopCmd, minerStatusCmd)
@@ -178,9 +199,13 @@ func main() {
 	renterCmd.AddCommand(renterDownloadQueueCmd, renterFilesDeleteCmd, renterFilesDownloadCmd,
 		renterFilesListCmd, renterFilesLoadCmd, renterFilesLoadASCIICmd, renterFilesRenameCmd,
 		renterFilesShareCmd, renterFilesShareASCIICmd, renterFilesUploadCmd)
+	renterFilesUploadCmd.Flags().StringVarP(&uploadPolicy, "policy", "p", "", "host selection policy: default, cheapest, reliable, or curated")
+	renterFilesUploadCmd.Flags().StringVar(&uploadHosts, "hosts", "", "comma-separated host addresses allowed by the curated policy")
 
 	root.AddCommand(gatewayCmd)
-	gatewayCmd.AddCommand(gatewayAddCmd, gatewayRemoveCmd, gatewayStatusCmd)
+	gatewayCmd.AddCommand(gatewayAddCmd, gatewayBanCmd, gatewayBansCmd, gatewayRemoveCmd, gatewayStatusCmd, gatewayUnbanCmd)
+	gatewayBanCmd.Flags().StringVarP(&banDuration, "duration", "d", "24h", "how long the ban lasts, e.g. 48h or 90m")
+	gatewayBanCmd.Flags().StringVarP(&banReason, "reason", "r", "banned manually", "reason for the ban")
 
 	root.AddCommand(updateCmd)
 	updateCmd.AddCommand(updateCheckCmd, updateApplyCmd)
@@ -94,8 +94,11 @@ var (
 	renterFilesUploadCmd = &cobra.Command{
 		Use:   "upload [filename] [nickname]",
 		Short: "Upload a file",
-		Long:  "Upload a file using a given nickname.",
-		Run:   wrap(renterfilesuploadcmd),
+		Long: `Upload a file using a given nickname.
+The --policy flag chooses how hosts are selected: default, cheapest, reliable,
+or curated. The curated policy only uploads to the hosts given by --hosts, a
+comma-separated list of host addresses.`,
+		Run: wrap(renterfilesuploadcmd),
 	}
 )
 
@@ -222,7 +225,14 @@ func renterfilesshareasciicmd(nickname string) {
 }
 
 func renterfilesuploadcmd(source, nickname string) {
-	err := post("/renter/files/upload", fmt.Sprintf("source=%s&nickname=%s", abs(source), nickname))
+	args := fmt.Sprintf("source=%s&nickname=%s", abs(source), nickname)
+	if uploadPolicy != "" {
+		args += "&policy=" + uploadPolicy
+	}
+	if uploadHosts != "" {
+		args += "&hosts=" + uploadHosts
+	}
+	err := post("/renter/files/upload", args)
 	if err != nil {
 		fmt.Println("Could not upload file:", err)
 		return
@@ -25,7 +25,7 @@ func startDaemon() error {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	// Create all of the modules.
-	gateway, err := gateway.New(config.Siad.RPCaddr, filepath.Join(config.Siad.SiaDir, modules.GatewayDir))
+	gateway, err := gateway.New(config.Siad.RPCaddr, filepath.Join(config.Siad.SiaDir, modules.GatewayDir), config.Siad.RequireEncryption)
 	if err != nil {
 		return err
 	}
@@ -45,7 +45,7 @@ func startDaemon() error {
 	if err != nil {
 		return err
 	}
-	hostdb, err := hostdb.New(state, gateway)
+	hostdb, err := hostdb.New(state, gateway, filepath.Join(config.Siad.SiaDir, modules.HostDBDir))
 	if err != nil {
 		return err
 	}
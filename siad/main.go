@@ -22,7 +22,8 @@ var (
 // compatible with gcfg.
 type Config struct {
 	Siad struct {
-		NoBootstrap bool
+		NoBootstrap       bool
+		RequireEncryption bool
 
 		APIaddr  string
 		RPCaddr  string
@@ -63,6 +64,7 @@ func main() {
 
 	// Set default values, which have the lowest priority.
 	root.PersistentFlags().BoolVarP(&config.Siad.NoBootstrap, "no-bootstrap", "n", false, "disable bootstrapping on this run")
+	root.PersistentFlags().BoolVarP(&config.Siad.RequireEncryption, "require-encryption", "", false, "refuse peers that do not encrypt their connections")
 	root.PersistentFlags().StringVarP(&config.Siad.APIaddr, "api-addr", "a", "localhost:9980", "which host:port the API server listens on")
 	root.PersistentFlags().StringVarP(&config.Siad.RPCaddr, "rpc-addr", "r", ":9981", "which port the gateway listens on")
 	root.PersistentFlags().StringVarP(&config.Siad.HostAddr, "host-addr", "H", ":9982", "which port the host listens on")
@@ -36,6 +36,12 @@ var (
 
 	GenesisSiafundAllocation []SiafundOutput
 
+	// RevisionPayoutHardforkHeight is the height at which file contract
+	// revisions start being checked against the contract payout after the
+	// siafund fee. Before this height, a revision of a contract that paid a
+	// siafund fee cannot be valid.
+	RevisionPayoutHardforkHeight BlockHeight
+
 	RenterZeroConfDelay time.Duration // TODO: This shouldn't exist here.
 )
 
@@ -75,6 +81,8 @@ func init() {
 
 		MinimumCoinbase = 30e3
 
+		RevisionPayoutHardforkHeight = 20
+
 		GenesisSiafundAllocation = []SiafundOutput{
 			{
 				Value:      NewCurrency64(2000),
@@ -107,6 +115,8 @@ func init() {
 
 		MinimumCoinbase = 299990 // Minimum coinbase is hit after 10 blocks to make testing minimum-coinbase code easier.
 
+		RevisionPayoutHardforkHeight = 3 // Testers are past the hardfork once their wallets have been funded.
+
 		GenesisSiafundAllocation = []SiafundOutput{
 			{
 				Value:      NewCurrency64(2000),
@@ -182,6 +192,11 @@ func init() {
 		// or less permanently settles around 2%.
 		MinimumCoinbase = 30e3
 
+		// The revision payout rule is a hardfork, and is activated far enough
+		// in the future that nodes have time to upgrade before revisions that
+		// older nodes would reject start appearing in blocks.
+		RevisionPayoutHardforkHeight = 20e3
+
 		RenterZeroConfDelay = 60 * time.Second // TODO: This doesn't belong here.
 
 		GenesisSiafundAllocation = []SiafundOutput{
@@ -124,3 +124,13 @@ func (fcid FileContractID) StorageProofOutputID(proofStatus ProofStatus, i int)
 func (fc FileContract) Tax() Currency {
 	return fc.Payout.MulFloat(SiafundPortion).RoundDown(SiafundCount)
 }
+
+// RevisionPayout returns the amount that the missed proof outputs of a
+// revision of fc must add up to at 'height'. From RevisionPayoutHardforkHeight
+// onwards, the siafund fee that was paid when fc was created is not included.
+func (fc FileContract) RevisionPayout(height BlockHeight) Currency {
+	if height < RevisionPayoutHardforkHeight {
+		return fc.Payout
+	}
+	return fc.Payout.Sub(fc.Tax())
+}
@@ -29,12 +29,19 @@ var (
 // correctFileContracts checks that the file contracts adhere to the file
 // contract rules.
 func (t Transaction) correctFileContracts(currentHeight BlockHeight) error {
-	// Check that FileContract rules are being followed.
+	// Check that start and expiration are reasonable values.
 	for _, fc := range t.FileContracts {
-		// Check that start and expiration are reasonable values.
 		if fc.WindowStart <= currentHeight {
 			return ErrFileContractWindowStartViolation
 		}
+	}
+	return t.wellFormedFileContracts()
+}
+
+// wellFormedFileContracts checks the file contract rules that do not depend
+// on the current height.
+func (t Transaction) wellFormedFileContracts() error {
+	for _, fc := range t.FileContracts {
 		if fc.WindowEnd <= fc.WindowStart {
 			return ErrFileContractWindowEndViolation
 		}
@@ -56,12 +63,55 @@ func (t Transaction) correctFileContracts(currentHeight BlockHeight) error {
 			return ErrFileContractOutputSumViolation
 		}
 	}
+
+	// The payout rules for revisions changed at RevisionPayoutHardforkHeight,
+	// but the window rules did not.
+	for _, fcr := range t.FileContractRevisions {
+		if fcr.NewWindowEnd <= fcr.NewWindowStart {
+			return ErrFileContractWindowEndViolation
+		}
+	}
 	return nil
 }
 
 // correctFileContractRevisions checks that any file contract revisions adhere
 // to the revision rules.
 func (t Transaction) correctFileContractRevisions(currentHeight BlockHeight) error {
+	if currentHeight < RevisionPayoutHardforkHeight {
+		return t.correctFileContractRevisionsPreHardfork(currentHeight)
+	}
+	for _, fcr := range t.FileContractRevisions {
+		// Check that start and expiration are reasonable values.
+		if fcr.NewWindowStart <= currentHeight {
+			return ErrFileContractWindowStartViolation
+		}
+		if fcr.NewWindowEnd <= fcr.NewWindowStart {
+			return ErrFileContractWindowEndViolation
+		}
+
+		// Check that the valid outputs and missed outputs sum to the same
+		// value. The siafund fee was paid when the contract was created, so
+		// whether the outputs match the payout of the contract can only be
+		// checked in the context of the consensus set.
+		var validProofOutputSum, missedProofOutputSum Currency
+		for _, output := range fcr.NewValidProofOutputs {
+			validProofOutputSum = validProofOutputSum.Add(output.Value)
+		}
+		for _, output := range fcr.NewMissedProofOutputs {
+			missedProofOutputSum = missedProofOutputSum.Add(output.Value)
+		}
+		if validProofOutputSum.Cmp(missedProofOutputSum) != 0 {
+			return ErrFileContractOutputSumViolation
+		}
+	}
+	return nil
+}
+
+// correctFileContractRevisionsPreHardfork checks file contract revisions
+// against the rules in place before RevisionPayoutHardforkHeight, which treat
+// each revision as a new file contract with a payout equal to the sum of its
+// missed proof outputs.
+func (t Transaction) correctFileContractRevisionsPreHardfork(currentHeight BlockHeight) error {
 	for _, fcr := range t.FileContractRevisions {
 		// To ensure consistency with the file contract rules, a temporary txn
 		// is created containing only the file contract that would result from
@@ -247,11 +297,9 @@ func (t Transaction) validUnlockConditions(currentHeight BlockHeight) (err error
 	return
 }
 
-// StandaloneValid returns an error if a transaction is not valid in any
-// context, for example if the same output is spent twice in the same
-// transaction. StandaloneValid will not check that all outputs being spent are
-// legal outputs, as it has no confirmed or unconfirmed set to look at.
-func (t Transaction) StandaloneValid(currentHeight BlockHeight) (err error) {
+// wellFormed checks the rules that StandaloneValid and StructurallyValid have
+// in common, apart from the signatures.
+func (t Transaction) wellFormed() (err error) {
 	err = t.fitsInABlock()
 	if err != nil {
 		return
@@ -268,6 +316,33 @@ func (t Transaction) StandaloneValid(currentHeight BlockHeight) (err error) {
 	if err != nil {
 		return
 	}
+	return t.wellFormedFileContracts()
+}
+
+// StructurallyValid returns an error if a transaction is invalid at every
+// height, for example if it is too large, spends the same output twice, or is
+// badly signed. Unlike StandaloneValid, it does not check anything that
+// depends on the current height, such as timelocks or the start of a file
+// contract's proof window, so nodes at different heights agree on its result.
+func (t Transaction) StructurallyValid() error {
+	err := t.wellFormed()
+	if err != nil {
+		return err
+	}
+	// Timelocks are the only part of the signature rules that depend on the
+	// height, and no timelock exceeds the largest height.
+	return t.validSignatures(^BlockHeight(0))
+}
+
+// StandaloneValid returns an error if a transaction is not valid in any
+// context, for example if the same output is spent twice in the same
+// transaction. StandaloneValid will not check that all outputs being spent are
+// legal outputs, as it has no confirmed or unconfirmed set to look at.
+func (t Transaction) StandaloneValid(currentHeight BlockHeight) (err error) {
+	err = t.wellFormed()
+	if err != nil {
+		return
+	}
 	err = t.correctFileContracts(currentHeight)
 	if err != nil {
 		return
@@ -136,6 +136,43 @@ func TestCorrectFileContractRevisions(t *testing.T) {
 	}
 }
 
+// TestCorrectFileContractRevisionsHardfork checks that revisions of contracts
+// that paid a siafund fee only become possible at
+// RevisionPayoutHardforkHeight.
+func TestCorrectFileContractRevisionsHardfork(t *testing.T) {
+	if RevisionPayoutHardforkHeight == 0 {
+		t.Skip("no blocks before the hardfork")
+	}
+	fc := FileContract{Payout: NewCurrency64(1e6)}
+	outputs := []SiacoinOutput{{Value: fc.Payout.Sub(fc.Tax())}}
+	txn := Transaction{
+		FileContractRevisions: []FileContractRevision{{
+			NewWindowStart:        RevisionPayoutHardforkHeight + 10,
+			NewWindowEnd:          RevisionPayoutHardforkHeight + 20,
+			NewValidProofOutputs:  outputs,
+			NewMissedProofOutputs: outputs,
+		}},
+	}
+
+	// Before the hardfork, the outputs are treated as the payout of a new
+	// contract, and so must leave room for a siafund fee.
+	err := txn.correctFileContractRevisions(RevisionPayoutHardforkHeight - 1)
+	if err != ErrFileContractOutputSumViolation {
+		t.Error("Expecting ErrFileContractOutputSumViolation before the hardfork:", err)
+	}
+	err = txn.correctFileContractRevisions(RevisionPayoutHardforkHeight)
+	if err != nil {
+		t.Error("revision should be valid after the hardfork:", err)
+	}
+
+	// The valid and missed outputs must still match after the hardfork.
+	txn.FileContractRevisions[0].NewValidProofOutputs = nil
+	err = txn.correctFileContractRevisions(RevisionPayoutHardforkHeight)
+	if err != ErrFileContractOutputSumViolation {
+		t.Error("Expecting ErrFileContractOutputSumViolation after the hardfork:", err)
+	}
+}
+
 // TestTransactionFitsInABlock probes the fitsInABlock method of the
 // Transaction type.
 func TestTransactionFitsInABlock(t *testing.T) {
@@ -461,3 +498,38 @@ func TestTransactionStandaloneValid(t *testing.T) {
 	}
 	txn.TransactionSignatures = nil
 }
+
+// TestTransactionStructurallyValid checks that StructurallyValid catches
+// transactions that are invalid at every height, and ignores the rules that
+// depend on the height.
+func TestTransactionStructurallyValid(t *testing.T) {
+	// Rules that depend on the height are not checked.
+	var txn Transaction
+	txn.SiacoinInputs = []SiacoinInput{{}}
+	txn.SiacoinInputs[0].UnlockConditions.Timelock = 1e6
+	txn.FileContracts = []FileContract{{Payout: NewCurrency64(1), WindowStart: 0, WindowEnd: 1}}
+	txn.FileContracts[0].ValidProofOutputs = []SiacoinOutput{{Value: txn.FileContracts[0].Payout.Sub(txn.FileContracts[0].Tax())}}
+	txn.FileContracts[0].MissedProofOutputs = txn.FileContracts[0].ValidProofOutputs
+	if err := txn.StructurallyValid(); err != nil {
+		t.Fatal(err)
+	}
+	if txn.StandaloneValid(0) == nil {
+		t.Fatal("StandaloneValid accepted a contract whose window has started")
+	}
+
+	// Rules that hold at every height are.
+	txn.FileContracts[0].WindowEnd = 0
+	if txn.StructurallyValid() != ErrFileContractWindowEndViolation {
+		t.Error("failed to trigger the window end rule")
+	}
+	txn.FileContracts = nil
+	txn.SiacoinInputs = append(txn.SiacoinInputs, txn.SiacoinInputs[0])
+	if txn.StructurallyValid() != ErrDoubleSpend {
+		t.Error("failed to trigger noRepeats error")
+	}
+	txn.SiacoinInputs = nil
+	txn.TransactionSignatures = []TransactionSignature{{}}
+	if txn.StructurallyValid() == nil {
+		t.Error("failed to trigger validSignatures error")
+	}
+}